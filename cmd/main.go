@@ -15,6 +15,7 @@ import (
 	"github.com/File-Sharer/file-service/internal/repository/postgres"
 	"github.com/File-Sharer/file-service/internal/server"
 	"github.com/File-Sharer/file-service/internal/service"
+	"github.com/File-Sharer/file-service/internal/storage"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
@@ -76,9 +77,14 @@ func main() {
 		logger.Sugar().Fatalf("error connection to rabbitmq: %s", err.Error())
 	}
 
+	store, err := storage.New(viper.GetString("storage.backend"))
+	if err != nil {
+		logger.Sugar().Fatalf("error initializing storage backend: %s", err.Error())
+	}
+
 	repo := repository.New(db)
-	services := service.New(logger, repo, rabbitmq, hasherClient, rdb)
-	handlers := handler.New(logger, services, hasherClient)
+	services := service.New(logger, repo, rabbitmq, hasherClient, rdb, store)
+	handlers := handler.New(logger, services, hasherClient, store)
 
 	services.StartAllWorkers(context.Background())
 
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/File-Sharer/file-service/internal/config"
+	"github.com/File-Sharer/file-service/internal/repository/postgres"
+	"github.com/joho/godotenv"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Fills files and folders storage_key column from the absolute file-storage URLs saved before it existed,
+// must be run after the 000002_storage_key migration and before 000003_drop_url.
+// With -down it fills url back from storage_key after 000003_drop_url is reverted
+func main() {
+	down := flag.Bool("down", false, "fill url from storage_key after reverting 000003_drop_url")
+	flag.Parse()
+
+	logger, _ := zap.NewProduction()
+
+	if err := initConfig(); err != nil {
+		logger.Sugar().Fatalf("error initializing config: %s", err.Error())
+	}
+
+	if err := initEnv(); err != nil {
+		logger.Sugar().Fatalf("error initializing env: %s", err.Error())
+	}
+
+	dbConfig := &config.DBConfig{
+		Username: os.Getenv("DB_USERNAME"),
+		Password: os.Getenv("DB_PASSWORD"),
+		Host: os.Getenv("DB_HOST"),
+		Port: os.Getenv("DB_PORT"),
+		DBName: os.Getenv("DB_NAME"),
+		SSLMode: os.Getenv("DB_SSLMODE"),
+	}
+	db, err := postgres.NewPgPool(context.Background(), dbConfig)
+	if err != nil {
+		logger.Sugar().Fatalf("error connecting to postgresql: %s", err.Error())
+	}
+	defer db.Close()
+
+	urlPrefix := viper.GetString("fileStorage.origin") + "/files/"
+	if *down {
+		files, folders, err := postgres.RestoreURLs(context.Background(), db, urlPrefix)
+		if err != nil {
+			logger.Sugar().Fatalf("error restoring urls: %s", err.Error())
+		}
+
+		logger.Sugar().Infof("Restored urls of %d files and %d folders", files, folders)
+		return
+	}
+
+	files, folders, err := postgres.BackfillStorageKeys(context.Background(), db, urlPrefix)
+	if err != nil {
+		logger.Sugar().Fatalf("error migrating storage keys: %s", err.Error())
+	}
+
+	logger.Sugar().Infof("Migrated storage keys of %d files and %d folders", files, folders)
+}
+
+func initConfig() error {
+	viper.AddConfigPath("configs")
+	viper.SetConfigType("yaml")
+	viper.SetConfigName("config")
+	return viper.ReadInConfig()
+}
+
+func initEnv() error {
+	return godotenv.Load()
+}
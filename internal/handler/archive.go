@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type archivesCreateReq struct {
+	FileIDs   []string `json:"fileIds"`
+	FolderIDs []string `json:"folderIds"`
+	Name      string   `json:"name"`
+}
+
+func (h *Handler) archivesCreate(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	var input archivesCreateReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	// Entries are resolved up front, so missing items and access errors are still reported as JSON
+	entries, err := h.services.Archive.Resolve(c.Request.Context(), input.FileIDs, input.FolderIDs, *userRole, *userSpace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSuffix(strings.TrimSpace(input.Name), ".zip")
+	if name == "" {
+		name = "archive"
+	}
+
+	c.Header("filename", name + ".zip")
+	c.Header("Content-Disposition", contentDisposition("attachment", name + ".zip"))
+	c.Header("Content-Type", "application/zip")
+	if err := h.services.Archive.Write(c.Request.Context(), entries, newDeadlineWriter(c)); err != nil {
+		h.logger.Sugar().Errorf("failed to write archive of user(%s): %s", userSpace.UserID, err.Error())
+	}
+}
@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// serveBlob sends the blob at key as an attachment, answering conditional and range requests.
+// count, if set, is called before content that reaches the end of the blob is sent, its error cancels the download
+func (h *Handler) serveBlob(c *gin.Context, key, filename string, size int64, etag string, modTime time.Time, count func() error) {
+	lastModified := modTime.UTC()
+
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+
+	if notModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	rng, satisfiable := requestedRange(c.Request, size, etag, lastModified)
+	if !satisfiable {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+		c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{"ok": false, "error": "requested range not satisfiable"})
+		return
+	}
+
+	if count != nil && (rng == nil || rng.end == size - 1) {
+		if err := count(); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+	}
+
+	var f io.ReadCloser
+	var err error
+	if rng != nil {
+		f, err = h.storage.GetRange(c.Request.Context(), key, rng.start, rng.length())
+	} else {
+		f, err = h.storage.Get(c.Request.Context(), key)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	status := http.StatusOK
+	contentLength := size
+	if rng != nil {
+		status = http.StatusPartialContent
+		contentLength = rng.length()
+		c.Header("Content-Range", rng.contentRange(size))
+	}
+
+	c.Header("filename", filename)
+	c.Header("Content-Disposition", contentDisposition("attachment", filename))
+	c.Header("Content-Type", contentType(filename))
+	c.Header("Content-Length", strconv.FormatInt(contentLength, 10))
+	c.Status(status)
+	io.Copy(newDeadlineWriter(c), f)
+}
+
+// deadlineWriter extends the write deadline of the response before every write, so a large response
+// is only cut off when the client stops reading and not by the write timeout of the server
+type deadlineWriter struct {
+	w io.Writer
+	rc *http.ResponseController
+	timeout time.Duration
+}
+
+func newDeadlineWriter(c *gin.Context) *deadlineWriter {
+	return &deadlineWriter{
+		w: c.Writer,
+		rc: http.NewResponseController(c.Writer),
+		timeout: viper.GetDuration("downloads.writeTimeout"),
+	}
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	// A zero timeout lifts the deadline
+	var deadline time.Time
+	if d.timeout > 0 {
+		deadline = time.Now().Add(d.timeout)
+	}
+	if err := d.rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+
+	return d.w.Write(p)
+}
+
+// errorStatus maps an error of the services to the status of the response, errors that are not the client's are 500
+func errorStatus(err error) int {
+	switch {
+	case service.IsNotFound(err):
+		return http.StatusNotFound
+	case service.IsNoAccess(err):
+		return http.StatusForbidden
+	case service.IsConflict(err):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// byteRange is an inclusive range of bytes
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+func (r byteRange) length() int64 {
+	return r.end - r.start + 1
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size)
+}
+
+// requestedRange returns the single range asked by the request or nil if the whole content should be sent,
+// multiple ranges and malformed headers are ignored. The returned bool is false if the range is not satisfiable
+func requestedRange(r *http.Request, size int64, etag string, lastModified time.Time) (*byteRange, bool) {
+	header := r.Header.Get("Range")
+	if header == "" || !strings.HasPrefix(header, "bytes=") {
+		return nil, true
+	}
+
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" {
+		if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+			if ifRange != etag {
+				return nil, true
+			}
+		} else {
+			t, err := http.ParseTime(ifRange)
+			if err != nil || !t.Equal(lastModified.Truncate(time.Second)) {
+				return nil, true
+			}
+		}
+	}
+
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	if strings.Contains(spec, ",") {
+		return nil, true
+	}
+
+	startStr, endStr, found := strings.Cut(spec, "-")
+	if !found {
+		return nil, true
+	}
+	startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+	if startStr == "" {
+		// Suffix range, the last N bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n < 0 {
+			return nil, true
+		}
+		if n == 0 || size == 0 {
+			return nil, false
+		}
+		if n > size {
+			n = size
+		}
+		return &byteRange{start: size - n, end: size - 1}, true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return nil, true
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return nil, true
+		}
+		if end > size - 1 {
+			end = size - 1
+		}
+	}
+
+	if start >= size {
+		return nil, false
+	}
+
+	return &byteRange{start: start, end: end}, true
+}
+
+// notModified reports whether the client's cached copy is still fresh
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+		t, err := http.ParseTime(ifModifiedSince)
+		if err == nil && !lastModified.Truncate(time.Second).After(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contentType(filename string) string {
+	if t := mime.TypeByExtension(filepath.Ext(filename)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// contentDisposition builds the header with an ASCII fallback name and the RFC 5987 encoded UTF-8 name
+func contentDisposition(dispositionType, filename string) string {
+	var fallback strings.Builder
+	for _, r := range filename {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			fallback.WriteByte('_')
+			continue
+		}
+		fallback.WriteRune(r)
+	}
+
+	return fmt.Sprintf("%s; filename=\"%s\"; filename*=UTF-8''%s", dispositionType, fallback.String(), encodeRFC5987(filename))
+}
+
+func encodeRFC5987(s string) string {
+	const attrChars = "!#$&+-.^_`|~"
+
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte(attrChars, c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/File-Sharer/file-service/internal/model"
 	"github.com/File-Sharer/file-service/internal/service"
@@ -13,6 +15,7 @@ import (
 
 func (h *Handler) filesCreate(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
 
 	var fileObj model.File
 
@@ -41,13 +44,42 @@ func (h *Handler) filesCreate(c *gin.Context) {
 	fileObj.Public = &isPublic
 	fileObj.DownloadName = downloadName
 
+	newVersion := false
+	if newVersionForm := c.PostForm("newVersion"); newVersionForm != "" {
+		newVersion, err = strconv.ParseBool(newVersionForm)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "newVersion option type must be boolean"})
+			return
+		}
+	}
+
+	extract := false
+	if extractForm := c.PostForm("extract"); extractForm != "" {
+		extract, err = strconv.ParseBool(extractForm)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "extract option type must be boolean"})
+			return
+		}
+	}
+
 	file, fileHeader, err := c.Request.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "file is required"})
 		return
 	}
 
-	createdFile, err := h.services.File.Create(c.Request.Context(), *userSpace, fileObj, file, fileHeader)
+	if extract {
+		report, err := h.services.File.Extract(c.Request.Context(), *userRole, *userSpace, fileObj, file, fileHeader)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": report})
+		return
+	}
+
+	createdFile, err := h.services.File.Create(c.Request.Context(), *userRole, *userSpace, fileObj, file, fileHeader, newVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
 		return
@@ -56,6 +88,48 @@ func (h *Handler) filesCreate(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": createdFile})
 }
 
+func (h *Handler) filesMove(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	fileID := c.Param("file_id")
+
+	// An empty body moves or copies to the root
+	var input targetFolderReq
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	file, err := h.services.File.Move(c.Request.Context(), fileID, userSpace.UserID, input.folderID())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": file})
+}
+
+func (h *Handler) filesCopy(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	fileID := c.Param("file_id")
+
+	// An empty body moves or copies to the root
+	var input targetFolderReq
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	file, err := h.services.File.Copy(c.Request.Context(), fileID, *userSpace, input.folderID())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": file})
+}
+
 func (h *Handler) filesGet(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
 	userRole := h.getUserRole(c)
@@ -74,9 +148,19 @@ func (h *Handler) filesGet(c *gin.Context) {
 func (h *Handler) filesFindUser(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
 
-	files, err := h.services.File.FindUserFiles(c.Request.Context(), userSpace.UserID)
+	q, err := listQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	files, err := h.services.File.FindUserFiles(c.Request.Context(), userSpace.UserID, q)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if service.IsInvalidQuery(err) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"ok": false, "error": err.Error()})
 		return
 	}
 
@@ -91,37 +175,69 @@ func (h *Handler) filesDownload(c *gin.Context) {
 
 	file, err := h.services.File.ProtectedFindByID(c.Request.Context(), fileID, *userRole, *userSpace)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"ok": false, "error": err.Error()})
 		return
 	}
 
-	f, err := h.requestFileFromFileStorage(file.URL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
-		return
+	// The checksum of deduplicated content is the best tag, files uploaded before have none
+	etag := fmt.Sprintf("\"%s-%d-%d-%d\"", file.ID, file.Version, file.Size, file.DateAdded.Unix())
+	if file.Checksum != nil {
+		etag = "\"" + *file.Checksum + "\""
 	}
-	defer f.Close()
 
-	c.Header("filename", file.DownloadName)
-	io.Copy(c.Writer, f)
+	h.serveBlob(c, file.StorageKey, file.DownloadName, file.Size, etag, file.DateAdded, nil)
+}
+
+// permissionReq sets the role granted by a permission and when it expires, an empty body grants the viewer role for good
+type permissionReq struct {
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (r permissionReq) role() string {
+	if r.Role == "" {
+		return model.RoleViewer
+	}
+	return r.Role
 }
 
 func (h *Handler) filesAddPermission(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
 
 	fileID := c.Param("file_id")
 	userToAddName := c.Param("username")
+
+	var input permissionReq
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
 	
 	data := service.AddPermissionData{
 		ResourceID: fileID,
 		UserSpace: *userSpace,
+		UserRole: *userRole,
 		UserToAddName: userToAddName,
+		Role: input.role(),
+		ExpiresAt: input.ExpiresAt,
 	}
-	if err := h.services.File.AddPermission(c.Request.Context(), data); err != nil {
+	invitation, err := h.services.File.AddPermission(c.Request.Context(), data)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
 		return
 	}
 
+	permissionAdded(c, invitation)
+}
+
+// permissionAdded responds 202 with the invitation the user still has to accept, or 200 if the permission was granted right away
+func permissionAdded(c *gin.Context, invitation *model.Invitation) {
+	if invitation != nil {
+		c.JSON(http.StatusAccepted, gin.H{"ok": true, "error": nil, "data": invitation})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
 }
 
@@ -148,7 +264,7 @@ func (h *Handler) filesDeletePermission(c *gin.Context) {
 
 	if err := h.services.File.DeletePermission(c.Request.Context(), service.DeletePermissionData{
 		ResourceID: fileID,
-		UserID: userSpace.UserID,
+		UserSpace: *userSpace,
 		UserRole: *userRole,
 		UserToDeleteName: userToDeleteName,
 	}); err != nil {
@@ -161,10 +277,11 @@ func (h *Handler) filesDeletePermission(c *gin.Context) {
 
 func (h *Handler) filesFindPermissionsToFile(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
 
 	fileID := c.Param("file_id")
 
-	permissions, err := h.services.File.FindPermissionsToFile(c.Request.Context(), fileID, userSpace.UserID)
+	permissions, err := h.services.File.FindPermissionsToFile(c.Request.Context(), fileID, *userRole, *userSpace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
 		return
@@ -185,3 +302,89 @@ func (h *Handler) filesTogglePublic(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
 }
+
+func (h *Handler) filesGetVersions(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	fileID := c.Param("file_id")
+
+	versions, err := h.services.File.GetVersions(c.Request.Context(), fileID, *userRole, *userSpace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+func (h *Handler) filesCreateVersion(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	fileID := c.Param("file_id")
+
+	file, fileHeader, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "file is required"})
+		return
+	}
+	defer file.Close()
+
+	updatedFile, err := h.services.File.CreateVersion(c.Request.Context(), *userRole, *userSpace, fileID, file, fileHeader.Size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": updatedFile})
+}
+
+func (h *Handler) filesDownloadVersion(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	fileID := c.Param("file_id")
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "version must be a number"})
+		return
+	}
+
+	file, v, err := h.services.File.GetVersion(c.Request.Context(), fileID, version, *userRole, *userSpace)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if service.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	// A version never changes, so its tag does not depend on anything else
+	etag := fmt.Sprintf("\"%s-v%d\"", file.ID, v.Version)
+
+	h.serveBlob(c, *v.StorageKey, file.DownloadName, v.Size, etag, v.CreatedAt, nil)
+}
+
+func (h *Handler) filesRestoreVersion(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	fileID := c.Param("file_id")
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "version must be a number"})
+		return
+	}
+
+	file, err := h.services.File.RestoreVersion(c.Request.Context(), *userRole, *userSpace, fileID, version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": file})
+}
@@ -3,22 +3,23 @@ package handler
 import (
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/File-Sharer/file-service/internal/model"
 	"github.com/File-Sharer/file-service/internal/service"
 	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
 )
 
 type foldersCreateReq struct {
 	FolderID *string `json:"folderId"`
 	Name     string  `json:"name" binding:"required"`
-	Public   bool   `json"isPublic"`
+	Public   bool    `json:"isPublic"`
 }
 
 func (h *Handler) foldersCreate(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
 
 	var input foldersCreateReq
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -31,7 +32,7 @@ func (h *Handler) foldersCreate(c *gin.Context) {
 		CreatorID: userSpace.UserID,
 		Name: input.Name,
 		Public: &input.Public,
-	})
+	}, *userRole, *userSpace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
 		return
@@ -40,15 +41,103 @@ func (h *Handler) foldersCreate(c *gin.Context) {
 	c.JSON(http.StatusOK, folder)
 }
 
+type foldersRenameReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (h *Handler) foldersRename(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	folderID := c.Param("id")
+
+	var input foldersRenameReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	if err := h.services.Folder.Rename(c.Request.Context(), folderID, input.Name, *userRole, *userSpace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+// targetFolderReq points to the folder to move or copy into, an empty folderId is the root
+type targetFolderReq struct {
+	FolderID *string `json:"folderId"`
+}
+
+func (r targetFolderReq) folderID() *string {
+	if r.FolderID == nil || strings.TrimSpace(*r.FolderID) == "" {
+		return nil
+	}
+	return r.FolderID
+}
+
+func (h *Handler) foldersMove(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	folderID := c.Param("id")
+
+	// An empty body moves or copies to the root
+	var input targetFolderReq
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	folder, err := h.services.Folder.Move(c.Request.Context(), folderID, userSpace.UserID, input.folderID())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": folder})
+}
+
+func (h *Handler) foldersCopy(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	folderID := c.Param("id")
+
+	// An empty body moves or copies to the root
+	var input targetFolderReq
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	folder, err := h.services.Folder.Copy(c.Request.Context(), folderID, *userSpace, input.folderID())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": folder})
+}
+
 func (h *Handler) foldersGetContents(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
 	userRole := h.getUserRole(c)
 
 	id := c.Param("id")
 
-	contents, err := h.services.Folder.GetFolderContents(c.Request.Context(), id, *userRole, *userSpace)
+	q, err := listQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	contents, err := h.services.Folder.GetFolderContents(c.Request.Context(), id, *userRole, *userSpace, q)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if service.IsInvalidQuery(err) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"ok": false, "error": err.Error()})
 		return
 	}
 
@@ -58,21 +147,32 @@ func (h *Handler) foldersGetContents(c *gin.Context) {
 func (h *Handler) foldersGetUser(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
 
-	folders, err := h.services.Folder.GetUserFolders(c.Request.Context(), userSpace.UserID)
+	q, err := listQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	folders, err := h.services.Folder.GetUserFolders(c.Request.Context(), userSpace.UserID, q)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if service.IsInvalidQuery(err) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"ok": false, "error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, folders)
+	c.JSON(http.StatusOK, *folders)
 }
 
 func (h *Handler) foldersGetPermissions(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
 
 	folderID := c.Param("id")
 
-	permissions, err := h.services.Folder.GetPermissions(c.Request.Context(), folderID, userSpace.UserID)
+	permissions, err := h.services.Folder.GetPermissions(c.Request.Context(), folderID, *userRole, *userSpace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
 		return
@@ -88,17 +188,26 @@ func (h *Handler) foldersAddPermission(c *gin.Context) {
 	folderID := c.Param("id")
 	userToAddName := c.Param("username")
 
-	if err := h.services.Folder.AddPermission(c.Request.Context(), service.AddPermissionData{
+	var input permissionReq
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	invitation, err := h.services.Folder.AddPermission(c.Request.Context(), service.AddPermissionData{
 		ResourceID: folderID,
 		UserSpace: *userSpace,
 		UserRole: *userRole,
 		UserToAddName: userToAddName,
-	}); err != nil {
+		Role: input.role(),
+		ExpiresAt: input.ExpiresAt,
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+	permissionAdded(c, invitation)
 }
 
 func (h *Handler) foldersDeletePermission(c *gin.Context) {
@@ -110,7 +219,7 @@ func (h *Handler) foldersDeletePermission(c *gin.Context) {
 
 	if err := h.services.Folder.DeletePermission(c.Request.Context(), service.DeletePermissionData{
 		ResourceID: folderID,
-		UserID: userSpace.UserID,
+		UserSpace: *userSpace,
 		UserRole: *userRole,
 		UserToDeleteName: userToDeleteName,
 	}); err != nil {
@@ -121,6 +230,68 @@ func (h *Handler) foldersDeletePermission(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
 }
 
+func (h *Handler) foldersGetTree(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	depth := 3
+	if v := c.Query("depth"); v != "" {
+		var err error
+		depth, err = strconv.Atoi(v)
+		if err != nil || depth < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "depth must be a positive number"})
+			return
+		}
+	}
+
+	tree, err := h.services.Folder.GetTree(c.Request.Context(), c.Param("id"), depth, *userRole, *userSpace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tree)
+}
+
+func (h *Handler) foldersGetPath(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	path, err := h.services.Folder.GetPath(c.Request.Context(), c.Param("id"), *userRole, *userSpace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, path)
+}
+
+func (h *Handler) foldersGetSize(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	stats, err := h.services.Folder.GetStats(c.Request.Context(), c.Param("id"), *userRole, *userSpace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *Handler) foldersTogglePublic(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	folderID := c.Param("id")
+
+	if err := h.services.Folder.TogglePublic(c.Request.Context(), folderID, userSpace.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
 func (h *Handler) foldersGetZipped(c *gin.Context) {
 	userSpace := h.getUserSpace(c)
 	userRole := h.getUserRole(c)
@@ -133,21 +304,25 @@ func (h *Handler) foldersGetZipped(c *gin.Context) {
 		return
 	}
 
-	parts := strings.Split(folder.URL, viper.GetString("fileStorage.origin") + "/files/")
-	if len(parts) != 2 {
-		h.logger.Sugar().Errorf("invalid folder(%s) URL: %v", folder.ID, parts)
-		return
+	// Files are deduplicated and not stored under the folder, so the archive is built from the folder tree
+	c.Header("filename", folder.Name + ".zip")
+	c.Header("Content-Disposition", contentDisposition("attachment", folder.Name + ".zip"))
+	c.Header("Content-Type", "application/zip")
+	if err := h.services.Folder.Zip(c.Request.Context(), folder, newDeadlineWriter(c)); err != nil {
+		h.logger.Sugar().Errorf("failed to zip folder(%s): %s", folderID, err.Error())
 	}
-	path := parts[1]
+}
 
-	f, err := h.requestZippedFolderFromFileStorage(path)
-	if err != nil {
-		h.logger.Error(err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": errInternal})
+func (h *Handler) foldersDelete(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	folderID := c.Param("id")
+
+	if err := h.services.Folder.Delete(c.Request.Context(), folderID, *userRole, *userSpace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
 		return
 	}
-	defer f.Close()
 
-	c.Header("filename", folder.Name)
-	io.Copy(c.Writer, f)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
 }
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/File-Sharer/file-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type groupsCreateReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (h *Handler) groupsCreate(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	var input groupsCreateReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	group, err := h.services.Group.Create(c.Request.Context(), input.Name, userSpace.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "error": nil, "data": group})
+}
+
+func (h *Handler) groupsGetUser(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	groups, err := h.services.Group.GetUserGroups(c.Request.Context(), userSpace.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+func (h *Handler) groupsGet(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	group, err := h.services.Group.Get(c.Request.Context(), c.Param("id"), *userRole, userSpace.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+func (h *Handler) groupsDelete(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	if err := h.services.Group.Delete(c.Request.Context(), c.Param("id"), *userRole, userSpace.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) groupsAddMember(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	invitation, err := h.services.Group.AddMember(c.Request.Context(), c.Param("id"), c.Param("username"), *userRole, *userSpace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	permissionAdded(c, invitation)
+}
+
+func (h *Handler) groupsDeleteMember(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	if err := h.services.Group.DeleteMember(c.Request.Context(), c.Param("id"), c.Param("username"), *userRole, userSpace.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) filesAddGroupPermission(c *gin.Context) {
+	h.addGroupPermission(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersAddGroupPermission(c *gin.Context) {
+	h.addGroupPermission(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) addGroupPermission(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	var input permissionReq
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	if err := h.services.Group.AddPermission(c.Request.Context(), service.AddGroupPermissionData{
+		ResourceType: resourceType,
+		ResourceID: resourceID,
+		GroupID: c.Param("group_id"),
+		Role: input.role(),
+		ExpiresAt: input.ExpiresAt,
+		UserRole: *userRole,
+		UserSpace: *userSpace,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) filesDeleteGroupPermission(c *gin.Context) {
+	h.deleteGroupPermission(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersDeleteGroupPermission(c *gin.Context) {
+	h.deleteGroupPermission(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) deleteGroupPermission(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	if err := h.services.Group.DeletePermission(c.Request.Context(), resourceType, resourceID, c.Param("group_id"), *userRole, *userSpace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) filesGetGroupPermissions(c *gin.Context) {
+	h.getGroupPermissions(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersGetGroupPermissions(c *gin.Context) {
+	h.getGroupPermissions(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) getGroupPermissions(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	permissions, err := h.services.Group.GetPermissions(c.Request.Context(), resourceType, resourceID, *userRole, *userSpace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, permissions)
+}
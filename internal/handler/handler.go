@@ -3,13 +3,13 @@ package handler
 import (
 	"context"
 	"errors"
-	"net/http"
 	"os"
 	"strings"
 
 	pb "github.com/File-Sharer/file-service/hasher_pbs"
 	"github.com/File-Sharer/file-service/internal/model"
 	"github.com/File-Sharer/file-service/internal/service"
+	"github.com/File-Sharer/file-service/internal/storage"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
@@ -20,15 +20,15 @@ type Handler struct {
 	logger *zap.Logger
 	services *service.Service
 	hasherClient pb.HasherClient
-	httpClient *http.Client
+	storage storage.Backend
 }
 
-func New(logger *zap.Logger, services *service.Service, hasherClient pb.HasherClient) *Handler {
+func New(logger *zap.Logger, services *service.Service, hasherClient pb.HasherClient, store storage.Backend) *Handler {
 	return &Handler{
 		logger: logger,
 		services: services,
 		hasherClient: hasherClient,
-		httpClient: &http.Client{},
+		storage: store,
 	}
 }
 
@@ -39,9 +39,9 @@ func (h *Handler) InitRoutes() *gin.Engine {
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins: []string{viper.GetString("frontend.origin")},
-		AllowHeaders: []string{"Authorization", "Content-Type"},
-		AllowMethods: []string{"POST", "GET", "PUT", "DELETE", "PATCH"},
-		ExposeHeaders: []string{"filename"},
+		AllowHeaders: []string{"Authorization", "Content-Type", "Upload-Offset", "Range", "If-Range", "If-None-Match", "If-Modified-Since", "X-Share-Password"},
+		AllowMethods: []string{"POST", "GET", "PUT", "DELETE", "PATCH", "HEAD"},
+		ExposeHeaders: []string{"filename", "Location", "Upload-Offset", "Upload-Length", "Accept-Ranges", "Content-Range", "Content-Length", "Content-Disposition", "ETag", "Last-Modified"},
 	}))
 
 	api := router.Group("/api")
@@ -58,11 +58,29 @@ func (h *Handler) InitRoutes() *gin.Engine {
 		{
 			folders.POST("", h.foldersCreate)
 			folders.GET("/:id/contents", h.foldersGetContents)
+			folders.GET("/:id/tree", h.foldersGetTree)
+			folders.GET("/:id/path", h.foldersGetPath)
+			folders.GET("/:id/size", h.foldersGetSize)
 			folders.GET("", h.foldersGetUser)
 			folders.GET("/:id/permissions", h.foldersGetPermissions)
 			folders.PUT("/:id/:username", h.foldersAddPermission)
 			folders.DELETE("/:id/:username", h.foldersDeletePermission)
 			folders.GET("/:id/dl", h.foldersGetZipped)
+			folders.DELETE("/:id", h.foldersDelete)
+			folders.PATCH("/:id", h.foldersRename)
+			folders.PATCH("/:id/togglepub", h.foldersTogglePublic)
+			folders.POST("/:id/move", h.foldersMove)
+			folders.POST("/:id/copy", h.foldersCopy)
+			folders.POST("/:id/links", h.foldersCreateShareLink)
+			folders.GET("/:id/links", h.foldersGetShareLinks)
+			folders.GET("/:id/groups", h.foldersGetGroupPermissions)
+			folders.PUT("/:id/groups/:group_id", h.foldersAddGroupPermission)
+			folders.DELETE("/:id/groups/:group_id", h.foldersDeleteGroupPermission)
+			folders.PUT("/:id/tags/:tag", h.foldersAddTag)
+			folders.DELETE("/:id/tags/:tag", h.foldersDeleteTag)
+			folders.GET("/:id/metadata", h.foldersGetMetadata)
+			folders.PUT("/:id/metadata/:key", h.foldersSetMetadata)
+			folders.DELETE("/:id/metadata/:key", h.foldersDeleteMetadata)
 		}
 
 		files := api.Group("/files")
@@ -77,9 +95,82 @@ func (h *Handler) InitRoutes() *gin.Engine {
 			files.DELETE("/:file_id/:username", h.filesDeletePermission)
 			files.GET("/:file_id/permissions", h.filesFindPermissionsToFile)
 			files.PATCH("/:file_id/togglepub", h.filesTogglePublic)
+			files.POST("/:file_id/move", h.filesMove)
+			files.POST("/:file_id/copy", h.filesCopy)
+			files.GET("/:file_id/versions", h.filesGetVersions)
+			files.POST("/:file_id/versions", h.filesCreateVersion)
+			files.GET("/:file_id/versions/:version/dl", h.filesDownloadVersion)
+			files.POST("/:file_id/versions/:version/restore", h.filesRestoreVersion)
+			files.POST("/:file_id/links", h.filesCreateShareLink)
+			files.GET("/:file_id/links", h.filesGetShareLinks)
+			files.GET("/:file_id/groups", h.filesGetGroupPermissions)
+			files.PUT("/:file_id/groups/:group_id", h.filesAddGroupPermission)
+			files.DELETE("/:file_id/groups/:group_id", h.filesDeleteGroupPermission)
+			files.PUT("/:file_id/tags/:tag", h.filesAddTag)
+			files.DELETE("/:file_id/tags/:tag", h.filesDeleteTag)
+			files.GET("/:file_id/metadata", h.filesGetMetadata)
+			files.PUT("/:file_id/metadata/:key", h.filesSetMetadata)
+			files.DELETE("/:file_id/metadata/:key", h.filesDeleteMetadata)
 		}
+
+		uploads := api.Group("/uploads")
+		uploads.Use(h.mwAuth)
+		{
+			uploads.POST("", h.uploadsCreate)
+			uploads.HEAD("/:id", h.uploadsHead)
+			uploads.PATCH("/:id", h.uploadsPatch)
+			uploads.POST("/:id/finalize", h.uploadsFinalize)
+			uploads.DELETE("/:id", h.uploadsDelete)
+		}
+
+		trash := api.Group("/trash")
+		trash.Use(h.mwAuth)
+		{
+			trash.GET("", h.trashGet)
+			trash.POST("/files/:id/restore", h.trashRestoreFile)
+			trash.POST("/folders/:id/restore", h.trashRestoreFolder)
+			trash.DELETE("/files/:id", h.trashPurgeFile)
+			trash.DELETE("/folders/:id", h.trashPurgeFolder)
+		}
+
+		api.GET("/shared", h.mwAuth, h.sharedGet)
+
+		api.GET("/search", h.mwAuth, h.search)
+
+		groups := api.Group("/groups")
+		groups.Use(h.mwAuth)
+		{
+			groups.POST("", h.groupsCreate)
+			groups.GET("", h.groupsGetUser)
+			groups.GET("/:id", h.groupsGet)
+			groups.DELETE("/:id", h.groupsDelete)
+			groups.PUT("/:id/members/:username", h.groupsAddMember)
+			groups.DELETE("/:id/members/:username", h.groupsDeleteMember)
+		}
+
+		invitations := api.Group("/invitations")
+		invitations.Use(h.mwAuth)
+		{
+			invitations.GET("", h.invitationsGet)
+			invitations.POST("/:id/accept", h.invitationsAccept)
+			invitations.POST("/:id/decline", h.invitationsDecline)
+			invitations.GET("/trusted", h.invitationsGetTrusted)
+			invitations.PUT("/trusted/:username", h.invitationsTrust)
+			invitations.DELETE("/trusted/:username", h.invitationsDistrust)
+		}
+
+		links := api.Group("/links")
+		links.Use(h.mwAuth)
+		{
+			links.DELETE("/:id", h.linksRevoke)
+		}
+
+		api.POST("/archives", h.mwAuth, h.archivesCreate)
 	}
 
+	// Share links are opened without signing in
+	router.GET("/s/:token", h.sharedDownload)
+
 	return router
 }
 
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) invitationsGet(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	invitations, err := h.services.Invitation.GetPending(c.Request.Context(), userSpace.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+func (h *Handler) invitationsAccept(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	if err := h.services.Invitation.Accept(c.Request.Context(), c.Param("id"), userSpace.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) invitationsDecline(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	if err := h.services.Invitation.Decline(c.Request.Context(), c.Param("id"), userSpace.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) invitationsGetTrusted(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	trusted, err := h.services.Invitation.GetTrusted(c.Request.Context(), userSpace.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, trusted)
+}
+
+func (h *Handler) invitationsTrust(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	if err := h.services.Invitation.Trust(c.Request.Context(), userSpace.Username, c.Param("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) invitationsDistrust(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	if err := h.services.Invitation.Distrust(c.Request.Context(), userSpace.Username, c.Param("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
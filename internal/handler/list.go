@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// listQuery reads the paging, sorting and filtering options of a listing from the query string
+func listQuery(c *gin.Context) (service.ListQuery, error) {
+	q := service.ListQuery{Cursor: c.Query("cursor")}
+	q.Sort = c.Query("sort")
+	q.Ext = c.Query("ext")
+	q.Tag = c.Query("tag")
+
+	switch c.Query("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+	if q.Sort == "" && c.Query("order") != "" {
+		q.Sort = "date"
+	}
+
+	var err error
+	if limit := c.Query("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return q, fmt.Errorf("limit must be a number")
+		}
+	}
+
+	for param, size := range map[string]**int64{"minSize": &q.MinSize, "maxSize": &q.MaxSize} {
+		if v := c.Query(param); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return q, fmt.Errorf("%s must be a number", param)
+			}
+			*size = &n
+		}
+	}
+
+	for param, date := range map[string]**time.Time{"from": &q.From, "to": &q.To} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 date", param)
+			}
+			*date = &t
+		}
+	}
+
+	if v := c.Query("public"); v != "" {
+		public, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("public must be boolean")
+		}
+		q.Public = &public
+	}
+
+	return q, nil
+}
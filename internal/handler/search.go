@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/File-Sharer/file-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) search(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	q := service.SearchQuery{
+		Text: c.Query("q"),
+		Type: c.Query("type"),
+	}
+
+	var err error
+	if limit := c.Query("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "limit must be a number"})
+			return
+		}
+	}
+	if offset := c.Query("offset"); offset != "" {
+		q.Offset, err = strconv.Atoi(offset)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "offset must be a number"})
+			return
+		}
+	}
+
+	results, err := h.services.Search.Search(c.Request.Context(), *userSpace, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type shareLinksCreateReq struct {
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	MaxDownloads *int       `json:"maxDownloads" binding:"omitempty,min=1"`
+	Password     string     `json:"password" binding:"max=72"`
+}
+
+func (h *Handler) filesCreateShareLink(c *gin.Context) {
+	h.createShareLink(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersCreateShareLink(c *gin.Context) {
+	h.createShareLink(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) createShareLink(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+
+	// An empty body creates a link without limits
+	var input shareLinksCreateReq
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	link, err := h.services.ShareLink.Create(c.Request.Context(), service.CreateShareLinkData{
+		ResourceType: resourceType,
+		ResourceID: resourceID,
+		UserID: userSpace.UserID,
+		ExpiresAt: input.ExpiresAt,
+		MaxDownloads: input.MaxDownloads,
+		Password: input.Password,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "error": nil, "data": link})
+}
+
+func (h *Handler) filesGetShareLinks(c *gin.Context) {
+	h.getShareLinks(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersGetShareLinks(c *gin.Context) {
+	h.getShareLinks(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) getShareLinks(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+
+	links, err := h.services.ShareLink.GetByResource(c.Request.Context(), resourceType, resourceID, userSpace.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+func (h *Handler) linksRevoke(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	if err := h.services.ShareLink.Revoke(c.Request.Context(), c.Param("id"), userSpace.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+// sharedDownload streams the file or the zipped folder of the link to anyone who has it and knows its password
+func (h *Handler) sharedDownload(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	link, file, folder, err := h.services.ShareLink.Open(ctx, c.Param("token"), c.GetHeader("X-Share-Password"), c.ClientIP())
+	if err != nil {
+		status := http.StatusNotFound
+		if service.IsTooManyAttempts(err) {
+			status = http.StatusTooManyRequests
+		}
+		c.JSON(status, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+
+	countDownload := func() error {
+		return h.services.ShareLink.CountDownload(ctx, link)
+	}
+
+	if file != nil {
+		etag := fmt.Sprintf("\"%s-%d-%d\"", file.ID, file.Version, file.Size)
+		if file.Checksum != nil {
+			etag = "\"" + *file.Checksum + "\""
+		}
+
+		// A file counts once it is served to its end, so a download resumed with ranges counts once
+		h.serveBlob(c, file.StorageKey, file.DownloadName, file.Size, etag, file.DateAdded, countDownload)
+		return
+	}
+
+	if err := countDownload(); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.Header("filename", folder.Name + ".zip")
+	c.Header("Content-Disposition", contentDisposition("attachment", folder.Name + ".zip"))
+	c.Header("Content-Type", "application/zip")
+	if err := h.services.Folder.Zip(ctx, folder, newDeadlineWriter(c)); err != nil {
+		h.logger.Sugar().Errorf("failed to zip folder(%s) of share link(%s): %s", folder.ID, link.ID, err.Error())
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/File-Sharer/file-service/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) sharedGet(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	q := service.SharedQuery{
+		Sort: c.Query("sort"),
+	}
+
+	switch c.Query("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "order must be asc or desc"})
+		return
+	}
+	if q.Sort == "" && c.Query("order") != "" {
+		q.Sort = "sharedAt"
+	}
+
+	var err error
+	if limit := c.Query("limit"); limit != "" {
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "limit must be a number"})
+			return
+		}
+	}
+	if offset := c.Query("offset"); offset != "" {
+		q.Offset, err = strconv.Atoi(offset)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "offset must be a number"})
+			return
+		}
+	}
+
+	shared, err := h.services.Shared.Get(c.Request.Context(), userSpace.Username, q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, shared)
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) filesAddTag(c *gin.Context) {
+	h.addTag(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersAddTag(c *gin.Context) {
+	h.addTag(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) addTag(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	if err := h.services.Tag.AddTag(c.Request.Context(), resourceType, resourceID, c.Param("tag"), *userRole, *userSpace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) filesDeleteTag(c *gin.Context) {
+	h.deleteTag(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersDeleteTag(c *gin.Context) {
+	h.deleteTag(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) deleteTag(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	if err := h.services.Tag.DeleteTag(c.Request.Context(), resourceType, resourceID, c.Param("tag"), *userRole, *userSpace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) filesGetMetadata(c *gin.Context) {
+	h.getMetadata(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersGetMetadata(c *gin.Context) {
+	h.getMetadata(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) getMetadata(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	metadata, err := h.services.Tag.GetMetadata(c.Request.Context(), resourceType, resourceID, *userRole, *userSpace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
+}
+
+type metadataSetReq struct {
+	Value *string `json:"value" binding:"required"`
+}
+
+func (h *Handler) filesSetMetadata(c *gin.Context) {
+	h.setMetadata(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersSetMetadata(c *gin.Context) {
+	h.setMetadata(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) setMetadata(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	var input metadataSetReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	if err := h.services.Tag.SetMetadata(c.Request.Context(), resourceType, resourceID, c.Param("key"), *input.Value, *userRole, *userSpace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) filesDeleteMetadata(c *gin.Context) {
+	h.deleteMetadata(c, "file", c.Param("file_id"))
+}
+
+func (h *Handler) foldersDeleteMetadata(c *gin.Context) {
+	h.deleteMetadata(c, "folder", c.Param("id"))
+}
+
+func (h *Handler) deleteMetadata(c *gin.Context, resourceType, resourceID string) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	if err := h.services.Tag.DeleteMetadata(c.Request.Context(), resourceType, resourceID, c.Param("key"), *userRole, *userSpace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) trashGet(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	trash, err := h.services.Trash.Get(c.Request.Context(), userSpace.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, trash)
+}
+
+func (h *Handler) trashRestoreFile(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	fileID := c.Param("id")
+
+	file, err := h.services.File.Restore(c.Request.Context(), fileID, userSpace.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": file})
+}
+
+func (h *Handler) trashRestoreFolder(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	folderID := c.Param("id")
+
+	folder, err := h.services.Folder.Restore(c.Request.Context(), folderID, userSpace.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": folder})
+}
+
+func (h *Handler) trashPurgeFile(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	fileID := c.Param("id")
+
+	if err := h.services.File.Purge(c.Request.Context(), fileID, *userRole, *userSpace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func (h *Handler) trashPurgeFolder(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	folderID := c.Param("id")
+
+	report, err := h.services.Folder.Purge(c.Request.Context(), folderID, *userRole, *userSpace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	if len(report.Failed) > 0 {
+		c.JSON(http.StatusMultiStatus, gin.H{"ok": false, "error": "some items were not deleted", "data": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": report})
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+type uploadsCreateReq struct {
+	FolderID     *string `json:"folderId"`
+	DownloadName string  `json:"downloadName" binding:"required"`
+	Public       bool    `json:"isPublic"`
+	Size         int64   `json:"size" binding:"required,min=1"`
+}
+
+func (h *Handler) uploadsCreate(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	var input uploadsCreateReq
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	downloadName := strings.TrimSpace(input.DownloadName)
+	if downloadName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "download filename is required"})
+		return
+	}
+
+	session, err := h.services.UploadSession.Create(c.Request.Context(), *userRole, *userSpace, model.UploadSession{
+		FolderID: input.FolderID,
+		DownloadName: downloadName,
+		Public: &input.Public,
+		Size: input.Size,
+	})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.Header("Location", "/api/uploads/" + session.ID)
+	setUploadHeaders(c, session.Offset, session.Size)
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "error": nil, "data": session})
+}
+
+func (h *Handler) uploadsHead(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	session, err := h.services.UploadSession.Get(c.Request.Context(), c.Param("id"), userSpace.UserID)
+	if err != nil {
+		c.Status(errorStatus(err))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	setUploadHeaders(c, session.Offset, session.Size)
+	c.Status(http.StatusOK)
+}
+
+func (h *Handler) uploadsPatch(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"ok": false, "error": "content type must be application/offset+octet-stream"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Upload-Offset header must be a non-negative integer"})
+		return
+	}
+
+	// A chunk may take longer than the server's read and write timeouts to arrive, the response must still get through
+	// or the client retries a chunk that was already written
+	rc := http.NewResponseController(c.Writer)
+	deadline := time.Now().Add(viper.GetDuration("uploads.chunkTimeout"))
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		h.logger.Sugar().Errorf("failed to extend read deadline for upload chunk: %s", err.Error())
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		h.logger.Sugar().Errorf("failed to extend write deadline for upload chunk: %s", err.Error())
+	}
+
+	newOffset, err := h.services.UploadSession.WriteChunk(c.Request.Context(), c.Param("id"), userSpace.UserID, offset, c.Request.Body)
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) uploadsFinalize(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+	userRole := h.getUserRole(c)
+
+	if extract, _ := strconv.ParseBool(c.Query("extract")); extract {
+		report, err := h.services.UploadSession.FinalizeExtract(c.Request.Context(), c.Param("id"), *userRole, *userSpace)
+		if err != nil {
+			c.JSON(errorStatus(err), gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": report})
+		return
+	}
+
+	file, err := h.services.UploadSession.Finalize(c.Request.Context(), c.Param("id"), *userRole, *userSpace)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil, "data": file})
+}
+
+func (h *Handler) uploadsDelete(c *gin.Context) {
+	userSpace := h.getUserSpace(c)
+
+	if err := h.services.UploadSession.Abort(c.Request.Context(), c.Param("id"), userSpace.UserID); err != nil {
+		c.JSON(errorStatus(err), gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "error": nil})
+}
+
+func setUploadHeaders(c *gin.Context, offset, size int64) {
+	c.Header("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(size, 10))
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// ArchiveEntry is a file written to a ZIP archive under Name, an entry without a file is a folder
+type ArchiveEntry struct {
+	Name     string
+	File     *File
+	Modified time.Time
+}
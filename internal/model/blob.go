@@ -0,0 +1,8 @@
+package model
+
+// Blob is content stored once and shared by every file version with the same SHA-256 checksum
+type Blob struct {
+	Hash       string `json:"hash"`
+	StorageKey string `json:"storageKey"`
+	Size       int64  `json:"size"`
+}
@@ -0,0 +1,13 @@
+package model
+
+type DeleteFailure struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"` // "file" or "folder"
+	Error string `json:"error"`
+}
+
+type DeleteReport struct {
+	DeletedFiles   int              `json:"deletedFiles"`
+	DeletedFolders int              `json:"deletedFolders"`
+	Failed         []*DeleteFailure `json:"failed"`
+}
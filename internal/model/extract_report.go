@@ -0,0 +1,17 @@
+package model
+
+type ExtractResult struct {
+	Path  string `json:"path"`
+	Type  string `json:"type"` // "file" or "folder"
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ExtractReport tells what became of every entry of an extracted archive, Error is set if the extraction stopped early
+type ExtractReport struct {
+	Folder    *Folder          `json:"folder"`
+	Extracted int              `json:"extracted"`
+	Failed    int              `json:"failed"`
+	Entries   []*ExtractResult `json:"entries"`
+	Error     string           `json:"error,omitempty"`
+}
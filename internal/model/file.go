@@ -1,17 +1,39 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type File struct {
-	ID           string    `json:"id"`
-	MainFolderID *string   `json:"mainFolderId"`
-	FolderID     *string   `json:"folderId"`
-	CreatorID    string    `json:"creatorId"`
-	CreatorName  *string   `json:"creatorName"`
-	Size         int64     `json:"size"`
-	URL          string    `json:"url"`
-	Public       *bool     `json:"public"`
-	Filename     *string   `json:"filename"`
-	DownloadName string    `json:"downloadName"`
-	DateAdded    time.Time `json:"dateAdded"`
+	ID           string     `json:"id"`
+	MainFolderID *string    `json:"mainFolderId"`
+	FolderID     *string    `json:"folderId"`
+	CreatorID    string     `json:"creatorId"`
+	CreatorName  *string    `json:"creatorName"`
+	Size         int64      `json:"size"`
+	Version      int        `json:"version"`
+	StorageKey   string     `json:"-"`
+	Checksum     *string    `json:"checksum"`
+	Public       *bool      `json:"public"`
+	Filename     *string    `json:"filename"`
+	DownloadName string     `json:"downloadName"`
+	DateAdded    time.Time  `json:"dateAdded"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+}
+
+// URL is where the file is downloaded from. It is derived from the ID, so it stays the same
+// whichever storage backend keeps the blob and storage keys never leave the service
+func (f File) URL() string {
+	return "/api/files/" + f.ID + "/dl"
+}
+
+// MarshalJSON adds the url of the file
+func (f File) MarshalJSON() ([]byte, error) {
+	type file File
+	return json.Marshal(struct {
+		file
+		URL string `json:"url"`
+	}{file: file(f), URL: f.URL()})
 }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type FileVersion struct {
+	FileID     string     `json:"fileId"`
+	Version    int        `json:"version"`
+	Size       int64      `json:"size"`
+	StorageKey *string    `json:"-"`
+	Checksum   *string    `json:"checksum"`
+	Current    bool       `json:"current"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ArchivedAt *time.Time `json:"archivedAt"`
+}
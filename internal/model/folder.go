@@ -1,19 +1,66 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Folder struct {
-	ID           string    `json:"id"`
-	MainFolderID *string   `json:"mainFolderId"`
-	FolderID     *string   `json:"folderId"`
-	CreatorID    string    `json:"creatorId"`
-	URL          string    `json:"url"`
-	Name         string    `json:"name"`
-	Public       *bool     `json:"public"`
-	CreatedAt    time.Time `json:"createdAt"`
+	ID           string     `json:"id"`
+	MainFolderID *string    `json:"mainFolderId"`
+	FolderID     *string    `json:"folderId"`
+	CreatorID    string     `json:"creatorId"`
+	StorageKey   string     `json:"-"`
+	Name         string     `json:"name"`
+	Public       *bool      `json:"public"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+}
+
+// URL is where the folder is downloaded zipped from, like File.URL
+func (f Folder) URL() string {
+	return "/api/folders/" + f.ID + "/dl"
+}
+
+// MarshalJSON adds the url of the folder
+func (f Folder) MarshalJSON() ([]byte, error) {
+	type folder Folder
+	return json.Marshal(struct {
+		folder
+		URL string `json:"url"`
+	}{folder: folder(f), URL: f.URL()})
 }
 
 type FolderContents struct {
-	Files   []*File   `json:"files"`
-	Folders []*Folder `json:"folders"`
+	Files      []*File   `json:"files"`
+	Folders    []*Folder `json:"folders"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// FolderStats is summed up over everything nested in a folder at any depth, trashed items are left out
+type FolderStats struct {
+	Size    int64 `json:"size"`
+	Files   int   `json:"files"`
+	Folders int   `json:"folders"`
+}
+
+// FolderTree is a folder with the files and folders nested in it down to a depth, folders at the depth come without them
+type FolderTree struct {
+	Folder
+	Stats   *FolderStats  `json:"stats"`
+	Files   []*File       `json:"files,omitempty"`
+	Folders []*FolderTree `json:"folders,omitempty"`
+}
+
+// MarshalJSON keeps the stats and the nested items, Folder.MarshalJSON would be promoted otherwise
+func (t FolderTree) MarshalJSON() ([]byte, error) {
+	type folder Folder
+	return json.Marshal(struct {
+		folder
+		URL     string        `json:"url"`
+		Stats   *FolderStats  `json:"stats"`
+		Files   []*File       `json:"files,omitempty"`
+		Folders []*FolderTree `json:"folders,omitempty"`
+	}{folder: folder(t.Folder), URL: t.URL(), Stats: t.Stats, Files: t.Files, Folders: t.Folders})
 }
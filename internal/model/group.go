@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+type Group struct {
+	ID        string    `json:"id"`
+	OwnerID   string    `json:"ownerId"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Members   []string  `json:"members,omitempty"`
+}
+
+// GroupPermission is a role in a file or folder granted to every member of a group
+type GroupPermission struct {
+	ResourceType string     `json:"resourceType"`
+	ResourceID   string     `json:"resourceId"`
+	GroupID      string     `json:"groupId"`
+	GroupName    string     `json:"groupName"`
+	Role         string     `json:"role"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// Statuses of an invitation, only pending invitations can be accepted or declined
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
+// GroupMemberRole is the role of invitations to groups, accepting one makes the user a member of the group
+const GroupMemberRole = "member"
+
+// Invitation is a permission or a group membership offered to a user that is granted once the user accepts it
+type Invitation struct {
+	ID           string     `json:"id"`
+	ResourceType string     `json:"resourceType"`
+	ResourceID   string     `json:"resourceId"`
+	ResourceName string     `json:"resourceName"`
+	InviterID    string     `json:"inviterId"`
+	InviterName  string     `json:"inviterName"`
+	Invitee      string     `json:"invitee"`
+	Role         string     `json:"role"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	RespondedAt  *time.Time `json:"respondedAt"`
+}
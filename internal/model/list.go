@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// ListQuery pages, sorts and filters a listing of files and folders. Folders come before files,
+// filters by extension and size leave folders out
+type ListQuery struct {
+	Sort    string // "name", "size" or "date"
+	Desc    bool
+	Limit   int
+	After   *ListCursor
+	Ext     string
+	MinSize *int64
+	MaxSize *int64
+	From    *time.Time
+	To      *time.Time
+	Public  *bool
+	Tag     string
+}
+
+// ListCursor is where the next page of a listing starts, Value is the sort value of the last item as text.
+// The sort and order of the listing are kept, so the value is only compared with values of its sort
+type ListCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Kind  int    `json:"k"`
+	Value string `json:"v"`
+	ID    string `json:"i"`
+}
+
+type FilePage struct {
+	Items      []*File `json:"items"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+type FolderPage struct {
+	Items      []*Folder `json:"items"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Roles a permission grants, every role includes the rights of the roles before it
+const (
+	RoleViewer  = "viewer"  // reads and downloads
+	RoleEditor  = "editor"  // also uploads, creates folders, renames and deletes inside shared folders
+	RoleManager = "manager" // also renames and deletes the shared file or folder and manages its permissions
+)
+
+type Permission struct {
+	ResourceID string `json:"resourceId"`
+	Username   string `json:"username"`
+	Role       string     `json:"role"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
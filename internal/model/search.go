@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// SearchHit is a file or folder the user can view whose name matches a search, Path is made of the names of the folders it is in
+type SearchHit struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	FolderID  *string   `json:"folderId"`
+	Path      string    `json:"path"`
+	OwnerID   string    `json:"ownerId"`
+	Size      *int64    `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type SearchResults struct {
+	Items []*SearchHit `json:"items"`
+	Total int          `json:"total"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// ShareLink gives anyone with its ID access to a file or a folder without signing in
+type ShareLink struct {
+	ID           string     `json:"id"`
+	ResourceType string     `json:"resourceType"`
+	ResourceID   string     `json:"resourceId"`
+	CreatorID    string     `json:"creatorId"`
+	PasswordHash *string    `json:"-"`
+	HasPassword  bool       `json:"hasPassword"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	MaxDownloads *int       `json:"maxDownloads"`
+	Downloads    int        `json:"downloads"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// SharedItem is a file or a root folder another user shared with the user
+type SharedItem struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Size      *int64    `json:"size"`
+	OwnerID   string    `json:"ownerId"`
+	OwnerName string    `json:"ownerName"`
+	Role      string    `json:"role"`
+	SharedAt  time.Time  `json:"sharedAt"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type SharedItems struct {
+	Items []*SharedItem `json:"items"`
+	Total int           `json:"total"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+type UploadSession struct {
+	ID           string    `json:"id"`
+	CreatorID    string    `json:"creatorId"`
+	OwnerID      string    `json:"ownerId"` // owner of the folder the upload goes to, whose space it reserves
+	FolderID     *string   `json:"folderId"`
+	DownloadName string    `json:"downloadName"`
+	Public       *bool     `json:"public"`
+	Size         int64     `json:"size"`
+	Offset       int64     `json:"offset"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
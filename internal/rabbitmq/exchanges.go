@@ -2,4 +2,6 @@ package rabbitmq
 
 const (
 	USERS_CREATE_EXCHANGE = "users.create"
+	PERMISSIONS_EXPIRED_EXCHANGE = "permissions.expired"
+	INVITATIONS_CREATED_EXCHANGE = "invitations.created"
 )
@@ -62,6 +62,18 @@ func (mq *MQConn) PublishExchange(exchange string, body []byte) error {
 	}
 	defer ch.Close()
 
+	if err := ch.ExchangeDeclare(
+		exchange,
+		"fanout",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	); err != nil {
+		return err
+	}
+
 	return ch.Publish(
 		exchange,
 		"",
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type blobRepo struct {
+	db *pgxpool.Pool
+}
+
+func newBlobRepo(db *pgxpool.Pool) Blob {
+	return &blobRepo{db: db}
+}
+
+// Acquire takes a reference to the blob with the hash, pgx.ErrNoRows is returned if there is no such blob
+func (r *blobRepo) Acquire(ctx context.Context, hash string) (*model.Blob, error) {
+	blob := model.Blob{Hash: hash}
+	if err := r.db.QueryRow(
+		ctx,
+		"UPDATE blobs SET ref_count = ref_count + 1 WHERE hash = $1 RETURNING storage_key, size",
+		hash,
+	).Scan(&blob.StorageKey, &blob.Size); err != nil {
+		return nil, err
+	}
+
+	return &blob, nil
+}
+
+// Create saves the blob with one reference, if a blob with the same hash was saved in the meantime a reference to it is taken and it is returned instead
+func (r *blobRepo) Create(ctx context.Context, blob model.Blob) (*model.Blob, error) {
+	stored := model.Blob{Hash: blob.Hash}
+	if err := r.db.QueryRow(
+		ctx,
+		`
+		INSERT INTO blobs(hash, storage_key, size, ref_count) VALUES($1, $2, $3, 1)
+		ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1
+		RETURNING storage_key, size
+		`,
+		blob.Hash, blob.StorageKey, blob.Size,
+	).Scan(&stored.StorageKey, &stored.Size); err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+// Release drops a reference to each of the blobs and returns the storage keys of the blobs nothing references anymore
+func (r *blobRepo) Release(ctx context.Context, hashes []string) ([]string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	keys, err := releaseBlobs(ctx, tx, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// releaseBlobs drops a reference for every hash, a hash may repeat, and deletes the blobs nothing references anymore returning their storage keys
+func releaseBlobs(ctx context.Context, tx pgx.Tx, hashes []string) ([]string, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.Exec(
+		ctx,
+		`
+		UPDATE blobs b SET ref_count = b.ref_count - r.n
+		FROM (SELECT hash, count(*) AS n FROM unnest($1::text[]) AS hash GROUP BY hash) r
+		WHERE b.hash = r.hash
+		`,
+		hashes,
+	); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, "DELETE FROM blobs WHERE hash = ANY($1) AND ref_count <= 0 RETURNING storage_key", hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// deleteVersionRows deletes the version rows matched by condition and releases the blobs they referenced, the storage keys of unreferenced blobs are returned
+func deleteVersionRows(ctx context.Context, tx pgx.Tx, condition string, args ...any) ([]string, error) {
+	rows, err := tx.Query(ctx, "DELETE FROM file_versions WHERE " + condition + " RETURNING checksum", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums, err := pgx.CollectRows(rows, pgx.RowTo[*string])
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	for _, c := range checksums {
+		if c != nil {
+			hashes = append(hashes, *c)
+		}
+	}
+
+	return releaseBlobs(ctx, tx, hashes)
+}
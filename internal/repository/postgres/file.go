@@ -2,8 +2,10 @@ package postgres
 
 import (
 	"context"
+	"time"
 
 	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -15,8 +17,18 @@ func newFileRepo(db *pgxpool.Pool) File {
 	return &fileRepo{db: db}
 }
 
+// createFileQuery creates the file with its first version
+const createFileQuery = `
+	WITH f AS (
+		INSERT INTO files(id, main_folder_id, folder_id, creator_id, size, storage_key, public, filename, download_name, checksum)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, version, size, checksum
+	)
+	INSERT INTO file_versions(file_id, version, size, checksum) SELECT id, version, size, checksum FROM f
+`
+
 func (r *fileRepo) Create(ctx context.Context, file *model.File) error {
-	_, err := r.db.Exec(ctx, "INSERT INTO files(id, main_folder_id, folder_id, creator_id, size, url, public, filename, download_name) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)", file.ID, file.MainFolderID, file.FolderID, file.CreatorID, file.Size, file.URL, file.Public, file.Filename, file.DownloadName)
+	_, err := r.db.Exec(ctx, createFileQuery, file.ID, file.MainFolderID, file.FolderID, file.CreatorID, file.Size, file.StorageKey, file.Public, file.Filename, file.DownloadName, file.Checksum)
 	return err
 }
 
@@ -24,17 +36,22 @@ func (r *fileRepo) FindByID(ctx context.Context, id string) (*model.File, error)
 	var file model.File
 	if err := r.db.QueryRow(
 		ctx,
-		"SELECT id, main_folder_id, creator_id, size, url, public, filename, download_name, date_added FROM files WHERE id = $1",
+		"SELECT id, main_folder_id, folder_id, creator_id, size, version, storage_key, checksum, public, filename, download_name, date_added, deleted_at, ARRAY(SELECT t.tag FROM file_tags t WHERE t.file_id = files.id ORDER BY t.tag) FROM files WHERE id = $1",
 		id).Scan(
 			&file.ID,
 			&file.MainFolderID,
+			&file.FolderID,
 			&file.CreatorID,
 			&file.Size,
-			&file.URL,
+			&file.Version,
+			&file.StorageKey,
+			&file.Checksum,
 			&file.Public,
 			&file.Filename,
 			&file.DownloadName,
 			&file.DateAdded,
+			&file.DeletedAt,
+			&file.Tags,
 			); err != nil  {
 		return nil, err
 	}
@@ -42,8 +59,201 @@ func (r *fileRepo) FindByID(ctx context.Context, id string) (*model.File, error)
 	return &file, nil
 }
 
-func (r *fileRepo) FindUserFiles(ctx context.Context, userID string) ([]*model.File, error) {
-	rows, err := r.db.Query(ctx, "SELECT id, creator_id, size, url, public, filename, download_name, date_added FROM files WHERE creator_id = $1 AND main_folder_id IS NULL", userID)
+// FindUserFiles returns a page of the user's root files that are not in the trash
+func (r *fileRepo) FindUserFiles(ctx context.Context, userID string, q model.ListQuery) ([]*model.File, *model.ListCursor, error) {
+	files, _, next, err := list(ctx, r.db, listFilesQuery + " WHERE creator_id = $1 AND main_folder_id IS NULL AND deleted_at IS NULL", []any{userID}, q)
+	return files, next, err
+}
+
+// AddPermission grants the role to the user until expiresAt, a user that already has a permission gets the new role and expiry
+func (r *fileRepo) AddPermission(ctx context.Context, fileID, username, role string, expiresAt *time.Time) error {
+	_, err := r.db.Exec(
+		ctx,
+		"INSERT INTO file_permissions(file_id, username, role, expires_at) VALUES($1, $2, $3, $4) ON CONFLICT (file_id, username) DO UPDATE SET role = EXCLUDED.role, expires_at = EXCLUDED.expires_at",
+		fileID, username, role, expiresAt,
+	)
+	return err
+}
+
+// GetRole returns the highest role of the user in the file, granted directly or through a group, and when it may change,
+// an empty role is returned if the user has no permission or it expired
+func (r *fileRepo) GetRole(ctx context.Context, fileID, username string) (string, *time.Time, error) {
+	var role string
+	var expiresAt *time.Time
+	if err := r.db.QueryRow(
+		ctx,
+		roleQuery("file"),
+		fileID, username,
+	).Scan(&role, &expiresAt); err != nil {
+		if err == pgx.ErrNoRows {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+
+	return role, expiresAt, nil
+}
+
+// DeleteExpiredPermissions deletes the permissions that expired before now and returns them
+func (r *fileRepo) DeleteExpiredPermissions(ctx context.Context, now time.Time) ([]*model.Permission, error) {
+	rows, err := r.db.Query(ctx, "DELETE FROM file_permissions WHERE expires_at <= $1 RETURNING file_id, username, role, expires_at", now)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectPermissions(rows)
+}
+
+func (r *fileRepo) DeletePermission(ctx context.Context, fileID, username string) error {
+	_, err := r.db.Exec(ctx, "DELETE FROM file_permissions WHERE file_id = $1 AND username = $2", fileID, username)
+	return err
+}
+
+// Delete deletes the file with its versions and share links and returns the storage keys of the blobs nothing references anymore
+func (r *fileRepo) Delete(ctx context.Context, id string) ([]string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	orphans, err := deleteVersionRows(ctx, tx, "file_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM files WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM share_links WHERE resource_type = 'file' AND resource_id = $1", id); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM group_permissions WHERE resource_type = 'file' AND resource_id = $1", id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return orphans, nil
+}
+
+func (r *fileRepo) FindPermissionsToFile(ctx context.Context, id string) ([]*model.Permission, error) {
+	rows, err := r.db.Query(
+		ctx,
+		"SELECT file_id, username, role, expires_at FROM file_permissions WHERE file_id = $1 AND (expires_at IS NULL OR expires_at > now()) ORDER BY username",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectPermissions(rows)
+}
+
+func (r *fileRepo) TogglePublic(ctx context.Context, id, creatorID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var public bool
+	if err := tx.QueryRow(ctx, "UPDATE files SET public = NOT public WHERE id = $1 AND creator_id = $2 RETURNING public", id, creatorID).Scan(&public); err != nil {
+		return err
+	}
+
+	if public {
+		if _, err := tx.Exec(ctx, "DELETE FROM file_permissions WHERE file_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM group_permissions WHERE resource_type = 'file' AND resource_id = $1", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM invitations WHERE resource_type = 'file' AND resource_id = $1 AND status = 'pending'", id); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Move saves the new location of the file, its permissions are deleted and returned once it becomes nested
+func (r *fileRepo) Move(ctx context.Context, file *model.File) ([]*model.Permission, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(
+		ctx,
+		"UPDATE files SET folder_id = $1, main_folder_id = $2, storage_key = $3, public = $4, filename = $5 WHERE id = $6",
+		file.FolderID, file.MainFolderID, file.StorageKey, file.Public, file.Filename, file.ID,
+	); err != nil {
+		return nil, err
+	}
+
+	var permissions []*model.Permission
+	if file.MainFolderID != nil {
+		permissions, err = deletePermissions(ctx, tx, "DELETE FROM file_permissions WHERE file_id = ANY($1) RETURNING file_id, username, role, expires_at", []string{file.ID})
+		if err != nil {
+			return nil, err
+		}
+
+		groupPermissions, err := deletePermissions(ctx, tx, deleteGroupPermissionsQuery("file", "resource_id = ANY($1)"), []string{file.ID})
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, groupPermissions...)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// Trash marks the file as deleted and saves the storage key it was moved to
+func (r *fileRepo) Trash(ctx context.Context, id, storageKey string) error {
+	_, err := r.db.Exec(ctx, "UPDATE files SET deleted_at = now(), storage_key = $1 WHERE id = $2", storageKey, id)
+	return err
+}
+
+// Restore brings the file back from the trash to its new location
+func (r *fileRepo) Restore(ctx context.Context, file *model.File) error {
+	_, err := r.db.Exec(
+		ctx,
+		"UPDATE files SET deleted_at = NULL, storage_key = $1, download_name = $2, filename = $3, public = $4 WHERE id = $5",
+		file.StorageKey, file.DownloadName, file.Filename, file.Public, file.ID,
+	)
+	return err
+}
+
+// FindTrashed returns the user's files that were moved to the trash by themselves
+func (r *fileRepo) FindTrashed(ctx context.Context, userID string) ([]*model.File, error) {
+	return r.findTrash(ctx, "f.creator_id = $1 AND " + trashRootCondition, userID)
+}
+
+// FindExpiredTrash returns the files that were moved to the trash by themselves before the given time
+func (r *fileRepo) FindExpiredTrash(ctx context.Context, before time.Time) ([]*model.File, error) {
+	return r.findTrash(ctx, "f.deleted_at < $1 AND " + trashRootCondition, before)
+}
+
+func (r *fileRepo) findTrash(ctx context.Context, condition string, arg any) ([]*model.File, error) {
+	rows, err := r.db.Query(
+		ctx,
+		"SELECT f.id, f.main_folder_id, f.folder_id, f.creator_id, f.size, f.version, f.storage_key, f.checksum, f.public, f.filename, f.download_name, f.date_added, f.deleted_at FROM files f WHERE " + condition + " ORDER BY f.deleted_at DESC",
+		arg,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -52,10 +262,9 @@ func (r *fileRepo) FindUserFiles(ctx context.Context, userID string) ([]*model.F
 	var files []*model.File
 	for rows.Next() {
 		var f model.File
-		if err := rows.Scan(&f.ID, &f.CreatorID, &f.Size, &f.URL, &f.Public, &f.Filename, &f.DownloadName, &f.DateAdded); err != nil {
+		if err := rows.Scan(&f.ID, &f.MainFolderID, &f.FolderID, &f.CreatorID, &f.Size, &f.Version, &f.StorageKey, &f.Checksum, &f.Public, &f.Filename, &f.DownloadName, &f.DateAdded, &f.DeletedAt); err != nil {
 			return nil, err
 		}
-
 		files = append(files, &f)
 	}
 
@@ -66,79 +275,131 @@ func (r *fileRepo) FindUserFiles(ctx context.Context, userID string) ([]*model.F
 	return files, nil
 }
 
-func (r *fileRepo) AddPermission(ctx context.Context, fileID, username string) error {
-	_, err := r.db.Exec(ctx, "INSERT INTO file_permissions(file_id, username) VALUES($1, $2)", fileID, username)
-	return err
-}
+// AddVersion archives the current version of the file under archiveKey and makes the blob the new current version,
+// the reference to the blob taken by the caller is kept by the new version
+func (r *fileRepo) AddVersion(ctx context.Context, fileID, archiveKey string, blob model.Blob) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
 
-func (r *fileRepo) HasPermission(ctx context.Context, fileID, username string) (bool, error) {
-	exists := false
-	if err := r.db.QueryRow(
+	if _, err := tx.Exec(
 		ctx,
-		"SELECT EXISTS(SELECT 1 FROM file_permissions p JOIN files f ON f.id = p.file_id WHERE p.file_id = $1 AND p.username = $2 AND f.main_folder_id IS NULL)",
-		fileID, username,
-		).Scan(&exists); err != nil {
-		return false, err
+		"UPDATE file_versions SET storage_key = $1, archived_at = now() WHERE file_id = $2 AND storage_key IS NULL",
+		archiveKey, fileID,
+	); err != nil {
+		return 0, err
 	}
 
-	return exists, nil
+	var version int
+	if err := tx.QueryRow(
+		ctx,
+		"UPDATE files SET size = $1, storage_key = $2, checksum = $3, version = version + 1 WHERE id = $4 RETURNING version",
+		blob.Size, blob.StorageKey, blob.Hash, fileID,
+	).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, "INSERT INTO file_versions(file_id, version, size, checksum) VALUES($1, $2, $3, $4)", fileID, version, blob.Size, blob.Hash); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	return version, nil
 }
 
-func (r *fileRepo) DeletePermission(ctx context.Context, fileID, username string) error {
-	_, err := r.db.Exec(ctx, "DELETE FROM file_permissions WHERE file_id = $1 AND username = $2", fileID, username)
-	return err
+func (r *fileRepo) FindVersions(ctx context.Context, fileID string) ([]*model.FileVersion, error) {
+	return r.findVersions(ctx, "file_id = $1 ORDER BY version DESC", fileID)
 }
 
-func (r *fileRepo) Delete(ctx context.Context, id string) error {
-	_, err := r.db.Exec(ctx, "DELETE FROM files WHERE id = $1", id)
-	return err
+// FindExpiredVersions returns the versions that were archived before the given time
+func (r *fileRepo) FindExpiredVersions(ctx context.Context, before time.Time) ([]*model.FileVersion, error) {
+	return r.findVersions(ctx, "archived_at < $1", before)
 }
 
-func (r *fileRepo) FindPermissionsToFile(ctx context.Context, id, creatorID string) ([]*string, error) {
-	rows, err := r.db.Query(ctx, "SELECT p.username FROM file_permissions p JOIN files f ON f.id = p.file_id WHERE p.file_id = $1 AND f.creator_id = $2", id, creatorID)
+func (r *fileRepo) findVersions(ctx context.Context, condition string, arg any) ([]*model.FileVersion, error) {
+	rows, err := r.db.Query(
+		ctx,
+		"SELECT file_id, version, size, storage_key, checksum, created_at, archived_at FROM file_versions WHERE " + condition,
+		arg,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var permissions []*string
+	var versions []*model.FileVersion
 	for rows.Next() {
-		var username string
-		if err := rows.Scan(&username); err != nil {
+		var v model.FileVersion
+		if err := rows.Scan(&v.FileID, &v.Version, &v.Size, &v.StorageKey, &v.Checksum, &v.CreatedAt, &v.ArchivedAt); err != nil {
 			return nil, err
 		}
-
-		permissions = append(permissions, &username)
+		v.Current = v.StorageKey == nil
+		versions = append(versions, &v)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return permissions, nil
+	return versions, nil
 }
 
-func (r *fileRepo) TogglePublic(ctx context.Context, id, creatorID string) error {
+func (r *fileRepo) FindVersion(ctx context.Context, fileID string, version int) (*model.FileVersion, error) {
+	var v model.FileVersion
+	if err := r.db.QueryRow(
+		ctx,
+		"SELECT file_id, version, size, storage_key, checksum, created_at, archived_at FROM file_versions WHERE file_id = $1 AND version = $2",
+		fileID, version,
+	).Scan(&v.FileID, &v.Version, &v.Size, &v.StorageKey, &v.Checksum, &v.CreatedAt, &v.ArchivedAt); err != nil {
+		return nil, err
+	}
+	v.Current = v.StorageKey == nil
+
+	return &v, nil
+}
+
+// DeleteVersions deletes archived versions of the file, the current version is never deleted.
+// The storage keys of the blobs nothing references anymore are returned
+func (r *fileRepo) DeleteVersions(ctx context.Context, fileID string, versions []int) ([]string, error) {
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback(ctx)
 
-	var public bool
-	if err := tx.QueryRow(ctx, "UPDATE files SET public = NOT public WHERE id = $1 AND creator_id = $2 RETURNING public", id, creatorID).Scan(&public); err != nil {
-		return err
+	orphans, err := deleteVersionRows(ctx, tx, "file_id = $1 AND version = ANY($2) AND storage_key IS NOT NULL", fileID, versions)
+	if err != nil {
+		return nil, err
 	}
 
-	if public {
-		if _, err := tx.Exec(ctx, "DELETE FROM file_permissions WHERE file_id = $1", id); err != nil {
-			return err
-		}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return err
+	return orphans, nil
+}
+
+// FindInFolder returns the ID of the file with the download name in the folder, a nil folderID is the root of the creator
+func (r *fileRepo) FindInFolder(ctx context.Context, creatorID string, folderID *string, downloadName string) (string, error) {
+	var id string
+	if err := r.db.QueryRow(
+		ctx,
+		`
+		SELECT id FROM files
+		WHERE download_name = $3 AND deleted_at IS NULL
+		AND CASE WHEN $2::text IS NULL THEN folder_id IS NULL AND creator_id = $1 ELSE folder_id = $2 END
+		ORDER BY date_added DESC
+		LIMIT 1
+		`,
+		creatorID, folderID, downloadName,
+	).Scan(&id); err != nil {
+		return "", err
 	}
 
-	return nil
+	return id, nil
 }
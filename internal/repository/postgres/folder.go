@@ -3,8 +3,10 @@ package postgres
 import (
 	"context"
 	"strconv"
+	"time"
 
 	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -19,8 +21,8 @@ func newFolderRepo(db *pgxpool.Pool) Folder {
 func (r *folderRepo) Create(ctx context.Context, f model.Folder) error {
 	_, err := r.db.Exec(
 		ctx,
-		"INSERT INTO folders(id, main_folder_id, folder_id, creator_id, url, name, public) VALUES($1, $2, $3, $4, $5, $6, $7)",
-		f.ID, f.MainFolderID, f.FolderID, f.CreatorID, f.URL, f.Name, f.Public,
+		"INSERT INTO folders(id, main_folder_id, folder_id, creator_id, storage_key, name, public) VALUES($1, $2, $3, $4, $5, $6, $7)",
+		f.ID, f.MainFolderID, f.FolderID, f.CreatorID, f.StorageKey, f.Name, f.Public,
 	)
 	return err
 }
@@ -29,26 +31,32 @@ func (r *folderRepo) FindByID(ctx context.Context, id string) (*model.Folder, er
 	var f model.Folder
 	if err := r.db.QueryRow(
 		ctx,
-		"SELECT id, main_folder_id, folder_id, creator_id, url, name, public, created_at FROM folders WHERE id = $1",
+		"SELECT id, main_folder_id, folder_id, creator_id, storage_key, name, public, created_at, deleted_at, ARRAY(SELECT t.tag FROM folder_tags t WHERE t.folder_id = folders.id ORDER BY t.tag) FROM folders WHERE id = $1",
 		id,
-	).Scan(&f.ID, &f.MainFolderID, &f.FolderID, &f.CreatorID, &f.URL, &f.Name, &f.Public, &f.CreatedAt); err != nil {
+	).Scan(&f.ID, &f.MainFolderID, &f.FolderID, &f.CreatorID, &f.StorageKey, &f.Name, &f.Public, &f.CreatedAt, &f.DeletedAt, &f.Tags); err != nil {
 		return nil, err
 	}
 
 	return &f, nil
 }
 
-func (r *folderRepo) HasPermission(ctx context.Context, id, username string) (bool, error) {
-	exists := false
+// GetRole returns the highest role of the user in the root folder, granted directly or through a group, and when it may change,
+// an empty role is returned if the user has no permission or it expired
+func (r *folderRepo) GetRole(ctx context.Context, id, username string) (string, *time.Time, error) {
+	var role string
+	var expiresAt *time.Time
 	if err := r.db.QueryRow(
 		ctx,
-		"SELECT EXISTS(SELECT 1 FROM folder_permissions p JOIN folders f ON p.folder_id = f.id WHERE p.folder_id = $1 AND p.username = $2 AND f.main_folder_id IS NULL)",
+		roleQuery("folder"),
 		id, username,
-	).Scan(&exists); err != nil {
-		return false, err
+	).Scan(&role, &expiresAt); err != nil {
+		if err == pgx.ErrNoRows {
+			return "", nil, nil
+		}
+		return "", nil, err
 	}
 
-	return exists, nil
+	return role, expiresAt, nil
 }
 
 func (r *folderRepo) Update(ctx context.Context, id string, fields map[string]interface{}) error {
@@ -84,89 +92,75 @@ func (r *folderRepo) Update(ctx context.Context, id string, fields map[string]in
 	return err
 }
 
-func (r *folderRepo) GetFolderContents(ctx context.Context, id string) ([]*model.File, []*model.Folder, error) {
-	fileRows, err := r.db.Query(
-		ctx,
-		"SELECT id, main_folder_id, creator_id, size, url, filename, date_added from files WHERE folder_id = $1",
-		id,
-	)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer fileRows.Close()
-
-	var files []*model.File
-	for fileRows.Next() {
-		var f model.File
-		if err := fileRows.Scan(&f.ID, &f.MainFolderID, &f.CreatorID, &f.Size, &f.URL, &f.Filename, &f.DateAdded); err != nil {
-			return nil, nil, err
-		}
-		f.FolderID = &id
-		files = append(files, &f)
-	}
+// GetFolderContents returns a page of the files and folders in the folder that are not in the trash
+func (r *folderRepo) GetFolderContents(ctx context.Context, id string, q model.ListQuery) ([]*model.File, []*model.Folder, *model.ListCursor, error) {
+	items := listFoldersQuery + " WHERE folder_id = $1 AND deleted_at IS NULL UNION ALL " + listFilesQuery + " WHERE folder_id = $1 AND deleted_at IS NULL"
+	return list(ctx, r.db, items, []any{id}, q)
+}
 
-	if err := fileRows.Err(); err != nil {
-		return nil, nil, err
-	}
+// GetUserFolders returns a page of the user's root folders that are not in the trash
+func (r *folderRepo) GetUserFolders(ctx context.Context, userID string, q model.ListQuery) ([]*model.Folder, *model.ListCursor, error) {
+	_, folders, next, err := list(ctx, r.db, listFoldersQuery + " WHERE creator_id = $1 AND main_folder_id IS NULL AND deleted_at IS NULL", []any{userID}, q)
+	return folders, next, err
+}
 
-	folderRows, err := r.db.Query(
+// AddPermission grants the role to the user until expiresAt, a user that already has a permission gets the new role and expiry
+func (r *folderRepo) AddPermission(ctx context.Context, folderID, username, role string, expiresAt *time.Time) error {
+	_, err := r.db.Exec(
 		ctx,
-		"SELECT id, main_folder_id, creator_id, url, name, created_at FROM folders WHERE folder_id = $1",
-		id,
+		"INSERT INTO folder_permissions(folder_id, username, role, expires_at) VALUES($1, $2, $3, $4) ON CONFLICT (folder_id, username) DO UPDATE SET role = EXCLUDED.role, expires_at = EXCLUDED.expires_at",
+		folderID, username, role, expiresAt,
 	)
-	if err != nil {
-		return nil, nil, err
-	}
-	defer folderRows.Close()
-
-	var folders []*model.Folder
-	for folderRows.Next() {
-		var f model.Folder
-		if err := folderRows.Scan(&f.ID, &f.MainFolderID, &f.CreatorID, &f.URL, &f.Name, &f.CreatedAt); err != nil {
-			return nil, nil, err
-		}
-		f.FolderID = &id
-		folders = append(folders, &f)
-	}
+	return err
+}
 
-	if err := folderRows.Err(); err != nil {
-		return nil, nil, err
+// DeleteExpiredPermissions deletes the permissions that expired before now and returns them
+func (r *folderRepo) DeleteExpiredPermissions(ctx context.Context, now time.Time) ([]*model.Permission, error) {
+	rows, err := r.db.Query(ctx, "DELETE FROM folder_permissions WHERE expires_at <= $1 RETURNING folder_id, username, role, expires_at", now)
+	if err != nil {
+		return nil, err
 	}
 
-	return files, folders, nil
+	return collectPermissions(rows)
 }
 
-func (r *folderRepo) GetUserFolders(ctx context.Context, userID string) ([]*model.Folder, error) {
-	rows, err := r.db.Query(
-		ctx,
-		"SELECT id, url, name, public, created_at FROM folders WHERE creator_id = $1 AND main_folder_id IS NULL",
-		userID,
-	)
+// TogglePublic makes the root folder public or private, a folder that becomes public loses its permissions,
+// which are returned with group permissions once for every member, and its pending invitations
+func (r *folderRepo) TogglePublic(ctx context.Context, id, creatorID string) ([]*model.Permission, error) {
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	var folders []*model.Folder
-	for rows.Next() {
-		var f model.Folder
-		if err := rows.Scan(&f.ID, &f.URL, &f.Name, &f.Public, &f.CreatedAt); err != nil {
+	var public bool
+	if err := tx.QueryRow(ctx, "UPDATE folders SET public = NOT public WHERE id = $1 AND creator_id = $2 AND main_folder_id IS NULL RETURNING public", id, creatorID).Scan(&public); err != nil {
+		return nil, err
+	}
+
+	var permissions []*model.Permission
+	if public {
+		permissions, err = deletePermissions(ctx, tx, "DELETE FROM folder_permissions WHERE folder_id = ANY($1) RETURNING folder_id, username, role, expires_at", []string{id})
+		if err != nil {
+			return nil, err
+		}
+
+		groupPermissions, err := deletePermissions(ctx, tx, deleteGroupPermissionsQuery("folder", "resource_id = ANY($1)"), []string{id})
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, groupPermissions...)
+
+		if _, err := tx.Exec(ctx, "DELETE FROM invitations WHERE resource_type = 'folder' AND resource_id = $1 AND status = 'pending'", id); err != nil {
 			return nil, err
 		}
-		f.CreatorID = userID
-		folders = append(folders, &f)
 	}
 
-	if err := rows.Err(); err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
 
-	return folders, nil
-}
-
-func (r *folderRepo) AddPermission(ctx context.Context, folderID, username string) error {
-	_, err := r.db.Exec(ctx, "INSERT INTO folder_permissions(folder_id, username) VALUES($1, $2)", folderID, username)
-	return err
+	return permissions, nil
 }
 
 func (r *folderRepo) DeletePermission(ctx context.Context, folderID, username string) error {
@@ -174,29 +168,30 @@ func (r *folderRepo) DeletePermission(ctx context.Context, folderID, username st
 	return err
 }
 
-func (r *folderRepo) Delete(ctx context.Context, folderID, userID string) error {
-	_, err := r.db.Exec(ctx, "DELETE FROM folders WHERE id = $1 AND creator_id = $2", folderID, userID)
-	return err
-}
-
-func (r *folderRepo) GetPermissions(ctx context.Context, folderID, creatorID string) ([]*string, error) {
+func (r *folderRepo) GetPermissions(ctx context.Context, folderID string) ([]*model.Permission, error) {
 	rows, err := r.db.Query(
 		ctx,
-		"SELECT p.username FROM folder_permissions p JOIN folders f ON f.id = p.folder_id WHERE p.folder_id = $1 AND f.creator_id = $2",
-		folderID, creatorID,
+		"SELECT folder_id, username, role, expires_at FROM folder_permissions WHERE folder_id = $1 AND (expires_at IS NULL OR expires_at > now()) ORDER BY username",
+		folderID,
 	)
 	if err != nil {
 		return nil, err
 	}
+
+	return collectPermissions(rows)
+}
+
+// collectPermissions scans rows of resource ID, username, role and expiry
+func collectPermissions(rows pgx.Rows) ([]*model.Permission, error) {
 	defer rows.Close()
 
-	var permissions []*string
+	var permissions []*model.Permission
 	for rows.Next() {
-		var username string
-		if err := rows.Scan(&username); err != nil {
+		var p model.Permission
+		if err := rows.Scan(&p.ResourceID, &p.Username, &p.Role, &p.ExpiresAt); err != nil {
 			return nil, err
 		}
-		permissions = append(permissions, &username)
+		permissions = append(permissions, &p)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -210,7 +205,7 @@ func (r *folderRepo) HasFile(ctx context.Context, folderID, filename string) (bo
 	var exists bool
 	if err := r.db.QueryRow(
 		ctx,
-		"SELECT EXISTS(SELECT 1 FROM files WHERE folder_id = $1 AND download_name = $2)",
+		"SELECT EXISTS(SELECT 1 FROM files WHERE folder_id = $1 AND download_name = $2 AND deleted_at IS NULL)",
 		folderID, filename,
 	).Scan(&exists); err != nil {
 		return false, err
@@ -223,7 +218,7 @@ func (r *folderRepo) HasFolder(ctx context.Context, userID string, folderName st
 	var exists bool
 	if err := r.db.QueryRow(
 		ctx,
-		"SELECT EXISTS(SELECT 1 FROM folders WHERE creator_id = $1 AND name = $2)",
+		"SELECT EXISTS(SELECT 1 FROM folders WHERE creator_id = $1 AND name = $2 AND folder_id IS NULL AND deleted_at IS NULL)",
 		userID, folderName,
 	).Scan(&exists); err != nil {
 		return false, err
@@ -236,7 +231,7 @@ func (r *folderRepo) HasFolderInFolder(ctx context.Context, folderName, folderID
 	var exists bool
 	if err := r.db.QueryRow(
 		ctx,
-		"SELECT EXISTS(SELECT 1 FROM folders WHERE folder_id = $1 AND name = $2)",
+		"SELECT EXISTS(SELECT 1 FROM folders WHERE folder_id = $1 AND name = $2 AND deleted_at IS NULL)",
 		folderID, folderName,
 	).Scan(&exists); err != nil {
 		return false, err
@@ -244,3 +239,564 @@ func (r *folderRepo) HasFolderInFolder(ctx context.Context, folderName, folderID
 
 	return exists, nil
 }
+
+// GetPath returns the folder and the folders it is nested in, the root folder first
+func (r *folderRepo) GetPath(ctx context.Context, id string) ([]*model.Folder, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`
+		WITH RECURSIVE path AS (
+			SELECT id, main_folder_id, folder_id, creator_id, storage_key, name, public, created_at, deleted_at, 0 AS depth FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id, f.main_folder_id, f.folder_id, f.creator_id, f.storage_key, f.name, f.public, f.created_at, f.deleted_at, p.depth + 1 FROM folders f JOIN path p ON f.id = p.folder_id
+		)
+		SELECT id, main_folder_id, folder_id, creator_id, storage_key, name, public, created_at, deleted_at FROM path ORDER BY depth DESC
+		`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanFolder)
+}
+
+// GetTree returns the folders nested in the folder down to depth levels, the folder itself included,
+// and the files in all of them but the deepest ones. Trashed items are left out
+func (r *folderRepo) GetTree(ctx context.Context, id string, depth int) ([]*model.File, []*model.Folder, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`
+		WITH RECURSIVE tree AS (
+			SELECT id, main_folder_id, folder_id, creator_id, storage_key, name, public, created_at, deleted_at, 0 AS depth FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id, f.main_folder_id, f.folder_id, f.creator_id, f.storage_key, f.name, f.public, f.created_at, f.deleted_at, t.depth + 1
+			FROM folders f JOIN tree t ON f.folder_id = t.id
+			WHERE t.depth < $2 AND f.deleted_at IS NULL
+		)
+		SELECT id, main_folder_id, folder_id, creator_id, storage_key, name, public, created_at, deleted_at FROM tree ORDER BY depth, lower(name)
+		`,
+		id, depth,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	folders, err := pgx.CollectRows(rows, scanFolder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Files of the deepest folders are left out like their folders
+	var folderIDs []string
+	levels := map[string]int{}
+	for _, f := range folders {
+		if f.ID != id {
+			levels[f.ID] = levels[*f.FolderID] + 1
+		}
+		if levels[f.ID] < depth {
+			folderIDs = append(folderIDs, f.ID)
+		}
+	}
+
+	rows, err = r.db.Query(
+		ctx,
+		"SELECT id, main_folder_id, folder_id, creator_id, size, version, storage_key, checksum, public, filename, download_name, date_added, deleted_at FROM files WHERE folder_id = ANY($1) AND deleted_at IS NULL ORDER BY lower(download_name)",
+		folderIDs,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	files, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.File, error) {
+		var f model.File
+		err := row.Scan(&f.ID, &f.MainFolderID, &f.FolderID, &f.CreatorID, &f.Size, &f.Version, &f.StorageKey, &f.Checksum, &f.Public, &f.Filename, &f.DownloadName, &f.DateAdded, &f.DeletedAt)
+		return &f, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return files, folders, nil
+}
+
+// GetStats sums up the sizes of the files and counts the files and folders nested in each of the folders at any depth,
+// trashed items are left out
+func (r *folderRepo) GetStats(ctx context.Context, ids []string) (map[string]*model.FolderStats, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`
+		WITH RECURSIVE closure AS (
+			SELECT id AS ancestor, id FROM folders WHERE id = ANY($1)
+			UNION ALL
+			SELECT c.ancestor, f.id FROM folders f JOIN closure c ON f.folder_id = c.id WHERE f.deleted_at IS NULL
+		)
+		SELECT c.ancestor, COALESCE(sum(fi.size), 0), count(fi.id), count(DISTINCT c.id) - 1
+		FROM closure c LEFT JOIN files fi ON fi.folder_id = c.id AND fi.deleted_at IS NULL
+		GROUP BY c.ancestor
+		`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]*model.FolderStats, len(ids))
+	for rows.Next() {
+		var id string
+		var st model.FolderStats
+		if err := rows.Scan(&id, &st.Size, &st.Files, &st.Folders); err != nil {
+			return nil, err
+		}
+		stats[id] = &st
+	}
+
+	return stats, rows.Err()
+}
+
+func scanFolder(row pgx.CollectableRow) (*model.Folder, error) {
+	var f model.Folder
+	err := row.Scan(&f.ID, &f.MainFolderID, &f.FolderID, &f.CreatorID, &f.StorageKey, &f.Name, &f.Public, &f.CreatedAt, &f.DeletedAt)
+	return &f, err
+}
+
+// GetSubtree returns every file and folder nested in the folder, the folder itself included. Folders come level by level
+// from the folder down, so every parent comes before its children
+func (r *folderRepo) GetSubtree(ctx context.Context, id string) ([]*model.File, []*model.Folder, error) {
+	folderRows, err := r.db.Query(
+		ctx,
+		`
+		WITH RECURSIVE tree AS (
+			SELECT id, main_folder_id, folder_id, creator_id, storage_key, name, public, created_at, deleted_at, 0 AS depth FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id, f.main_folder_id, f.folder_id, f.creator_id, f.storage_key, f.name, f.public, f.created_at, f.deleted_at, t.depth + 1 FROM folders f JOIN tree t ON f.folder_id = t.id
+		)
+		SELECT id, main_folder_id, folder_id, creator_id, storage_key, name, public, created_at, deleted_at FROM tree ORDER BY depth
+		`,
+		id,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer folderRows.Close()
+
+	var folders []*model.Folder
+	var folderIDs []string
+	for folderRows.Next() {
+		var f model.Folder
+		if err := folderRows.Scan(&f.ID, &f.MainFolderID, &f.FolderID, &f.CreatorID, &f.StorageKey, &f.Name, &f.Public, &f.CreatedAt, &f.DeletedAt); err != nil {
+			return nil, nil, err
+		}
+		folders = append(folders, &f)
+		folderIDs = append(folderIDs, f.ID)
+	}
+
+	if err := folderRows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	fileRows, err := r.db.Query(
+		ctx,
+		"SELECT id, main_folder_id, folder_id, creator_id, size, version, storage_key, checksum, public, filename, download_name, date_added, deleted_at FROM files WHERE folder_id = ANY($1)",
+		folderIDs,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fileRows.Close()
+
+	var files []*model.File
+	for fileRows.Next() {
+		var f model.File
+		if err := fileRows.Scan(&f.ID, &f.MainFolderID, &f.FolderID, &f.CreatorID, &f.Size, &f.Version, &f.StorageKey, &f.Checksum, &f.Public, &f.Filename, &f.DownloadName, &f.DateAdded, &f.DeletedAt); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, &f)
+	}
+
+	if err := fileRows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return files, folders, nil
+}
+
+// DeleteTree deletes the files and folders with their permissions and share links and returns the deleted permissions,
+// group permissions once for every member, and the storage keys of the blobs nothing references anymore
+func (r *folderRepo) DeleteTree(ctx context.Context, fileIDs, folderIDs []string) ([]*model.Permission, []*model.Permission, []string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	filePermissions, err := deletePermissions(ctx, tx, "DELETE FROM file_permissions WHERE file_id = ANY($1) RETURNING file_id, username, role, expires_at", fileIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fileGroupPermissions, err := deletePermissions(ctx, tx, deleteGroupPermissionsQuery("file", "resource_id = ANY($1)"), fileIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	filePermissions = append(filePermissions, fileGroupPermissions...)
+
+	orphans, err := deleteVersionRows(ctx, tx, "file_id = ANY($1)", fileIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM files WHERE id = ANY($1)", fileIDs); err != nil {
+		return nil, nil, nil, err
+	}
+
+	folderPermissions, err := deletePermissions(ctx, tx, "DELETE FROM folder_permissions WHERE folder_id = ANY($1) RETURNING folder_id, username, role, expires_at", folderIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	folderGroupPermissions, err := deletePermissions(ctx, tx, deleteGroupPermissionsQuery("folder", "resource_id = ANY($1)"), folderIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	folderPermissions = append(folderPermissions, folderGroupPermissions...)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM folders WHERE id = ANY($1)", folderIDs); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if _, err := tx.Exec(
+		ctx,
+		"DELETE FROM share_links WHERE (resource_type = 'file' AND resource_id = ANY($1)) OR (resource_type = 'folder' AND resource_id = ANY($2))",
+		fileIDs, folderIDs,
+	); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return filePermissions, folderPermissions, orphans, nil
+}
+
+func deletePermissions(ctx context.Context, tx pgx.Tx, query string, ids []string) ([]*model.Permission, error) {
+	rows, err := tx.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectPermissions(rows)
+}
+
+// treeQuery selects the IDs of the folder $1 and every folder nested in it as "tree"
+const treeQuery = `
+	WITH RECURSIVE tree AS (
+		SELECT id FROM folders WHERE id = $1
+		UNION ALL
+		SELECT f.id FROM folders f JOIN tree t ON f.folder_id = t.id
+	)
+`
+
+// Rename renames the folder and rewrites the storage keys of everything nested in it from oldKey to newKey
+func (r *folderRepo) Rename(ctx context.Context, id, newName, oldKey, newKey string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "UPDATE folders SET name = $1 WHERE id = $2", newName, id); err != nil {
+		return err
+	}
+
+	if err := rekeyTree(ctx, tx, id, oldKey, newKey); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Move saves the new location of the folder f and points everything nested in it to its new main folder.
+// The subtree loses its permissions once it becomes nested, the deleted permissions are returned
+func (r *folderRepo) Move(ctx context.Context, f model.Folder, oldKey string) ([]*model.Permission, []*model.Permission, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(
+		ctx,
+		"UPDATE folders SET folder_id = $1, main_folder_id = $2, public = $3 WHERE id = $4",
+		f.FolderID, f.MainFolderID, f.Public, f.ID,
+	); err != nil {
+		return nil, nil, err
+	}
+
+	// A folder moved to the root becomes the main folder of its subtree
+	if _, err := tx.Exec(
+		ctx,
+		treeQuery + "UPDATE folders SET main_folder_id = COALESCE($2, $1) WHERE id IN (SELECT id FROM tree) AND id <> $1",
+		f.ID, f.MainFolderID,
+	); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tx.Exec(
+		ctx,
+		treeQuery + "UPDATE files SET main_folder_id = COALESCE($2, $1) WHERE folder_id IN (SELECT id FROM tree)",
+		f.ID, f.MainFolderID,
+	); err != nil {
+		return nil, nil, err
+	}
+
+	if err := rekeyTree(ctx, tx, f.ID, oldKey, f.StorageKey); err != nil {
+		return nil, nil, err
+	}
+
+	var filePermissions, folderPermissions []*model.Permission
+	if f.MainFolderID != nil {
+		rows, err := tx.Query(ctx, treeQuery + "SELECT id FROM tree", f.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		folderIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		filePermissions, err = deletePermissions(ctx, tx, "DELETE FROM file_permissions WHERE file_id IN (SELECT id FROM files WHERE folder_id = ANY($1)) RETURNING file_id, username, role, expires_at", folderIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		fileGroupPermissions, err := deletePermissions(ctx, tx, deleteGroupPermissionsQuery("file", "resource_id IN (SELECT id FROM files WHERE folder_id = ANY($1))"), folderIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		filePermissions = append(filePermissions, fileGroupPermissions...)
+
+		folderPermissions, err = deletePermissions(ctx, tx, "DELETE FROM folder_permissions WHERE folder_id = ANY($1) RETURNING folder_id, username, role, expires_at", folderIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		folderGroupPermissions, err := deletePermissions(ctx, tx, deleteGroupPermissionsQuery("folder", "resource_id = ANY($1)"), folderIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		folderPermissions = append(folderPermissions, folderGroupPermissions...)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	return filePermissions, folderPermissions, nil
+}
+
+// underKey matches storage keys equal to $3 or nested in it, trashed items of the subtree keep their own keys
+const underKey = " AND (storage_key = $3 OR left(storage_key, length($3) + 1) = $3 || '/')"
+
+// rekeyTree rewrites the storage keys of the folder subtree and its files from oldKey to newKey
+func rekeyTree(ctx context.Context, tx pgx.Tx, id, oldKey, newKey string) error {
+	if _, err := tx.Exec(
+		ctx,
+		treeQuery + "UPDATE folders SET storage_key = $2 || substr(storage_key, length($3) + 1) WHERE id IN (SELECT id FROM tree)" + underKey,
+		id, newKey, oldKey,
+	); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(
+		ctx,
+		treeQuery + "UPDATE files SET storage_key = $2 || substr(storage_key, length($3) + 1) WHERE folder_id IN (SELECT id FROM tree)" + underKey,
+		id, newKey, oldKey,
+	)
+	return err
+}
+
+// Trash marks the folder and everything in it that is not in the trash yet as deleted
+// and rewrites their storage keys from oldKey to newKey. The permissions to the subtree are kept and returned
+func (r *folderRepo) Trash(ctx context.Context, id, oldKey, newKey string) ([]*model.Permission, []*model.Permission, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// now() is the same for the whole transaction, so the subtree shares one deleted_at
+	if _, err := tx.Exec(ctx, treeQuery + "UPDATE folders SET deleted_at = now() WHERE id IN (SELECT id FROM tree) AND deleted_at IS NULL", id); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tx.Exec(ctx, treeQuery + "UPDATE files SET deleted_at = now() WHERE folder_id IN (SELECT id FROM tree) AND deleted_at IS NULL", id); err != nil {
+		return nil, nil, err
+	}
+
+	if err := rekeyTree(ctx, tx, id, oldKey, newKey); err != nil {
+		return nil, nil, err
+	}
+
+	filePermissions, folderPermissions, err := treePermissions(ctx, tx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	return filePermissions, folderPermissions, nil
+}
+
+// Restore brings back the folder f with everything trashed together with it and rewrites their storage keys from oldKey.
+// The permissions to the subtree are returned
+func (r *folderRepo) Restore(ctx context.Context, f model.Folder, oldKey string, deletedAt time.Time) ([]*model.Permission, []*model.Permission, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "UPDATE folders SET name = $1 WHERE id = $2", f.Name, f.ID); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tx.Exec(ctx, treeQuery + "UPDATE folders SET deleted_at = NULL WHERE id IN (SELECT id FROM tree) AND deleted_at = $2", f.ID, deletedAt); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := tx.Exec(ctx, treeQuery + "UPDATE files SET deleted_at = NULL WHERE folder_id IN (SELECT id FROM tree) AND deleted_at = $2", f.ID, deletedAt); err != nil {
+		return nil, nil, err
+	}
+
+	if err := rekeyTree(ctx, tx, f.ID, oldKey, f.StorageKey); err != nil {
+		return nil, nil, err
+	}
+
+	filePermissions, folderPermissions, err := treePermissions(ctx, tx, f.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	return filePermissions, folderPermissions, nil
+}
+
+// treePermissions returns the permissions to the folder id, the folders nested in it and their files,
+// group permissions once for every member of the group
+func treePermissions(ctx context.Context, tx pgx.Tx, id string) ([]*model.Permission, []*model.Permission, error) {
+	rows, err := tx.Query(
+		ctx,
+		treeQuery + `
+		SELECT p.file_id, p.username, p.role, p.expires_at FROM file_permissions p JOIN files f ON f.id = p.file_id
+		WHERE f.folder_id IN (SELECT id FROM tree)
+		UNION ALL
+		SELECT p.resource_id, m.username, p.role, p.expires_at FROM group_permissions p
+		JOIN group_members m ON m.group_id = p.group_id JOIN files f ON f.id = p.resource_id
+		WHERE p.resource_type = 'file' AND f.folder_id IN (SELECT id FROM tree)
+		`,
+		id,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	filePermissions, err := collectPermissions(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = tx.Query(
+		ctx,
+		treeQuery + `
+		SELECT folder_id, username, role, expires_at FROM folder_permissions WHERE folder_id IN (SELECT id FROM tree)
+		UNION ALL
+		SELECT p.resource_id, m.username, p.role, p.expires_at FROM group_permissions p JOIN group_members m ON m.group_id = p.group_id
+		WHERE p.resource_type = 'folder' AND p.resource_id IN (SELECT id FROM tree)
+		`,
+		id,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	folderPermissions, err := collectPermissions(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return filePermissions, folderPermissions, nil
+}
+
+// trashRootCondition keeps trashed files and folders "f" that were not trashed together with their parent folder
+const trashRootCondition = "f.deleted_at IS NOT NULL AND NOT EXISTS(SELECT 1 FROM folders p WHERE p.id = f.folder_id AND p.deleted_at = f.deleted_at)"
+
+// FindTrashed returns the user's folders that were moved to the trash by themselves
+func (r *folderRepo) FindTrashed(ctx context.Context, userID string) ([]*model.Folder, error) {
+	return r.findTrash(ctx, "f.creator_id = $1 AND " + trashRootCondition, userID)
+}
+
+// FindExpiredTrash returns the folders that were moved to the trash by themselves before the given time
+func (r *folderRepo) FindExpiredTrash(ctx context.Context, before time.Time) ([]*model.Folder, error) {
+	return r.findTrash(ctx, "f.deleted_at < $1 AND " + trashRootCondition, before)
+}
+
+func (r *folderRepo) findTrash(ctx context.Context, condition string, arg any) ([]*model.Folder, error) {
+	rows, err := r.db.Query(
+		ctx,
+		"SELECT f.id, f.main_folder_id, f.folder_id, f.creator_id, f.storage_key, f.name, f.public, f.created_at, f.deleted_at FROM folders f WHERE " + condition + " ORDER BY f.deleted_at DESC",
+		arg,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []*model.Folder
+	for rows.Next() {
+		var f model.Folder
+		if err := rows.Scan(&f.ID, &f.MainFolderID, &f.FolderID, &f.CreatorID, &f.StorageKey, &f.Name, &f.Public, &f.CreatedAt, &f.DeletedAt); err != nil {
+			return nil, err
+		}
+		folders = append(folders, &f)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// CreateTree creates the folders and files in one transaction, parent folders must come before their children
+func (r *folderRepo) CreateTree(ctx context.Context, folders []*model.Folder, files []*model.File) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, f := range folders {
+		if _, err := tx.Exec(
+			ctx,
+			"INSERT INTO folders(id, main_folder_id, folder_id, creator_id, storage_key, name, public) VALUES($1, $2, $3, $4, $5, $6, $7)",
+			f.ID, f.MainFolderID, f.FolderID, f.CreatorID, f.StorageKey, f.Name, f.Public,
+		); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		if _, err := tx.Exec(
+			ctx,
+			createFileQuery,
+			f.ID, f.MainFolderID, f.FolderID, f.CreatorID, f.Size, f.StorageKey, f.Public, f.Filename, f.DownloadName, f.Checksum,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
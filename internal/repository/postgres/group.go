@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type groupRepo struct {
+	db *pgxpool.Pool
+}
+
+func newGroupRepo(db *pgxpool.Pool) Group {
+	return &groupRepo{db: db}
+}
+
+func (r *groupRepo) Create(ctx context.Context, g *model.Group) error {
+	return r.db.QueryRow(
+		ctx,
+		"INSERT INTO groups(id, owner_id, name) VALUES($1, $2, $3) RETURNING created_at",
+		g.ID, g.OwnerID, g.Name,
+	).Scan(&g.CreatedAt)
+}
+
+func (r *groupRepo) FindByID(ctx context.Context, id string) (*model.Group, error) {
+	var g model.Group
+	if err := r.db.QueryRow(ctx, "SELECT id, owner_id, name, created_at FROM groups WHERE id = $1", id).Scan(&g.ID, &g.OwnerID, &g.Name, &g.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return &g, nil
+}
+
+func (r *groupRepo) FindByOwner(ctx context.Context, ownerID string) ([]*model.Group, error) {
+	rows, err := r.db.Query(ctx, "SELECT id, owner_id, name, created_at FROM groups WHERE owner_id = $1 ORDER BY name", ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.Group, error) {
+		var g model.Group
+		err := row.Scan(&g.ID, &g.OwnerID, &g.Name, &g.CreatedAt)
+		return &g, err
+	})
+}
+
+// Delete deletes the group with its members and permissions
+func (r *groupRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, "DELETE FROM groups WHERE id = $1", id)
+	return err
+}
+
+// AddMember adds the user to the group, users join through an invitation unless they trust the owner of the group
+func (r *groupRepo) AddMember(ctx context.Context, id, username string) error {
+	_, err := r.db.Exec(ctx, "INSERT INTO group_members(group_id, username) VALUES($1, $2) ON CONFLICT DO NOTHING", id, username)
+	return err
+}
+
+func (r *groupRepo) DeleteMember(ctx context.Context, id, username string) error {
+	_, err := r.db.Exec(ctx, "DELETE FROM group_members WHERE group_id = $1 AND username = $2", id, username)
+	return err
+}
+
+func (r *groupRepo) FindMembers(ctx context.Context, id string) ([]string, error) {
+	rows, err := r.db.Query(ctx, "SELECT username FROM group_members WHERE group_id = $1 ORDER BY username", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// AddPermission grants the role to the group until the expiry, a group that already has a permission gets the new role and expiry
+func (r *groupRepo) AddPermission(ctx context.Context, p model.GroupPermission) error {
+	_, err := r.db.Exec(
+		ctx,
+		`
+		INSERT INTO group_permissions(resource_type, resource_id, group_id, role, expires_at) VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (resource_type, resource_id, group_id) DO UPDATE SET role = EXCLUDED.role, expires_at = EXCLUDED.expires_at
+		`,
+		p.ResourceType, p.ResourceID, p.GroupID, p.Role, p.ExpiresAt,
+	)
+	return err
+}
+
+func (r *groupRepo) DeletePermission(ctx context.Context, resourceType, resourceID, groupID string) error {
+	_, err := r.db.Exec(ctx, "DELETE FROM group_permissions WHERE resource_type = $1 AND resource_id = $2 AND group_id = $3", resourceType, resourceID, groupID)
+	return err
+}
+
+// FindPermissions returns the groups the file or folder is shared with, expired permissions are left out
+func (r *groupRepo) FindPermissions(ctx context.Context, resourceType, resourceID string) ([]*model.GroupPermission, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`
+		SELECT p.resource_type, p.resource_id, p.group_id, g.name, p.role, p.expires_at
+		FROM group_permissions p JOIN groups g ON g.id = p.group_id
+		WHERE p.resource_type = $1 AND p.resource_id = $2 AND (p.expires_at IS NULL OR p.expires_at > now())
+		ORDER BY g.name
+		`,
+		resourceType, resourceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanGroupPermission)
+}
+
+// FindGroupPermissions returns everything shared with the group
+func (r *groupRepo) FindGroupPermissions(ctx context.Context, groupID string) ([]*model.GroupPermission, error) {
+	rows, err := r.db.Query(
+		ctx,
+		"SELECT p.resource_type, p.resource_id, p.group_id, g.name, p.role, p.expires_at FROM group_permissions p JOIN groups g ON g.id = p.group_id WHERE p.group_id = $1",
+		groupID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanGroupPermission)
+}
+
+// DeleteExpiredPermissions deletes the group permissions that expired before now and returns them
+func (r *groupRepo) DeleteExpiredPermissions(ctx context.Context, now time.Time) ([]*model.GroupPermission, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`
+		WITH d AS (DELETE FROM group_permissions WHERE expires_at <= $1 RETURNING resource_type, resource_id, group_id, role, expires_at)
+		SELECT d.resource_type, d.resource_id, d.group_id, g.name, d.role, d.expires_at FROM d JOIN groups g ON g.id = d.group_id
+		`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanGroupPermission)
+}
+
+func scanGroupPermission(row pgx.CollectableRow) (*model.GroupPermission, error) {
+	var p model.GroupPermission
+	err := row.Scan(&p.ResourceType, &p.ResourceID, &p.GroupID, &p.GroupName, &p.Role, &p.ExpiresAt)
+	return &p, err
+}
+
+// deleteGroupPermissionsQuery deletes the group permissions to the files or folders matching the condition and returns them
+// once for every member of the group, so their caches can be cleared like the ones of direct permissions
+func deleteGroupPermissionsQuery(resourceType, condition string) string {
+	return `
+		WITH d AS (DELETE FROM group_permissions WHERE resource_type = '` + resourceType + `' AND ` + condition + ` RETURNING resource_id, group_id, role, expires_at)
+		SELECT d.resource_id, m.username, d.role, d.expires_at FROM d JOIN group_members m ON m.group_id = d.group_id
+		`
+}
+
+// roleQuery selects the highest role the user $2 was granted in the root file or folder $1, directly or through a group,
+// with the earliest expiry of the grants as the role may change then
+func roleQuery(resourceType string) string {
+	table, idColumn, resourceTable := "file_permissions", "file_id", "files"
+	if resourceType == "folder" {
+		table, idColumn, resourceTable = "folder_permissions", "folder_id", "folders"
+	}
+
+	return `
+		SELECT role, min(expires_at) OVER () FROM (
+			SELECT role, expires_at FROM ` + table + ` WHERE ` + idColumn + ` = $1 AND username = $2
+			UNION ALL
+			SELECT p.role, p.expires_at FROM group_permissions p JOIN group_members m ON m.group_id = p.group_id
+			WHERE p.resource_type = '` + resourceType + `' AND p.resource_id = $1 AND m.username = $2
+		) grants
+		WHERE (expires_at IS NULL OR expires_at > now()) AND EXISTS(SELECT 1 FROM ` + resourceTable + ` WHERE id = $1 AND main_folder_id IS NULL)
+		ORDER BY array_position(ARRAY['viewer', 'editor', 'manager'], role) DESC
+		LIMIT 1
+		`
+}
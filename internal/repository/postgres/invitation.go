@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type invitationRepo struct {
+	db *pgxpool.Pool
+}
+
+func newInvitationRepo(db *pgxpool.Pool) Invitation {
+	return &invitationRepo{db: db}
+}
+
+// Create saves a pending invitation, a pending invitation of the user to the same file, folder or group gets the new role
+// and expiry instead. It reports whether a new invitation was inserted
+func (r *invitationRepo) Create(ctx context.Context, inv *model.Invitation) (bool, error) {
+	var inserted bool
+	err := r.db.QueryRow(
+		ctx,
+		`
+		INSERT INTO invitations(id, resource_type, resource_id, inviter_id, inviter_name, invitee, role, expires_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (resource_type, resource_id, invitee) WHERE status = 'pending' DO UPDATE
+		SET inviter_id = EXCLUDED.inviter_id, inviter_name = EXCLUDED.inviter_name, role = EXCLUDED.role, expires_at = EXCLUDED.expires_at, created_at = now()
+		RETURNING id, status, created_at, xmax = 0
+		`,
+		inv.ID, inv.ResourceType, inv.ResourceID, inv.InviterID, inv.InviterName, inv.Invitee, inv.Role, inv.ExpiresAt,
+	).Scan(&inv.ID, &inv.Status, &inv.CreatedAt, &inserted)
+	return inserted, err
+}
+
+// FindPending returns the pending invitations of the user to files, folders and groups that still exist, newest first
+func (r *invitationRepo) FindPending(ctx context.Context, invitee string) ([]*model.Invitation, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`
+		SELECT i.id, i.resource_type, i.resource_id, COALESCE(f.download_name, d.name, g.name), i.inviter_id, i.inviter_name, i.invitee, i.role, i.expires_at, i.status, i.created_at, i.responded_at
+		FROM invitations i
+		LEFT JOIN files f ON i.resource_type = 'file' AND f.id = i.resource_id AND f.main_folder_id IS NULL AND f.deleted_at IS NULL
+		LEFT JOIN folders d ON i.resource_type = 'folder' AND d.id = i.resource_id AND d.main_folder_id IS NULL AND d.deleted_at IS NULL
+		LEFT JOIN groups g ON i.resource_type = 'group' AND g.id = i.resource_id
+		WHERE i.invitee = $1 AND i.status = 'pending' AND (i.expires_at IS NULL OR i.expires_at > now()) AND (f.id IS NOT NULL OR d.id IS NOT NULL OR g.id IS NOT NULL)
+		ORDER BY i.created_at DESC
+		`,
+		invitee,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.Invitation, error) {
+		var i model.Invitation
+		err := row.Scan(&i.ID, &i.ResourceType, &i.ResourceID, &i.ResourceName, &i.InviterID, &i.InviterName, &i.Invitee, &i.Role, &i.ExpiresAt, &i.Status, &i.CreatedAt, &i.RespondedAt)
+		return &i, err
+	})
+}
+
+// Accept marks the pending invitation of the user accepted and grants its permission or adds the user to its group, pgx.ErrNoRows
+// is returned if there is no such invitation, its permission already expired or the file, folder or group is gone or the item nested now
+func (r *invitationRepo) Accept(ctx context.Context, id, invitee string) (*model.Invitation, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var i model.Invitation
+	if err := tx.QueryRow(
+		ctx,
+		`
+		UPDATE invitations SET status = 'accepted', responded_at = now()
+		WHERE id = $1 AND invitee = $2 AND status = 'pending' AND (expires_at IS NULL OR expires_at > now())
+		RETURNING id, resource_type, resource_id, inviter_id, inviter_name, invitee, role, expires_at, status, created_at, responded_at
+		`,
+		id, invitee,
+	).Scan(&i.ID, &i.ResourceType, &i.ResourceID, &i.InviterID, &i.InviterName, &i.Invitee, &i.Role, &i.ExpiresAt, &i.Status, &i.CreatedAt, &i.RespondedAt); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO file_permissions(file_id, username, role, expires_at)
+		SELECT $1, $2, $3, $4 WHERE EXISTS(SELECT 1 FROM files WHERE id = $1 AND main_folder_id IS NULL AND deleted_at IS NULL)
+		ON CONFLICT (file_id, username) DO UPDATE SET role = EXCLUDED.role, expires_at = EXCLUDED.expires_at
+		`
+	args := []any{i.ResourceID, i.Invitee, i.Role, i.ExpiresAt}
+	switch i.ResourceType {
+	case "folder":
+		query = `
+		INSERT INTO folder_permissions(folder_id, username, role, expires_at)
+		SELECT $1, $2, $3, $4 WHERE EXISTS(SELECT 1 FROM folders WHERE id = $1 AND main_folder_id IS NULL AND deleted_at IS NULL)
+		ON CONFLICT (folder_id, username) DO UPDATE SET role = EXCLUDED.role, expires_at = EXCLUDED.expires_at
+		`
+	case "group":
+		// A user who joined in the meantime stays a member
+		query = `
+		INSERT INTO group_members(group_id, username)
+		SELECT $1, $2 WHERE EXISTS(SELECT 1 FROM groups WHERE id = $1)
+		ON CONFLICT (group_id, username) DO UPDATE SET added_at = group_members.added_at
+		`
+		args = args[:2]
+	}
+
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, pgx.ErrNoRows
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+// Decline marks the pending invitation of the user declined, pgx.ErrNoRows is returned if there is no such invitation
+func (r *invitationRepo) Decline(ctx context.Context, id, invitee string) error {
+	tag, err := r.db.Exec(ctx, "UPDATE invitations SET status = 'declined', responded_at = now() WHERE id = $1 AND invitee = $2 AND status = 'pending'", id, invitee)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeletePending withdraws the pending invitation of the user to the file or folder
+func (r *invitationRepo) DeletePending(ctx context.Context, resourceType, resourceID, invitee string) error {
+	_, err := r.db.Exec(ctx, "DELETE FROM invitations WHERE resource_type = $1 AND resource_id = $2 AND invitee = $3 AND status = 'pending'", resourceType, resourceID, invitee)
+	return err
+}
+
+// Granted reports whether the user already has a permission to the file or folder that has not expired or is a member of the group
+func (r *invitationRepo) Granted(ctx context.Context, resourceType, resourceID, username string) (bool, error) {
+	query := "SELECT EXISTS(SELECT 1 FROM file_permissions WHERE file_id = $1 AND username = $2 AND (expires_at IS NULL OR expires_at > now()))"
+	switch resourceType {
+	case "folder":
+		query = "SELECT EXISTS(SELECT 1 FROM folder_permissions WHERE folder_id = $1 AND username = $2 AND (expires_at IS NULL OR expires_at > now()))"
+	case "group":
+		query = "SELECT EXISTS(SELECT 1 FROM group_members WHERE group_id = $1 AND username = $2)"
+	}
+
+	var granted bool
+	err := r.db.QueryRow(ctx, query, resourceID, username).Scan(&granted)
+	return granted, err
+}
+
+func (r *invitationRepo) IsTrusted(ctx context.Context, username, trustedUsername string) (bool, error) {
+	var trusted bool
+	err := r.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM trusted_users WHERE username = $1 AND trusted_username = $2)", username, trustedUsername).Scan(&trusted)
+	return trusted, err
+}
+
+func (r *invitationRepo) Trust(ctx context.Context, username, trustedUsername string) error {
+	_, err := r.db.Exec(ctx, "INSERT INTO trusted_users(username, trusted_username) VALUES($1, $2) ON CONFLICT DO NOTHING", username, trustedUsername)
+	return err
+}
+
+func (r *invitationRepo) Distrust(ctx context.Context, username, trustedUsername string) error {
+	_, err := r.db.Exec(ctx, "DELETE FROM trusted_users WHERE username = $1 AND trusted_username = $2", username, trustedUsername)
+	return err
+}
+
+func (r *invitationRepo) FindTrusted(ctx context.Context, username string) ([]string, error) {
+	rows, err := r.db.Query(ctx, "SELECT trusted_username FROM trusted_users WHERE username = $1 ORDER BY trusted_username", username)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
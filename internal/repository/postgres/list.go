@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Listed files and folders share the columns of the listing, folders have no size and come first
+const (
+	listFilesQuery = `SELECT 1 AS kind, id, main_folder_id, folder_id, creator_id, storage_key, download_name AS name, size, version, checksum, public, filename, date_added AS date, ARRAY(SELECT t.tag FROM file_tags t WHERE t.file_id = files.id ORDER BY t.tag) AS tags FROM files`
+	listFoldersQuery = `SELECT 0 AS kind, id, main_folder_id, folder_id, creator_id, storage_key, name, 0::bigint AS size, 0 AS version, NULL::text AS checksum, public, NULL::text AS filename, created_at AS date, ARRAY(SELECT t.tag FROM folder_tags t WHERE t.folder_id = folders.id ORDER BY t.tag) AS tags FROM folders`
+)
+
+// listSortColumns maps the sort options to the columns of a listing and the types their cursor values are cast to,
+// the service checks that cursor values parse as these types
+var listSortColumns = map[string][2]string{
+	"name": {"lower(name)", "text"},
+	"size": {"size", "bigint"},
+	"date": {"date", "timestamp"},
+}
+
+// list returns a page of the items of the query, listFilesQuery or listFoldersQuery with conditions or a union of both,
+// and where the next page starts if there is one
+func list(ctx context.Context, db *pgxpool.Pool, items string, args []any, q model.ListQuery) ([]*model.File, []*model.Folder, *model.ListCursor, error) {
+	column, cast := listSortColumns[q.Sort][0], listSortColumns[q.Sort][1]
+
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	var where []string
+	if q.Ext != "" {
+		ext := arg(strings.ToLower(q.Ext))
+		where = append(where, fmt.Sprintf("kind = 1 AND right(lower(name), length(%s)) = %s", ext, ext))
+	}
+	if q.MinSize != nil {
+		where = append(where, "kind = 1 AND size >= " + arg(*q.MinSize))
+	}
+	if q.MaxSize != nil {
+		where = append(where, "kind = 1 AND size <= " + arg(*q.MaxSize))
+	}
+	if q.From != nil {
+		where = append(where, "date >= " + arg(*q.From))
+	}
+	if q.To != nil {
+		where = append(where, "date <= " + arg(*q.To))
+	}
+	if q.Public != nil {
+		where = append(where, "public = " + arg(*q.Public))
+	}
+	if q.Tag != "" {
+		where = append(where, "tags @> ARRAY[" + arg(q.Tag) + "::text]")
+	}
+
+	order, cmp := "ASC", ">"
+	if q.Desc {
+		order, cmp = "DESC", "<"
+	}
+
+	// Folders come first whatever the order, so the kind is compared on its own
+	if q.After != nil {
+		kind := arg(q.After.Kind)
+		where = append(where, fmt.Sprintf("(kind > %s OR (kind = %s AND (%s, id) %s (%s::%s, %s)))", kind, kind, column, cmp, arg(q.After.Value), cast, arg(q.After.ID)))
+	}
+
+	query := "SELECT kind, id, main_folder_id, folder_id, creator_id, storage_key, name, size, version, checksum, public, filename, date, tags, (" + column + ")::text FROM (" + items + ") items"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// One more item than asked for tells whether there is a next page
+	query += fmt.Sprintf(" ORDER BY kind, %s %s, id %s LIMIT %s", column, order, order, arg(q.Limit + 1))
+
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	files := []*model.File{}
+	folders := []*model.Folder{}
+	var next *model.ListCursor
+	var last model.ListCursor
+	for n := 0; rows.Next(); n++ {
+		if n == q.Limit {
+			next = &last
+			break
+		}
+
+		var (
+			kind int
+			id, creatorID, storageKey, name, value string
+			mainFolderID, folderID, checksum, filename *string
+			size int64
+			version int
+			public *bool
+			date time.Time
+			tags []string
+		)
+		if err := rows.Scan(&kind, &id, &mainFolderID, &folderID, &creatorID, &storageKey, &name, &size, &version, &checksum, &public, &filename, &date, &tags, &value); err != nil {
+			return nil, nil, nil, err
+		}
+		last = model.ListCursor{Sort: q.Sort, Desc: q.Desc, Kind: kind, Value: value, ID: id}
+
+		if kind == 0 {
+			folders = append(folders, &model.Folder{
+				ID: id,
+				MainFolderID: mainFolderID,
+				FolderID: folderID,
+				CreatorID: creatorID,
+				StorageKey: storageKey,
+				Name: name,
+				Public: public,
+				CreatedAt: date,
+				Tags: tags,
+			})
+			continue
+		}
+
+		files = append(files, &model.File{
+			ID: id,
+			MainFolderID: mainFolderID,
+			FolderID: folderID,
+			CreatorID: creatorID,
+			Size: size,
+			Version: version,
+			StorageKey: storageKey,
+			Checksum: checksum,
+			Public: public,
+			Filename: filename,
+			DownloadName: name,
+			DateAdded: date,
+			Tags: tags,
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return files, folders, next, nil
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"time"
 
 	"github.com/File-Sharer/file-service/internal/model"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -19,34 +20,134 @@ type UserSpace interface {
 type Folder interface {
 	Create(ctx context.Context, f model.Folder) error
 	FindByID(ctx context.Context, id string) (*model.Folder, error)
-	HasPermission(ctx context.Context, id, username string) (bool, error)
+	GetRole(ctx context.Context, id, username string) (string, *time.Time, error)
 	Update(ctx context.Context, id string, fields map[string]interface{}) error
-	GetFolderContents(ctx context.Context, id string) ([]*model.File, []*model.Folder, error)
-	GetUserFolders(ctx context.Context, userID string) ([]*model.Folder, error)
-	AddPermission(ctx context.Context, folderID, username string) error
+	GetFolderContents(ctx context.Context, id string, q model.ListQuery) ([]*model.File, []*model.Folder, *model.ListCursor, error)
+	GetUserFolders(ctx context.Context, userID string, q model.ListQuery) ([]*model.Folder, *model.ListCursor, error)
+	AddPermission(ctx context.Context, folderID, username, role string, expiresAt *time.Time) error
+	DeleteExpiredPermissions(ctx context.Context, now time.Time) ([]*model.Permission, error)
 	DeletePermission(ctx context.Context, folderID, username string) error
-	GetPermissions(ctx context.Context, folderID, creatorID string) ([]*string, error)
+	TogglePublic(ctx context.Context, id, creatorID string) ([]*model.Permission, error)
+	GetPermissions(ctx context.Context, folderID string) ([]*model.Permission, error)
 	HasFile(ctx context.Context, folderID, filename string) (bool, error)
 	HasFolder(ctx context.Context, userID, folderName string) (bool, error)
 	HasFolderInFolder(ctx context.Context, folderName, folderID string) (bool, error)
+	GetSubtree(ctx context.Context, id string) ([]*model.File, []*model.Folder, error)
+	GetPath(ctx context.Context, id string) ([]*model.Folder, error)
+	GetTree(ctx context.Context, id string, depth int) ([]*model.File, []*model.Folder, error)
+	GetStats(ctx context.Context, ids []string) (map[string]*model.FolderStats, error)
+	DeleteTree(ctx context.Context, fileIDs, folderIDs []string) ([]*model.Permission, []*model.Permission, []string, error)
+	Rename(ctx context.Context, id, newName, oldKey, newKey string) error
+	Move(ctx context.Context, f model.Folder, oldKey string) ([]*model.Permission, []*model.Permission, error)
+	CreateTree(ctx context.Context, folders []*model.Folder, files []*model.File) error
+	Trash(ctx context.Context, id, oldKey, newKey string) ([]*model.Permission, []*model.Permission, error)
+	Restore(ctx context.Context, f model.Folder, oldKey string, deletedAt time.Time) ([]*model.Permission, []*model.Permission, error)
+	FindTrashed(ctx context.Context, userID string) ([]*model.Folder, error)
+	FindExpiredTrash(ctx context.Context, before time.Time) ([]*model.Folder, error)
 }
 
 type File interface {
 	Create(ctx context.Context, file *model.File) error
 	FindByID(ctx context.Context, id string) (*model.File, error)
-	FindUserFiles(ctx context.Context, userID string) ([]*model.File, error)
-	AddPermission(ctx context.Context, fileID, username string) error
-	HasPermission(ctx context.Context, fileID, username string) (bool, error)
+	FindUserFiles(ctx context.Context, userID string, q model.ListQuery) ([]*model.File, *model.ListCursor, error)
+	AddPermission(ctx context.Context, fileID, username, role string, expiresAt *time.Time) error
+	GetRole(ctx context.Context, fileID, username string) (string, *time.Time, error)
+	DeleteExpiredPermissions(ctx context.Context, now time.Time) ([]*model.Permission, error)
 	DeletePermission(ctx context.Context, fileID, username string) error
-	Delete(ctx context.Context, id string) error
-	FindPermissionsToFile(ctx context.Context, id, creatorID string) ([]*string, error)
+	Delete(ctx context.Context, id string) ([]string, error)
+	FindPermissionsToFile(ctx context.Context, id string) ([]*model.Permission, error)
 	TogglePublic(ctx context.Context, id, creatorID string) error
+	Move(ctx context.Context, file *model.File) ([]*model.Permission, error)
+	Trash(ctx context.Context, id, storageKey string) error
+	Restore(ctx context.Context, file *model.File) error
+	FindTrashed(ctx context.Context, userID string) ([]*model.File, error)
+	FindExpiredTrash(ctx context.Context, before time.Time) ([]*model.File, error)
+	AddVersion(ctx context.Context, fileID, archiveKey string, blob model.Blob) (int, error)
+	FindVersions(ctx context.Context, fileID string) ([]*model.FileVersion, error)
+	FindExpiredVersions(ctx context.Context, before time.Time) ([]*model.FileVersion, error)
+	FindVersion(ctx context.Context, fileID string, version int) (*model.FileVersion, error)
+	DeleteVersions(ctx context.Context, fileID string, versions []int) ([]string, error)
+	FindInFolder(ctx context.Context, creatorID string, folderID *string, downloadName string) (string, error)
+}
+
+type UploadSession interface {
+	Create(ctx context.Context, s model.UploadSession) error
+	FindByID(ctx context.Context, id string) (*model.UploadSession, error)
+	UpdateOffset(ctx context.Context, id string, offset int64, expiresAt time.Time) error
+	Delete(ctx context.Context, id string) error
+	FindExpired(ctx context.Context, now time.Time) ([]*model.UploadSession, error)
+}
+
+type Blob interface {
+	Acquire(ctx context.Context, hash string) (*model.Blob, error)
+	Create(ctx context.Context, blob model.Blob) (*model.Blob, error)
+	Release(ctx context.Context, hashes []string) ([]string, error)
+}
+
+type ShareLink interface {
+	Create(ctx context.Context, link *model.ShareLink) error
+	FindByID(ctx context.Context, id string) (*model.ShareLink, error)
+	FindByResource(ctx context.Context, resourceType, resourceID string) ([]*model.ShareLink, error)
+	CountDownload(ctx context.Context, id string, now time.Time) error
+	Delete(ctx context.Context, id string) error
+}
+
+type Shared interface {
+	Find(ctx context.Context, username, sort string, desc bool, limit, offset int) ([]*model.SharedItem, int, error)
+}
+
+type Group interface {
+	Create(ctx context.Context, g *model.Group) error
+	FindByID(ctx context.Context, id string) (*model.Group, error)
+	FindByOwner(ctx context.Context, ownerID string) ([]*model.Group, error)
+	Delete(ctx context.Context, id string) error
+	AddMember(ctx context.Context, id, username string) error
+	DeleteMember(ctx context.Context, id, username string) error
+	FindMembers(ctx context.Context, id string) ([]string, error)
+	AddPermission(ctx context.Context, p model.GroupPermission) error
+	DeletePermission(ctx context.Context, resourceType, resourceID, groupID string) error
+	FindPermissions(ctx context.Context, resourceType, resourceID string) ([]*model.GroupPermission, error)
+	FindGroupPermissions(ctx context.Context, groupID string) ([]*model.GroupPermission, error)
+	DeleteExpiredPermissions(ctx context.Context, now time.Time) ([]*model.GroupPermission, error)
+}
+
+type Invitation interface {
+	Create(ctx context.Context, inv *model.Invitation) (bool, error)
+	FindPending(ctx context.Context, invitee string) ([]*model.Invitation, error)
+	Accept(ctx context.Context, id, invitee string) (*model.Invitation, error)
+	Decline(ctx context.Context, id, invitee string) error
+	DeletePending(ctx context.Context, resourceType, resourceID, invitee string) error
+	Granted(ctx context.Context, resourceType, resourceID, username string) (bool, error)
+	IsTrusted(ctx context.Context, username, trustedUsername string) (bool, error)
+	Trust(ctx context.Context, username, trustedUsername string) error
+	Distrust(ctx context.Context, username, trustedUsername string) error
+	FindTrusted(ctx context.Context, username string) ([]string, error)
+}
+
+type Search interface {
+	Find(ctx context.Context, userID, username, text, resourceType string, limit, offset int) ([]*model.SearchHit, int, error)
+}
+
+type Tag interface {
+	AddTag(ctx context.Context, resourceType, resourceID, tag string, maxTags int) (bool, error)
+	DeleteTag(ctx context.Context, resourceType, resourceID, tag string) error
+	FindMetadata(ctx context.Context, resourceType, resourceID string) (map[string]string, error)
+	SetMetadata(ctx context.Context, resourceType, resourceID, key, value string, maxKeys int) error
+	DeleteMetadata(ctx context.Context, resourceType, resourceID, key string) error
 }
 
 type PostgresRepository struct {
 	UserSpace
 	Folder
 	File
+	UploadSession
+	Blob
+	ShareLink
+	Shared
+	Group
+	Invitation
+	Search
+	Tag
 }
 
 func NewPostgresRepo(db *pgxpool.Pool) *PostgresRepository {
@@ -54,5 +155,13 @@ func NewPostgresRepo(db *pgxpool.Pool) *PostgresRepository {
 		UserSpace: newUserSpaceRepo(db),
 		Folder: newFolderRepo(db),
 		File: newFileRepo(db),
+		UploadSession: newUploadSessionRepo(db),
+		Blob: newBlobRepo(db),
+		ShareLink: newShareLinkRepo(db),
+		Shared: newSharedRepo(db),
+		Group: newGroupRepo(db),
+		Invitation: newInvitationRepo(db),
+		Search: newSearchRepo(db),
+		Tag: newTagRepo(db),
 	}
 }
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type searchRepo struct {
+	db *pgxpool.Pool
+}
+
+func newSearchRepo(db *pgxpool.Pool) Search {
+	return &searchRepo{db: db}
+}
+
+// searchQuery selects the files and folders not in the trash whose names match the pattern $3 or the words $4 that the user $1 named $2 can view:
+// their own, public ones and ones shared with them, directly or through a group. Nested items are viewable through their root folder.
+// Best matches come first, every hit with the path of the folders it is in and the number of all hits
+const searchQuery = `
+	WITH grants AS (
+		SELECT 'file' AS type, file_id AS id FROM file_permissions WHERE username = $2 AND (expires_at IS NULL OR expires_at > now())
+		UNION
+		SELECT 'folder', folder_id FROM folder_permissions WHERE username = $2 AND (expires_at IS NULL OR expires_at > now())
+		UNION
+		SELECT p.resource_type, p.resource_id
+		FROM group_permissions p JOIN group_members m ON m.group_id = p.group_id
+		WHERE m.username = $2 AND (p.expires_at IS NULL OR p.expires_at > now())
+	), hits AS (
+		SELECT 'file' AS type, f.id, f.download_name AS name, f.folder_id, f.creator_id, f.size, f.date_added AS created_at
+		FROM files f
+		LEFT JOIN folders r ON r.id = f.main_folder_id
+		WHERE f.deleted_at IS NULL
+		AND (lower(f.download_name) LIKE $3 OR to_tsvector('simple', f.download_name) @@ plainto_tsquery('simple', $4))
+		AND (
+			f.creator_id = $1
+			OR (f.main_folder_id IS NULL AND (f.public IS TRUE OR EXISTS(SELECT 1 FROM grants g WHERE g.type = 'file' AND g.id = f.id)))
+			OR (f.main_folder_id IS NOT NULL AND (r.public IS TRUE OR EXISTS(SELECT 1 FROM grants g WHERE g.type = 'folder' AND g.id = f.main_folder_id)))
+		)
+		UNION ALL
+		SELECT 'folder', d.id, d.name, d.folder_id, d.creator_id, NULL, d.created_at
+		FROM folders d
+		LEFT JOIN folders r ON r.id = d.main_folder_id
+		WHERE d.deleted_at IS NULL
+		AND (lower(d.name) LIKE $3 OR to_tsvector('simple', d.name) @@ plainto_tsquery('simple', $4))
+		AND (
+			d.creator_id = $1
+			OR EXISTS(SELECT 1 FROM grants g WHERE g.type = 'folder' AND g.id = COALESCE(d.main_folder_id, d.id))
+			OR COALESCE(r.public, d.public) IS TRUE
+		)
+	)
+	SELECT h.type, h.id, h.name, h.folder_id, COALESCE(p.path, ''), h.creator_id, h.size, h.created_at, count(*) OVER ()
+	FROM hits h
+	LEFT JOIN LATERAL (
+		WITH RECURSIVE up AS (
+			SELECT id, folder_id, name, 1 AS depth FROM folders WHERE id = h.folder_id
+			UNION ALL
+			SELECT f.id, f.folder_id, f.name, up.depth + 1 FROM folders f JOIN up ON f.id = up.folder_id
+		)
+		SELECT string_agg(name, '/' ORDER BY depth DESC) AS path FROM up
+	) p ON true
+	WHERE $5 = '' OR h.type = $5
+	ORDER BY similarity(lower(h.name), lower($4)) DESC, lower(h.name), h.id
+	LIMIT $6 OFFSET $7
+	`
+
+// Find returns a page of the files and folders of resourceType, or of both if it is empty, matching the text and the number of all of them
+func (r *searchRepo) Find(ctx context.Context, userID, username, text, resourceType string, limit, offset int) ([]*model.SearchHit, int, error) {
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(text)) + "%"
+
+	rows, err := r.db.Query(ctx, searchQuery, userID, username, pattern, text, resourceType, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	hits := []*model.SearchHit{}
+	total := 0
+	for rows.Next() {
+		var h model.SearchHit
+		if err := rows.Scan(&h.Type, &h.ID, &h.Name, &h.FolderID, &h.Path, &h.OwnerID, &h.Size, &h.CreatedAt, &total); err != nil {
+			return nil, 0, err
+		}
+		hits = append(hits, &h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return hits, total, nil
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type shareLinkRepo struct {
+	db *pgxpool.Pool
+}
+
+func newShareLinkRepo(db *pgxpool.Pool) ShareLink {
+	return &shareLinkRepo{db: db}
+}
+
+func (r *shareLinkRepo) Create(ctx context.Context, link *model.ShareLink) error {
+	return r.db.QueryRow(
+		ctx,
+		"INSERT INTO share_links(id, resource_type, resource_id, creator_id, password_hash, expires_at, max_downloads) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING created_at",
+		link.ID, link.ResourceType, link.ResourceID, link.CreatorID, link.PasswordHash, link.ExpiresAt, link.MaxDownloads,
+	).Scan(&link.CreatedAt)
+}
+
+func (r *shareLinkRepo) FindByID(ctx context.Context, id string) (*model.ShareLink, error) {
+	rows, err := r.db.Query(ctx, "SELECT id, resource_type, resource_id, creator_id, password_hash, expires_at, max_downloads, downloads, created_at FROM share_links WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectOneRow(rows, scanShareLink)
+}
+
+// FindByResource returns the links to the file or folder, newest first
+func (r *shareLinkRepo) FindByResource(ctx context.Context, resourceType, resourceID string) ([]*model.ShareLink, error) {
+	rows, err := r.db.Query(
+		ctx,
+		"SELECT id, resource_type, resource_id, creator_id, password_hash, expires_at, max_downloads, downloads, created_at FROM share_links WHERE resource_type = $1 AND resource_id = $2 ORDER BY created_at DESC",
+		resourceType, resourceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanShareLink)
+}
+
+// CountDownload counts a download of the link, pgx.ErrNoRows is returned if the link has expired or ran out of downloads
+func (r *shareLinkRepo) CountDownload(ctx context.Context, id string, now time.Time) error {
+	var downloads int
+	return r.db.QueryRow(
+		ctx,
+		`
+		UPDATE share_links SET downloads = downloads + 1
+		WHERE id = $1 AND (expires_at IS NULL OR expires_at > $2) AND (max_downloads IS NULL OR downloads < max_downloads)
+		RETURNING downloads
+		`,
+		id, now,
+	).Scan(&downloads)
+}
+
+func (r *shareLinkRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, "DELETE FROM share_links WHERE id = $1", id)
+	return err
+}
+
+func scanShareLink(row pgx.CollectableRow) (*model.ShareLink, error) {
+	var l model.ShareLink
+	if err := row.Scan(&l.ID, &l.ResourceType, &l.ResourceID, &l.CreatorID, &l.PasswordHash, &l.ExpiresAt, &l.MaxDownloads, &l.Downloads, &l.CreatedAt); err != nil {
+		return nil, err
+	}
+	l.HasPassword = l.PasswordHash != nil
+
+	return &l, nil
+}
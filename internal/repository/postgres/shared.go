@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type sharedRepo struct {
+	db *pgxpool.Pool
+}
+
+func newSharedRepo(db *pgxpool.Pool) Shared {
+	return &sharedRepo{db: db}
+}
+
+// sharedQuery selects the files and root folders shared with the user $1, directly or through a group, that are not in the trash as "shared".
+// An item shared more than once comes with the highest role, expired permissions and items of the user are left out
+const sharedQuery = `
+	WITH grants AS (
+		SELECT 'file' AS type, file_id AS id, role, created_at, expires_at FROM file_permissions WHERE username = $1
+		UNION ALL
+		SELECT 'folder', folder_id, role, created_at, expires_at FROM folder_permissions WHERE username = $1
+		UNION ALL
+		SELECT p.resource_type, p.resource_id, p.role, p.created_at, p.expires_at
+		FROM group_permissions p JOIN group_members m ON m.group_id = p.group_id
+		WHERE m.username = $1
+	), best AS (
+		SELECT DISTINCT ON (type, id) type, id, role, created_at, expires_at FROM grants
+		WHERE expires_at IS NULL OR expires_at > now()
+		ORDER BY type, id, array_position(ARRAY['viewer', 'editor', 'manager'], role) DESC, created_at
+	), shared AS (
+		SELECT 'file' AS type, f.id, f.download_name AS name, f.size, f.creator_id AS owner_id, COALESCE(s.username, '') AS owner_name, g.role, g.created_at AS shared_at, g.expires_at, f.date_added AS created_at
+		FROM best g
+		JOIN files f ON g.type = 'file' AND f.id = g.id
+		LEFT JOIN users_spaces s ON s.user_id = f.creator_id
+		WHERE f.main_folder_id IS NULL AND f.deleted_at IS NULL AND s.username IS DISTINCT FROM $1
+		UNION ALL
+		SELECT 'folder', d.id, d.name, NULL, d.creator_id, COALESCE(s.username, ''), g.role, g.created_at, g.expires_at, d.created_at
+		FROM best g
+		JOIN folders d ON g.type = 'folder' AND d.id = g.id
+		LEFT JOIN users_spaces s ON s.user_id = d.creator_id
+		WHERE d.main_folder_id IS NULL AND d.deleted_at IS NULL AND s.username IS DISTINCT FROM $1
+	)
+	`
+
+// sharedSortColumns maps the sort options to the columns of sharedQuery, roles sort by rank rather than by name
+var sharedSortColumns = map[string]string{
+	"name": "lower(name)",
+	"owner": "lower(owner_name)",
+	"role": "array_position(ARRAY['viewer', 'editor', 'manager'], role)",
+	"sharedAt": "shared_at",
+	"createdAt": "created_at",
+}
+
+// Find returns a page of the items shared with the user sorted by sort, one of the keys of sharedSortColumns, and the number of all of them
+func (r *sharedRepo) Find(ctx context.Context, username, sort string, desc bool, limit, offset int) ([]*model.SharedItem, int, error) {
+	var total int
+	if err := r.db.QueryRow(ctx, sharedQuery + "SELECT count(*) FROM shared", username).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order := " ASC"
+	if desc {
+		order = " DESC"
+	}
+
+	rows, err := r.db.Query(
+		ctx,
+		sharedQuery + "SELECT type, id, name, size, owner_id, owner_name, role, shared_at, expires_at, created_at FROM shared ORDER BY " + sharedSortColumns[sort] + order + ", id LIMIT $2 OFFSET $3",
+		username, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	items := []*model.SharedItem{}
+	for rows.Next() {
+		var i model.SharedItem
+		if err := rows.Scan(&i.Type, &i.ID, &i.Name, &i.Size, &i.OwnerID, &i.OwnerName, &i.Role, &i.SharedAt, &i.ExpiresAt, &i.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, &i)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return items, total, nil
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BackfillStorageKeys fills storage_key of files and folders saved before the column existed,
+// the key is the url with urlPrefix cut off. Nothing is changed if any row is left without a valid key
+func BackfillStorageKeys(ctx context.Context, db *pgxpool.Pool, urlPrefix string) (int64, int64, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var updated [2]int64
+	for i, table := range []string{"files", "folders"} {
+		tag, err := tx.Exec(
+			ctx,
+			fmt.Sprintf(`
+			UPDATE %s SET storage_key = CASE WHEN starts_with(url, $1) THEN substr(url, length($1) + 1) ELSE url END
+			WHERE storage_key IS NULL AND url IS NOT NULL
+			`, table),
+			urlPrefix,
+		)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to backfill %s storage keys: %s", table, err.Error())
+		}
+		updated[i] = tag.RowsAffected()
+
+		var invalid int64
+		if err := tx.QueryRow(
+			ctx,
+			fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE storage_key IS NULL OR storage_key = '' OR storage_key LIKE '%%://%%'", table),
+		).Scan(&invalid); err != nil {
+			return 0, 0, err
+		}
+		if invalid > 0 {
+			return 0, 0, fmt.Errorf("%d %s rows have no valid storage key, their url does not start with %s", invalid, table, urlPrefix)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	return updated[0], updated[1], nil
+}
+
+// RestoreURLs fills url of files and folders back from their storage_key, for reverting the 000003_drop_url migration
+func RestoreURLs(ctx context.Context, db *pgxpool.Pool, urlPrefix string) (int64, int64, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var updated [2]int64
+	for i, table := range []string{"files", "folders"} {
+		tag, err := tx.Exec(
+			ctx,
+			fmt.Sprintf("UPDATE %s SET url = $1 || storage_key WHERE url IS NULL AND storage_key IS NOT NULL", table),
+			urlPrefix,
+		)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to restore %s urls: %s", table, err.Error())
+		}
+		updated[i] = tag.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	return updated[0], updated[1], nil
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type tagRepo struct {
+	db *pgxpool.Pool
+}
+
+func newTagRepo(db *pgxpool.Pool) Tag {
+	return &tagRepo{db: db}
+}
+
+// tagTables returns the tables holding the tags and metadata of files or folders and the column of their IDs
+func tagTables(resourceType string) (string, string, string) {
+	if resourceType == "folder" {
+		return "folder_tags", "folder_metadata", "folder_id"
+	}
+	return "file_tags", "file_metadata", "file_id"
+}
+
+// AddTag tags the file or folder unless it has maxTags tags already, it reports whether the tag was added or already there
+func (r *tagRepo) AddTag(ctx context.Context, resourceType, resourceID, tag string, maxTags int) (bool, error) {
+	tags, _, column := tagTables(resourceType)
+
+	var added bool
+	err := r.db.QueryRow(
+		ctx,
+		`
+		WITH t AS (
+			INSERT INTO ` + tags + `(` + column + `, tag)
+			SELECT $1, $2 WHERE (SELECT count(*) FROM ` + tags + ` WHERE ` + column + ` = $1) < $3
+			ON CONFLICT DO NOTHING
+			RETURNING 1
+		)
+		SELECT EXISTS(SELECT 1 FROM t) OR EXISTS(SELECT 1 FROM ` + tags + ` WHERE ` + column + ` = $1 AND tag = $2)
+		`,
+		resourceID, tag, maxTags,
+	).Scan(&added)
+	return added, err
+}
+
+func (r *tagRepo) DeleteTag(ctx context.Context, resourceType, resourceID, tag string) error {
+	tags, _, column := tagTables(resourceType)
+
+	_, err := r.db.Exec(ctx, "DELETE FROM " + tags + " WHERE " + column + " = $1 AND tag = $2", resourceID, tag)
+	return err
+}
+
+func (r *tagRepo) FindMetadata(ctx context.Context, resourceType, resourceID string) (map[string]string, error) {
+	_, metadata, column := tagTables(resourceType)
+
+	rows, err := r.db.Query(ctx, "SELECT key, value FROM " + metadata + " WHERE " + column + " = $1", resourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// SetMetadata sets the value of the key of the file or folder unless it has maxKeys other keys already,
+// pgx.ErrNoRows is returned if the key was not set
+func (r *tagRepo) SetMetadata(ctx context.Context, resourceType, resourceID, key, value string, maxKeys int) error {
+	_, metadata, column := tagTables(resourceType)
+
+	result, err := r.db.Exec(
+		ctx,
+		`
+		INSERT INTO ` + metadata + `(` + column + `, key, value)
+		SELECT $1, $2, $3 WHERE (SELECT count(*) FROM ` + metadata + ` WHERE ` + column + ` = $1 AND key <> $2) < $4
+		ON CONFLICT (` + column + `, key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()
+		`,
+		resourceID, key, value, maxKeys,
+	)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+
+	return nil
+}
+
+func (r *tagRepo) DeleteMetadata(ctx context.Context, resourceType, resourceID, key string) error {
+	_, metadata, column := tagTables(resourceType)
+
+	_, err := r.db.Exec(ctx, "DELETE FROM " + metadata + " WHERE " + column + " = $1 AND key = $2", resourceID, key)
+	return err
+}
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type uploadSessionRepo struct {
+	db *pgxpool.Pool
+}
+
+func newUploadSessionRepo(db *pgxpool.Pool) UploadSession {
+	return &uploadSessionRepo{db: db}
+}
+
+func (r *uploadSessionRepo) Create(ctx context.Context, s model.UploadSession) error {
+	_, err := r.db.Exec(
+		ctx,
+		"INSERT INTO upload_sessions(id, creator_id, owner_id, folder_id, download_name, public, size, created_at, expires_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		s.ID, s.CreatorID, s.OwnerID, s.FolderID, s.DownloadName, s.Public, s.Size, s.CreatedAt, s.ExpiresAt,
+	)
+	return err
+}
+
+func (r *uploadSessionRepo) FindByID(ctx context.Context, id string) (*model.UploadSession, error) {
+	var s model.UploadSession
+	if err := r.db.QueryRow(
+		ctx,
+		`SELECT id, creator_id, owner_id, folder_id, download_name, public, size, "offset", created_at, expires_at FROM upload_sessions WHERE id = $1`,
+		id,
+	).Scan(&s.ID, &s.CreatorID, &s.OwnerID, &s.FolderID, &s.DownloadName, &s.Public, &s.Size, &s.Offset, &s.CreatedAt, &s.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (r *uploadSessionRepo) UpdateOffset(ctx context.Context, id string, offset int64, expiresAt time.Time) error {
+	_, err := r.db.Exec(ctx, `UPDATE upload_sessions SET "offset" = $1, expires_at = $2 WHERE id = $3`, offset, expiresAt, id)
+	return err
+}
+
+func (r *uploadSessionRepo) Delete(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, "DELETE FROM upload_sessions WHERE id = $1", id)
+	return err
+}
+
+func (r *uploadSessionRepo) FindExpired(ctx context.Context, now time.Time) ([]*model.UploadSession, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT id, creator_id, owner_id, folder_id, download_name, public, size, "offset", created_at, expires_at FROM upload_sessions WHERE expires_at < $1`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*model.UploadSession
+	for rows.Next() {
+		var s model.UploadSession
+		if err := rows.Scan(&s.ID, &s.CreatorID, &s.OwnerID, &s.FolderID, &s.DownloadName, &s.Public, &s.Size, &s.Offset, &s.CreatedAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
@@ -42,11 +42,13 @@ func (r *userSpaceRepo) GetFull(ctx context.Context, userID string) (*model.Full
 	if err := r.db.QueryRow(
 		ctx,
 		`
-		SELECT s.user_id, s.username, s.level, s.created_at, SUM(f.size)
+		SELECT s.user_id, s.username, s.level, s.created_at,
+			(SELECT COALESCE(SUM(f.size), 0) FROM files f WHERE f.creator_id = s.user_id AND f.checksum IS NULL) +
+			(SELECT COALESCE(SUM(v.size), 0) FROM file_versions v JOIN files f ON f.id = v.file_id WHERE f.creator_id = s.user_id AND v.storage_key IS NOT NULL AND v.checksum IS NULL) +
+			(SELECT COALESCE(SUM(b.size), 0) FROM blobs b WHERE b.hash IN (SELECT v.checksum FROM file_versions v JOIN files f ON f.id = v.file_id WHERE f.creator_id = s.user_id)) +
+			(SELECT COALESCE(SUM(u.size), 0) FROM upload_sessions u WHERE u.owner_id = s.user_id)
 		FROM users_spaces s
-		LEFT JOIN files f ON f.creator_id = s.user_id
 		WHERE s.user_id = $1
-		GROUP BY s.user_id, s.username, s.level, s.created_at
 		`,
 		userID,
 	).Scan(&space.UserID, &space.Username, &space.Level, &space.CreatedAt, &space.Size); err != nil && err != pgx.ErrNoRows {
@@ -69,11 +71,19 @@ func (r *userSpaceRepo) GetByUsername(ctx context.Context, username string) (*mo
 	return space, nil
 }
 
+// GetSize counts trashed files and archived versions too, their blobs take space until they are purged,
+// and the space reserved by uploads into the user's folders.
+// Deduplicated content is counted once no matter how many of the user's files and versions share it
 func (r *userSpaceRepo) GetSize(ctx context.Context, userID string) (int64, error) {
 	var nullableSize sql.NullInt64
 	if err := r.db.QueryRow(
 		ctx,
-		"SELECT SUM(size) FROM files WHERE creator_id = $1",
+		`
+		SELECT (SELECT COALESCE(SUM(size), 0) FROM files WHERE creator_id = $1 AND checksum IS NULL) +
+			(SELECT COALESCE(SUM(v.size), 0) FROM file_versions v JOIN files f ON f.id = v.file_id WHERE f.creator_id = $1 AND v.storage_key IS NOT NULL AND v.checksum IS NULL) +
+			(SELECT COALESCE(SUM(b.size), 0) FROM blobs b WHERE b.hash IN (SELECT v.checksum FROM file_versions v JOIN files f ON f.id = v.file_id WHERE f.creator_id = $1)) +
+			(SELECT COALESCE(SUM(size), 0) FROM upload_sessions WHERE owner_id = $1)
+		`,
 		userID,
 	).Scan(&nullableSize); err != nil {
 		return 0, err
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/storage"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const maxArchiveItems = 1000
+
+type archiveService struct {
+	logger *zap.Logger
+	storage storage.Backend
+	fileService File
+	folderService Folder
+}
+
+func newArchiveService(logger *zap.Logger, store storage.Backend, fileService File, folderService Folder) Archive {
+	return &archiveService{
+		logger: logger,
+		storage: store,
+		fileService: fileService,
+		folderService: folderService,
+	}
+}
+
+// Resolve returns the entries of a ZIP archive of the files and folders, the user must be able to view every one of them.
+// Folders come with everything in them that is not in the trash
+func (s *archiveService) Resolve(ctx context.Context, fileIDs, folderIDs []string, userRole string, userSpace model.FullUserSpace) ([]*model.ArchiveEntry, error) {
+	fileIDs, folderIDs = uniqueIDs(fileIDs), uniqueIDs(folderIDs)
+	if len(fileIDs) + len(folderIDs) == 0 {
+		return nil, errNothingToArchive
+	}
+	if len(fileIDs) + len(folderIDs) > maxArchiveItems {
+		return nil, errTooManyArchiveItems
+	}
+
+	names := make(map[string]bool)
+	var entries []*model.ArchiveEntry
+	for _, id := range folderIDs {
+		folder, err := s.folderService.ProtectedFindByID(ctx, id, userRole, userSpace)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, errFolderNotFound
+			}
+			return nil, err
+		}
+
+		prefix := uniqueName(names, folder.Name) + "/"
+		folderEntries, err := s.folderService.zipEntries(ctx, folder, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &model.ArchiveEntry{Name: prefix, Modified: folder.CreatedAt})
+		entries = append(entries, folderEntries...)
+	}
+
+	for _, id := range fileIDs {
+		file, err := s.fileService.ProtectedFindByID(ctx, id, userRole, userSpace)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &model.ArchiveEntry{Name: uniqueName(names, zipName(file.DownloadName)), File: file, Modified: file.DateAdded})
+	}
+
+	return entries, nil
+}
+
+func (s *archiveService) Write(ctx context.Context, entries []*model.ArchiveEntry, w io.Writer) error {
+	return writeZip(ctx, s.storage, w, entries)
+}
+
+// writeZip streams the entries into a ZIP archive written to w, blobs are read from storage one at a time.
+// archive/zip switches to ZIP64 by itself once an entry or the archive outgrows the 32-bit fields
+func writeZip(ctx context.Context, store storage.Backend, w io.Writer, entries []*model.ArchiveEntry) error {
+	zw := zip.NewWriter(w)
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if e.File == nil {
+			if _, err := zw.CreateHeader(&zip.FileHeader{Name: e.Name, Modified: e.Modified}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := zipFile(ctx, store, zw, e); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func zipFile(ctx context.Context, store storage.Backend, zw *zip.Writer, e *model.ArchiveEntry) error {
+	r, err := store.Get(ctx, e.File.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to get file(%s) from storage: %s", e.File.ID, err.Error())
+	}
+	defer r.Close()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: e.Name, Method: zip.Deflate, Modified: e.Modified})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, r)
+	return err
+}
+
+// uniqueName marks the name taken, a name taken already gets a " (n)" suffix before its extension
+func uniqueName(names map[string]bool, name string) string {
+	unique := name
+	ext := path.Ext(name)
+	for i := 1; names[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	names[unique] = true
+
+	return unique
+}
+
+// zipName keeps a file name from adding directories to the archive
+func zipName(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+}
+
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	var unique []string
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
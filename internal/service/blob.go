@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"math"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/File-Sharer/file-service/internal/storage"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// newBlobKey returns a new storage key for a blob. Content is uploaded before its hash is known, and every stored copy
+// gets its own key, so content uploaded again while its unreferenced copy is being deleted is never overwritten
+func newBlobKey() string {
+	id := uuid.NewString()
+	return ".blobs/" + id[:2] + "/" + id
+}
+
+// blobStore keeps file contents once per SHA-256 checksum, every file version holds a reference to its blob
+type blobStore struct {
+	logger *zap.Logger
+	repo *repository.Repository
+	storage storage.Backend
+}
+
+func newBlobStore(logger *zap.Logger, repo *repository.Repository, store storage.Backend) *blobStore {
+	return &blobStore{
+		logger: logger,
+		repo: repo,
+		storage: store,
+	}
+}
+
+// store takes a reference to the blob with the content. The content is hashed while it is uploaded under a new key,
+// the upload becomes the blob if there is no blob with its checksum yet and is deleted otherwise.
+// Reading is cut off as soon as the content outgrows maxSize
+func (b *blobStore) store(ctx context.Context, content io.Reader, maxSize int64, maxSizeErr error) (*model.Blob, error) {
+	key := newBlobKey()
+	limited := newSizeLimitReader(content, maxSize)
+	h := sha256.New()
+	size, err := b.storage.Put(ctx, key, io.TeeReader(limited, h))
+	if limited.exceeded() {
+		b.deleteOrphans(ctx, []string{key})
+		return nil, maxSizeErr
+	}
+	if err != nil {
+		b.logger.Sugar().Errorf("failed to upload blob(%s) to storage: %s", key, err.Error())
+		b.deleteOrphans(ctx, []string{key})
+		return nil, errFailedToUploadFileToFileStorage
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	blob, err := b.repo.Postgres.Blob.Acquire(ctx, hash)
+	if err == nil {
+		// The content is stored already
+		b.deleteOrphans(ctx, []string{key})
+		return blob, nil
+	}
+	if err != pgx.ErrNoRows {
+		b.logger.Sugar().Errorf("failed to acquire blob(%s) in postgres: %s", hash, err.Error())
+		b.deleteOrphans(ctx, []string{key})
+		return nil, errInternal
+	}
+
+	blob, err = b.repo.Postgres.Blob.Create(ctx, model.Blob{Hash: hash, StorageKey: key, Size: size})
+	if err != nil {
+		b.logger.Sugar().Errorf("failed to create blob(%s) in postgres: %s", hash, err.Error())
+		b.deleteOrphans(ctx, []string{key})
+		return nil, errInternal
+	}
+
+	// The same content was stored by another upload in the meantime
+	if blob.StorageKey != key {
+		b.deleteOrphans(ctx, []string{key})
+	}
+
+	return blob, nil
+}
+
+// storeFrom stores the blob at key of a file uploaded before deduplication as a deduplicated blob
+func (b *blobStore) storeFrom(ctx context.Context, key string) (*model.Blob, error) {
+	r, err := b.storage.Get(ctx, key)
+	if err != nil {
+		b.logger.Sugar().Errorf("failed to get blob(%s) from storage: %s", key, err.Error())
+		return nil, errInternal
+	}
+	defer r.Close()
+
+	return b.store(ctx, r, math.MaxInt64, nil)
+}
+
+// acquire takes one more reference to the blob with the hash
+func (b *blobStore) acquire(ctx context.Context, hash string) (*model.Blob, error) {
+	blob, err := b.repo.Postgres.Blob.Acquire(ctx, hash)
+	if err != nil {
+		b.logger.Sugar().Errorf("failed to acquire blob(%s) in postgres: %s", hash, err.Error())
+		return nil, errInternal
+	}
+
+	return blob, nil
+}
+
+// release drops a reference to each of the blobs, blobs nothing references anymore are deleted from storage
+func (b *blobStore) release(ctx context.Context, hashes ...string) {
+	orphans, err := b.repo.Postgres.Blob.Release(ctx, hashes)
+	if err != nil {
+		b.logger.Sugar().Errorf("failed to release blobs in postgres: %s", err.Error())
+		return
+	}
+
+	b.deleteOrphans(ctx, orphans)
+}
+
+// deleteOrphans deletes blobs nothing references anymore from storage
+func (b *blobStore) deleteOrphans(ctx context.Context, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := b.storage.Delete(ctx, keys...); err != nil {
+		b.logger.Sugar().Errorf("failed to delete unreferenced blobs from storage: %s", err.Error())
+	}
+}
@@ -0,0 +1,15 @@
+package service
+
+import "github.com/File-Sharer/file-service/internal/model"
+
+// cachedFile keeps the storage key of the cached file, the JSON of model.File leaves it out
+type cachedFile struct {
+	File       *model.File `json:"file"`
+	StorageKey string      `json:"storageKey"`
+}
+
+// cachedFolder keeps the storage key of the cached folder, like cachedFile
+type cachedFolder struct {
+	Folder     *model.Folder `json:"folder"`
+	StorageKey string        `json:"storageKey"`
+}
@@ -10,9 +10,78 @@ var (
 	errUserNotFound = errors.New("user not found")
 	errWaitDelay = errors.New("please wait until the timeout is over, it is 2 mins for creating files")
 	errCantAddPermissionForYourself = errors.New("you cannot add permission to yourself")
+	errInvalidRole = errors.New("role must be viewer, editor or manager")
+	errInvalidSort = errors.New("sort must be name, owner, role, sharedAt or createdAt")
 	errFailedToUploadFileToFileStorage = errors.New("failed to upload file to file storage")
 	errYouDoNotHaveEnoughSpace = errors.New("you don not have enough space")
 	errTheFileWithThatNameAlreadyExists = errors.New("the file with that name already exists")
 	errTheFolderWithThatNameAlreadyExists = errors.New("the folder with that name already exists")
 	errFileHasNoData = errors.New("file has no data")
+	errFolderNotFound = errors.New("folder not found")
+	errUploadSessionNotFound = errors.New("upload session not found")
+	errUploadSessionIsBusy = errors.New("upload session is busy, try again later")
+	errUploadOffsetMismatch = errors.New("upload offset does not match the session offset")
+	errUploadChunkIsTooBig = errors.New("chunk exceeds the declared upload size")
+	errUploadIsNotComplete = errors.New("upload is not complete yet")
+	errFailedToDeleteFileFromStorage = errors.New("failed to delete file from storage")
+	errFolderIsNotEmpty = errors.New("folder still contains files that failed to be deleted")
+	errInvalidName = errors.New("name must not be empty or contain slashes")
+	errCantMoveFolderIntoItself = errors.New("folder can't be moved or copied into itself")
+	errNotInTrash = errors.New("item is not in the trash")
+	errParentFolderIsInTrash = errors.New("parent folder is in the trash, restore it first")
+	errVersionNotFound = errors.New("file version not found")
+	errVersionIsCurrent = errors.New("file version is already current")
+	errShareLinkNotFound = errors.New("share link not found or expired")
+	errShareLinkPasswordRequired = errors.New("share link is protected by a password")
+	errWrongShareLinkPassword = errors.New("wrong share link password")
+	errTooManyPasswordAttempts = errors.New("too many wrong share link passwords, try again later")
+	errExpiryIsInThePast = errors.New("expiry must be in the future")
+	errGroupNotFound = errors.New("group not found")
+	errGroupAlreadyExists = errors.New("you already have a group with that name")
+	errInvitationNotFound = errors.New("invitation not found or expired")
+	errCantTrustYourself = errors.New("you cannot trust yourself")
+	errNestedFolderVisibility = errors.New("nested folders have the visibility of their root folder")
+	errNothingToArchive = errors.New("no files or folders to archive")
+	errTooManyArchiveItems = errors.New("too many files and folders to archive at once")
+	errUnsupportedArchive = errors.New("only .zip, .tar, .tar.gz and .tgz archives can be extracted")
+	errInvalidArchive = errors.New("archive is corrupted")
+	errTooManyArchiveEntries = errors.New("archive has too many entries")
+	errArchiveIsTooCompressed = errors.New("archive unpacks to too much data for its size")
+	errUnsafeArchivePath = errors.New("entry path leaves the archive folder or has an invalid name")
+	errUnsupportedArchiveEntry = errors.New("only files and folders are extracted")
+	errInvalidListSort = errors.New("sort must be name, size or date")
+	errInvalidCursor = errors.New("invalid cursor")
+	errInvalidSearchText = errors.New("search text must be 2 to 100 characters long")
+	errInvalidSearchType = errors.New("type must be file or folder")
+	errInvalidTag = errors.New("tag must be 1 to 64 characters long")
+	errTooManyTags = errors.New("a file or folder can have at most 20 tags")
+	errInvalidMetadataKey = errors.New("metadata key must be 1 to 64 letters, digits, dots, dashes or underscores")
+	errMetadataValueIsTooLong = errors.New("metadata value must be at most 1024 characters long")
+	errTooManyMetadataKeys = errors.New("a file or folder can have at most 50 metadata keys")
+	errArchiveEntrySizeMismatch = errors.New("entry content does not match the size declared by the archive")
 )
+
+// IsNotFound reports whether err means the requested file, folder, file version or upload session does not exist
+func IsNotFound(err error) bool {
+	return err == errFileNotFound || err == errFolderNotFound || err == errVersionNotFound || err == errUploadSessionNotFound
+}
+
+// IsNoAccess reports whether err means the user may not do what was requested
+func IsNoAccess(err error) bool {
+	return err == errNoAccess
+}
+
+// IsConflict reports whether err means the request does not fit the current state of an upload, like a wrong offset
+func IsConflict(err error) bool {
+	return err == errUploadOffsetMismatch || err == errUploadSessionIsBusy
+}
+
+// IsInvalidQuery reports whether err means the sort or cursor of a listing is invalid
+func IsInvalidQuery(err error) bool {
+	return err == errInvalidListSort || err == errInvalidCursor
+}
+
+// IsTooManyAttempts reports whether err means the client has to wait before trying again
+func IsTooManyAttempts(err error) bool {
+	return err == errTooManyPasswordAttempts
+}
@@ -1,14 +1,9 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"mime/multipart"
-	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -17,11 +12,10 @@ import (
 	"github.com/File-Sharer/file-service/internal/model"
 	"github.com/File-Sharer/file-service/internal/repository"
 	"github.com/File-Sharer/file-service/internal/repository/redisrepo"
+	"github.com/File-Sharer/file-service/internal/storage"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/redis/go-redis/v9"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -29,49 +23,160 @@ type FileService struct {
 	logger *zap.Logger
 	repo *repository.Repository
 	hasher pb.HasherClient
-	httpClient *http.Client
+	storage storage.Backend
 	userSpaceService UserSpace
 	rdb *redis.Client
 	folderService Folder
+	invitationService Invitation
+	blobs *blobStore
 }
 
-func NewFileService(logger *zap.Logger, repo *repository.Repository, hasherClient pb.HasherClient, userSpaceService UserSpace, rdb *redis.Client, folderService Folder) *FileService {
+func NewFileService(logger *zap.Logger, repo *repository.Repository, hasherClient pb.HasherClient, store storage.Backend, blobs *blobStore, userSpaceService UserSpace, rdb *redis.Client, folderService Folder, invitationService Invitation) *FileService {
 	return &FileService{
 		logger: logger,
 		repo: repo,
 		hasher: hasherClient,
-		httpClient: &http.Client{},
+		storage: store,
 		userSpaceService: userSpaceService,
 		rdb: rdb,
 		folderService: folderService,
+		invitationService: invitationService,
+		blobs: blobs,
 	}
 }
 
-func (s *FileService) Create(ctx context.Context, userSpace model.FullUserSpace, fileObj model.File, file multipart.File, fileHeader *multipart.FileHeader) (*model.File, error) {
-	if fileHeader.Size == 0 {
-		return nil, errFileHasNoData
+// Create uploads a new file, with newVersion a file with the same name in the folder gets a new version instead
+func (s *FileService) Create(ctx context.Context, userRole string, userSpace model.FullUserSpace, fileObj model.File, file multipart.File, fileHeader *multipart.FileHeader, newVersion bool) (*model.File, error) {
+	targetSpace, err := s.uploadTarget(ctx, fileObj.FolderID, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUpload(ctx, userSpace.UserID, targetSpace, fileHeader.Size); err != nil {
+		return nil, err
+	}
+
+	if newVersion {
+		// Root files are looked up among the user's own
+		existingID, err := s.repo.Postgres.File.FindInFolder(ctx, userSpace.UserID, fileObj.FolderID, downloadNameWithExt(fileObj.DownloadName, fileHeader.Filename))
+		if err != nil && err != pgx.ErrNoRows {
+			s.logger.Sugar().Errorf("failed to find file(%s) in folder(%v) in postgres: %s", fileObj.DownloadName, fileObj.FolderID, err.Error())
+			return nil, errInternal
+		}
+
+		if err == nil {
+			existing, err := s.FindByID(ctx, existingID)
+			if err != nil {
+				return nil, err
+			}
+
+			// Editing rights in the folder were checked by uploadTarget
+			return s.createVersion(ctx, targetSpace, existing, file)
+		}
+	}
+
+	return s.create(ctx, targetSpace, fileObj, file, fileHeader)
+}
+
+// uploadTarget checks that the user may upload into the folder and returns the space the upload counts against,
+// files uploaded into a shared folder belong to the owner of the folder
+func (s *FileService) uploadTarget(ctx context.Context, folderID *string, userRole string, userSpace model.FullUserSpace) (model.FullUserSpace, error) {
+	if folderID == nil {
+		return userSpace, nil
+	}
+
+	folder, err := s.folderService.findByID(ctx, *folderID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return model.FullUserSpace{}, errFolderNotFound
+		}
+		return model.FullUserSpace{}, err
+	}
+
+	if folder.DeletedAt != nil {
+		return model.FullUserSpace{}, errFolderNotFound
+	}
+
+	role, err := s.folderService.access(ctx, folder, userRole, userSpace)
+	if err != nil {
+		return model.FullUserSpace{}, err
+	}
+	if !atLeast(role, model.RoleEditor) {
+		return model.FullUserSpace{}, errNoAccess
+	}
+
+	return s.ownerSpace(ctx, folder.CreatorID, userSpace)
+}
+
+// ownerSpace returns the space of the owner of a file or folder the user changes
+func (s *FileService) ownerSpace(ctx context.Context, ownerID string, userSpace model.FullUserSpace) (model.FullUserSpace, error) {
+	if ownerID == userSpace.UserID {
+		return userSpace, nil
+	}
+
+	space, err := s.userSpaceService.Get(ctx, ownerID)
+	if err != nil {
+		return model.FullUserSpace{}, err
+	}
+
+	return *space, nil
+}
+
+// checkUpload checks the user's creating files delay and the target space for an upload of the given size and sends the user to timeout
+func (s *FileService) checkUpload(ctx context.Context, userID string, targetSpace model.FullUserSpace, size int64) error {
+	if size == 0 {
+		return errFileHasNoData
 	}
 	
 	// Checking user creating files delay
-	delay := s.rdb.Get(ctx, FileCreateDelayPrefix(fileObj.CreatorID))
+	delay := s.rdb.Get(ctx, FileCreateDelayPrefix(userID))
 	if delay.Err() != redis.Nil {
-		return nil, errWaitDelay
+		return errWaitDelay
 	}
 	
-	if fileHeader.Size > levelSpaceSizes[userSpace.Level].maxFileSize {
-		return nil, errFileIsTooBig
+	if size > levelSpaceSizes[targetSpace.Level].maxFileSize {
+		return errFileIsTooBig
 	}
 
-	if userSpace.Size + fileHeader.Size > levelSpaceSizes[userSpace.Level].maxSpaceSize {
-		return nil, errYouDoNotHaveEnoughSpace
+	if targetSpace.Size + size > levelSpaceSizes[targetSpace.Level].maxSpaceSize {
+		return errYouDoNotHaveEnoughSpace
 	}
 
 	// Sending user to timeout
-	if err := s.rdb.Set(ctx, FileCreateDelayPrefix(fileObj.CreatorID), 1, time.Minute * 2).Err(); err != nil {
-		s.logger.Sugar().Errorf("failed to set user(%s) to timeout in redis: %s", fileObj.CreatorID, err.Error())
-		return nil, errInternal
+	if err := s.rdb.Set(ctx, FileCreateDelayPrefix(userID), 1, time.Minute * 2).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to set user(%s) to timeout in redis: %s", userID, err.Error())
+		return errInternal
 	}
-	
+
+	return nil
+}
+
+// downloadNameWithExt makes the download name end with the extension of the uploaded file
+func downloadNameWithExt(downloadName, filename string) string {
+	ext := filepath.Ext(filename)
+
+	// Validating file extension
+	downloadNameExt := filepath.Ext(downloadName)
+	if downloadNameExt == "" || downloadNameExt != ext {
+		downloadName += ext
+	}
+
+	return downloadName
+}
+
+// uploadLimit returns the max size of an upload and the error for exceeding it, the smaller of the file size limit and the free space
+func uploadLimit(userSpace model.FullUserSpace) (int64, error) {
+	maxSize, maxSizeErr := levelSpaceSizes[userSpace.Level].maxFileSize, errFileIsTooBig
+	if freeSpace := levelSpaceSizes[userSpace.Level].maxSpaceSize - userSpace.Size; freeSpace < maxSize {
+		maxSize, maxSizeErr = freeSpace, errYouDoNotHaveEnoughSpace
+	}
+
+	return maxSize, maxSizeErr
+}
+
+// create uploads the file and saves it without checking the user's creating files delay and access to the folder,
+// the upload counts against targetSpace
+func (s *FileService) create(ctx context.Context, targetSpace model.FullUserSpace, fileObj model.File, file multipart.File, fileHeader *multipart.FileHeader) (*model.File, error) {
 	fileHashIDResp, err := s.hasher.Hash(ctx, &pb.HashReq{BaseString: fileObj.CreatorID})
 	if !fileHashIDResp.GetOk() {
 		s.logger.Sugar().Errorf("failed to hash user(%s)'s file ID: %s", fileObj.CreatorID, err.Error())
@@ -79,25 +184,23 @@ func (s *FileService) Create(ctx context.Context, userSpace model.FullUserSpace,
 	}
 	fileObj.ID = fileHashIDResp.GetHash()
 
-	ext := filepath.Ext(fileHeader.Filename)
-
-	// Validating file extension
-	downloadNameExt := filepath.Ext(fileObj.DownloadName)
-	if downloadNameExt == "" || downloadNameExt != ext {
-		fileObj.DownloadName += ext
-	}
+	fileObj.DownloadName = downloadNameWithExt(fileObj.DownloadName, fileHeader.Filename)
 	fileObj.Filename = new(string)
 
-	path := fileObj.CreatorID
 	if fileObj.FolderID != nil {
 		folder, err := s.folderService.findByID(ctx, *fileObj.FolderID)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				return nil, nil
+				return nil, errFolderNotFound
 			}
 			return nil, err
 		}
 
+		if folder.DeletedAt != nil {
+			return nil, errFolderNotFound
+		}
+		fileObj.CreatorID = folder.CreatorID
+
 		fileObj.MainFolderID = new(string)
 		if folder.MainFolderID != nil {
 			*fileObj.MainFolderID = *folder.MainFolderID
@@ -115,25 +218,25 @@ func (s *FileService) Create(ctx context.Context, userSpace model.FullUserSpace,
 
 		fileObj.Public = nil
 		fileObj.Filename = nil
-		fileHeader.Filename = fileObj.DownloadName
-
-		sep := fmt.Sprintf("%s/files/%s/folders/", viper.GetString("fileStorage.origin"), fileObj.CreatorID)
-		path = fmt.Sprintf("%s/folders/%s", fileObj.CreatorID, strings.Split(folder.URL, sep)[1])
 	} else {
 		*fileObj.Filename = uuid.NewString() + filepath.Ext(fileObj.DownloadName)
-		fileHeader.Filename = *fileObj.Filename
 	}
 	
-	fileSize, fileURL, err := s.saveToFileStorage(path, file, fileHeader)
+	// The upload is cut off as soon as it outgrows the file size limit or the free space
+	maxSize, maxSizeErr := uploadLimit(targetSpace)
+
+	blob, err := s.blobs.store(ctx, file, maxSize, maxSizeErr)
 	if err != nil {
-		s.logger.Error(err.Error())
-		return nil, errFailedToUploadFileToFileStorage
+		return nil, err
 	}
-	fileObj.Size = fileSize
-	fileObj.URL = fileURL
+	fileObj.Size = blob.Size
+	fileObj.Version = 1
+	fileObj.StorageKey = blob.StorageKey
+	fileObj.Checksum = &blob.Hash
 
 	if err := s.repo.Postgres.File.Create(ctx, &fileObj); err != nil {
 		s.logger.Sugar().Errorf("failed to create file by user(%s) in postgres: %s", fileObj.CreatorID, err.Error())
+		s.blobs.release(ctx, blob.Hash)
 		return nil, errInternal
 	}
 	fileObj.DateAdded = time.Now()
@@ -142,125 +245,70 @@ func (s *FileService) Create(ctx context.Context, userSpace model.FullUserSpace,
 	if err := s.rdb.Del(ctx, UserFilesPrefix(fileObj.CreatorID), SpaceSizePrefix(fileObj.CreatorID)).Err(); err != nil {
 		s.logger.Sugar().Errorf("failed to clear user(%s) files cache in redis: %s", fileObj.CreatorID, err.Error())
 	}
+	s.folderService.clearStatsCache(ctx, fileObj.FolderID)
 
 	return &fileObj, err
 }
 
-func (s *FileService) saveToFileStorage(path string, file multipart.File, fileHeader *multipart.FileHeader) (int64, string, error) {
-	endpoint := "/files"
-	url := viper.GetString("fileStorage.origin") + endpoint
-
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-
-	// Writing text fields
-	if err := writer.WriteField("path", path); err != nil {
-		return 0, "", fmt.Errorf("failed to write 'path' field for file-storage request: %s", err.Error())
-	}
-
-	// Writing file
-	fileWriter, err := writer.CreateFormFile("file", fileHeader.Filename)
+func (s *FileService) ProtectedFindByID(ctx context.Context, fileID, userRole string, userSpace model.FullUserSpace) (*model.File, error) {
+	file, err := s.FindByID(ctx, fileID)
 	if err != nil {
-		return 0, "", fmt.Errorf("failed to create file part for file-storage request: %s", err.Error())
-	}
-
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return 0, "", fmt.Errorf("failed to seek to the start of the file: %s", err.Error())
-	}
-
-	if _, err := io.Copy(fileWriter, file); err != nil {
-		return 0, "", fmt.Errorf("failed to copy file content for file-storage request: %s", err.Error())
-	}
-
-	// End of request body
-	if err := writer.Close(); err != nil {
-		return 0, "", fmt.Errorf("failed to close writer for file-storage request: %s", err.Error())
+		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, url, &requestBody)
-	if err != nil {
-		return 0, "", fmt.Errorf("failed to create file-storage request: %s", err.Error())
+	if file.DeletedAt != nil {
+		return nil, errFileNotFound
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("X-Internal-Token", os.Getenv("X_INTERNAL_TOKEN"))
 
-	resp, err := s.httpClient.Do(req)
+	role, err := s.access(ctx, file, userRole, userSpace)
 	if err != nil {
-		return 0, "", fmt.Errorf("failed to do file-storage request: %s", err.Error())
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, "", fmt.Errorf("failed to read response body from file-storage: %s", err.Error())
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		var bodyJSON map[string]interface{}
-        if err := json.Unmarshal(body, &bodyJSON); err != nil {
-            return 0, "", fmt.Errorf("failed to decode error response from file-storage: %s", err.Error())
-        }
-		return 0, "", fmt.Errorf("ERROR from file-storage endpoint(%s), code(%d), details: %s", endpoint, resp.StatusCode, bodyJSON["details"])
+		return nil, err
 	}
-
-	var response uploadResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return 0, "", fmt.Errorf("failed to unmarshal json response from file-storage: %s", err.Error())
+	if !atLeast(role, model.RoleViewer) {
+		return nil, errNoAccess
 	}
 
-	return response.FileSize, response.URL, nil
-}
-
-type uploadResponse struct {
-	Ok       bool   `json:"ok"`
-	URL      string `json:"url"`
-	FileSize int64  `json:"file_size"`
+	return file, nil
 }
 
-func (s *FileService) ProtectedFindByID(ctx context.Context, fileID, userRole string, userSpace model.FullUserSpace) (*model.File, error) {
-	file, err := s.FindByID(ctx, fileID)
-	if err != nil {
-		return nil, err
-	}
-
+// access returns the role of the user in the file, a file in a folder gets the role of the user in its root folder.
+// Anyone may view a public file
+func (s *FileService) access(ctx context.Context, file *model.File, userRole string, userSpace model.FullUserSpace) (string, error) {
 	if file.CreatorID == userSpace.UserID || userRole == "ADMIN" {
-		return file, nil
+		return roleOwner, nil
 	}
 
-	if file.Public != nil && *file.Public {
-		return file, nil
+	if file.MainFolderID != nil {
+		folder, err := s.folderService.findByID(ctx, *file.MainFolderID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return "", errFolderNotFound
+			}
+			return "", err
+		}
+		return s.folderService.access(ctx, folder, userRole, userSpace)
 	}
 
-	permission, err := s.HasPermission(ctx, fileID, userSpace.Username)
+	role, err := s.role(ctx, file.ID, userSpace.Username)
 	if err != nil {
-		return nil, err
-	}
-
-	if permission {
-		return file, nil
+		return "", err
 	}
 
-	if file.MainFolderID != nil {
-		hasPermission, err := s.folderService.hasPermission(ctx, *file.MainFolderID, userSpace.UserID)
-		if err != nil {
-			return nil, err
-		}
-		if hasPermission {
-			return file, nil
-		}
-
-		return nil, errNoAccess
+	if role == "" && file.Public != nil && *file.Public {
+		return model.RoleViewer, nil
 	}
 
-	return nil, errNoAccess
+	return role, nil
 }
 
 func (s *FileService) FindByID(ctx context.Context, id string) (*model.File, error) {
-	fileCache, err := redisrepo.Get[model.File](s.rdb, ctx, FilePrefix(id))
-	if err == nil {
-		return fileCache, nil
+	// Entries cached before they kept the storage key have no file and are replaced
+	fileCache, err := redisrepo.Get[cachedFile](s.rdb, ctx, FilePrefix(id))
+	if err == nil && fileCache != nil && fileCache.File != nil {
+		fileCache.File.StorageKey = fileCache.StorageKey
+		return fileCache.File, nil
 	}
-	if err != redis.Nil {
+	if err != nil && err != redis.Nil {
 		return nil, err
 	}
 
@@ -273,95 +321,95 @@ func (s *FileService) FindByID(ctx context.Context, id string) (*model.File, err
 	}
 
 	// Caching result
-	if err := redisrepo.SetJSON(s.rdb, ctx, FilePrefix(file.ID), file,  time.Hour); err != nil {
+	if err := redisrepo.SetJSON(s.rdb, ctx, FilePrefix(file.ID), cachedFile{File: file, StorageKey: file.StorageKey},  time.Hour); err != nil {
 		return nil, err
 	}
 
 	return file, nil
 }
 
-func (s *FileService) FindUserFiles(ctx context.Context, userID string) ([]*model.File, error) {
-	filesCache, err := redisrepo.GetMany[model.File](s.rdb, ctx, UserFilesPrefix(userID))
-	if err == nil {
-		return filesCache, nil
-	}
-	if err != redis.Nil {
-		return nil, err
-	}
-
-	files, err := s.repo.Postgres.File.FindUserFiles(ctx, userID)
+// FindUserFiles returns a page of the user's root files, every page is cached in the hash of the user's files
+func (s *FileService) FindUserFiles(ctx context.Context, userID string, q ListQuery) (*model.FilePage, error) {
+	lq, err := listQuery(q)
 	if err != nil {
 		return nil, err
 	}
 
-	// Caching result
-	if err := redisrepo.SetJSON(s.rdb, ctx, UserFilesPrefix(userID), files, time.Minute * 5); err != nil {
-		return nil, err
-	}
+	return cachedPage(ctx, s.rdb, s.logger, UserFilesPrefix(userID), lq, time.Minute * 5, func() (*model.FilePage, error) {
+		files, next, err := s.repo.Postgres.File.FindUserFiles(ctx, userID, lq)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to find user(%s) files in postgres: %s", userID, err.Error())
+			return nil, errInternal
+		}
 
-	return files, nil
+		return &model.FilePage{Items: files, NextCursor: encodeCursor(next)}, nil
+	})
 }
 
-func (s *FileService) HasPermission(ctx context.Context, fileID, username string) (bool, error) {
-	permissionCache, err := s.rdb.Get(ctx, FilePermissionPrefix(fileID, username)).Bool()
+// role returns the role the user was granted in the file, an empty role means no permission
+func (s *FileService) role(ctx context.Context, fileID, username string) (string, error) {
+	roleCache, err := s.rdb.Get(ctx, FilePermissionPrefix(fileID, username)).Result()
 	if err == nil {
-		return permissionCache, nil
+		return roleCache, nil
 	}
 	if err != redis.Nil {
-		return false, err
+		return "", err
 	}
 
-	hasPermission, err := s.repo.Postgres.File.HasPermission(ctx, fileID, username)
+	role, expiresAt, err := s.repo.Postgres.File.GetRole(ctx, fileID, username)
 	if err != nil {
-		s.logger.Sugar().Errorf("failed to get if user(%s) has permission to file(%s) from postgres: %s", username, fileID, err.Error())
-		return false, err
+		s.logger.Sugar().Errorf("failed to get role of user(%s) in file(%s) from postgres: %s", username, fileID, err.Error())
+		return "", err
 	}
 
-	if err := s.rdb.Set(ctx, FilePermissionPrefix(fileID, username), hasPermission, time.Minute).Err(); err != nil {
-		return false, err
+	if err := s.rdb.Set(ctx, FilePermissionPrefix(fileID, username), role, grantTTL(time.Minute, expiresAt)).Err(); err != nil {
+		return "", err
 	}
 
-	return hasPermission, nil
+	return role, nil
 }
 
-func (s *FileService) AddPermission(ctx context.Context, d AddPermissionData) error {
+// AddPermission invites the user to the file, users who already have a permission to it or trust the inviter get the new one right away
+func (s *FileService) AddPermission(ctx context.Context, d AddPermissionData) (*model.Invitation, error) {
 	file, err := s.FindByID(ctx, d.ResourceID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Skip if the file is nested
 	if file.MainFolderID != nil {
-		return nil
+		return nil, nil
 	}
 
-	if d.UserSpace.UserID != file.CreatorID && d.UserRole != "ADMIN" {
-		return errNoAccess
+	if !validRole(d.Role) {
+		return nil, errInvalidRole
 	}
 
-	if d.UserToAddName == d.UserSpace.Username {
-		return errCantAddPermissionForYourself
+	if d.ExpiresAt != nil && !d.ExpiresAt.After(time.Now()) {
+		return nil, errExpiryIsInThePast
 	}
 
-	// Clear cache
-	if err := s.rdb.Del(ctx, FilePermissionPrefix(d.ResourceID, d.UserToAddName), FilePermissionsPrefix(d.ResourceID)).Err(); err != nil {
-		return err
+	role, err := s.access(ctx, file, d.UserRole, d.UserSpace)
+	if err != nil {
+		return nil, err
+	}
+	if !atLeast(role, model.RoleManager) {
+		return nil, errNoAccess
 	}
 
-	if err := s.repo.Postgres.File.AddPermission(ctx, d.ResourceID, d.UserToAddName); err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok {
-			if pgErr.Code == "23503" {
-				return errUserNotFound
-			}
-		}
-		
-		s.logger.Sugar().Errorf("failed to add permisson to file(%s) to user(%s) in postgres: %s", d.ResourceID, d.UserToAddName, err.Error())
-		return errInternal
+	if d.UserToAddName == d.UserSpace.Username {
+		return nil, errCantAddPermissionForYourself
 	}
 
-	return nil
+	// Clear cache
+	if err := s.rdb.Del(ctx, FilePermissionPrefix(d.ResourceID, d.UserToAddName), FilePermissionsPrefix(d.ResourceID), SharedPrefix(d.UserToAddName)).Err(); err != nil {
+		return nil, err
+	}
+
+	return s.invitationService.invite(ctx, "file", file.DownloadName, d)
 }
 
+// Delete moves the file to the trash
 func (s *FileService) Delete(ctx context.Context, fileID, userRole string, userSpace model.FullUserSpace) error {
 	file, err := s.ProtectedFindByID(ctx, fileID, userRole, userSpace)
 	if err != nil {
@@ -372,94 +420,210 @@ func (s *FileService) Delete(ctx context.Context, fileID, userRole string, userS
 		return errInternal
 	}
 
-	if file.CreatorID != userSpace.UserID && userRole != "ADMIN" {
+	role, err := s.access(ctx, file, userRole, userSpace)
+	if err != nil {
+		return err
+	}
+	if !atLeast(role, changeRole(file.MainFolderID)) {
 		return errNoAccess
 	}
 
-	sep := fmt.Sprintf("%s/files/", viper.GetString("fileStorage.origin"))
-	parts := strings.Split(file.URL, sep)
-	if len(parts) < 2 {
-		s.logger.Sugar().Errorf("incorrect url(%s) for file(%s)", file.URL, file.ID)
-		return errInternal
+	// A blob stored under the file name goes under the trash key, so the name is free to be used again until the file is restored.
+	// Deduplicated blobs are not tied to the name and stay where they are
+	key := file.StorageKey
+	if file.Checksum == nil {
+		key = trashKey(file.CreatorID, file.ID)
+		if err := s.storage.Move(ctx, file.StorageKey, key); err != nil {
+			s.logger.Sugar().Errorf("failed to move file(%s) to trash in storage: %s", file.ID, err.Error())
+			return errInternal
+		}
 	}
-	path := parts[1]
-	
-	if err := s.deleteFiles([]string{path}); err != nil {
-		s.logger.Error(err.Error())
+
+	if err := s.repo.Postgres.File.Trash(ctx, fileID, key); err != nil {
+		s.logger.Sugar().Errorf("failed to move file(%s) to trash in postgres: %s", fileID, err.Error())
+		if key != file.StorageKey {
+			if err := s.storage.Move(ctx, key, file.StorageKey); err != nil {
+				s.logger.Sugar().Errorf("failed to move file(%s) back from trash in storage: %s", fileID, err.Error())
+			}
+		}
 		return errInternal
 	}
 
-	if err := s.repo.Postgres.File.Delete(ctx, fileID); err != nil {
-		s.logger.Sugar().Errorf("failed to delete file(%s) from postgres: %s", fileID, err.Error())
-		return errInternal
+	s.clearCache(ctx, file)
+
+	return nil
+}
+
+// Restore brings the file back from the trash, the file gets a free name if its name was taken in the meantime
+func (s *FileService) Restore(ctx context.Context, id, userID string) (*model.File, error) {
+	file, err := s.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.rdb.Del(ctx, FilePrefix(fileID), UserFilesPrefix(userSpace.UserID), SpaceSizePrefix(userSpace.UserID)).Err(); err != nil {
-		s.logger.Sugar().Errorf("failed to delete file(%s) from redis: %s", fileID, err.Error())
-		return errInternal
+	if file.DeletedAt == nil {
+		return nil, errNotInTrash
 	}
 
-	return nil
+	if file.CreatorID != userID {
+		return nil, errNoAccess
+	}
+
+	restored := *file
+	restored.DeletedAt = nil
+	if file.FolderID != nil {
+		folder, err := s.folderService.findByID(ctx, *file.FolderID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, errFolderNotFound
+			}
+			return nil, err
+		}
+		if folder.DeletedAt != nil {
+			return nil, errParentFolderIsInTrash
+		}
+
+		restored.DownloadName, err = s.freeFileName(ctx, folder.ID, file.DownloadName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.place(ctx, &restored, file.FolderID); err != nil {
+		return nil, err
+	}
+
+	if restored.StorageKey != file.StorageKey {
+		if err := s.storage.Move(ctx, file.StorageKey, restored.StorageKey); err != nil {
+			s.logger.Sugar().Errorf("failed to restore file(%s) from trash in storage: %s", id, err.Error())
+			return nil, errInternal
+		}
+	}
+
+	if err := s.repo.Postgres.File.Restore(ctx, &restored); err != nil {
+		s.logger.Sugar().Errorf("failed to restore file(%s) from trash in postgres: %s", id, err.Error())
+		if restored.StorageKey != file.StorageKey {
+			if err := s.storage.Move(ctx, restored.StorageKey, file.StorageKey); err != nil {
+				s.logger.Sugar().Errorf("failed to move file(%s) back to trash in storage: %s", id, err.Error())
+			}
+		}
+		return nil, errInternal
+	}
+
+	s.clearCache(ctx, &restored)
+
+	return &restored, nil
 }
 
-func (s *FileService) deleteFiles(paths []string) error {
-	endpoint := "/files"
-	url := viper.GetString("fileStorage.origin") + endpoint
+// freeFileName returns name or the first "name (n).ext" that is not taken in the folder
+func (s *FileService) freeFileName(ctx context.Context, folderID, name string) (string, error) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
 
-	jsonBody, err := json.Marshal(paths)
-	if err != nil {
-		return fmt.Errorf("failed to marshal JSON request body: %s", err.Error())
+	candidate := name
+	for n := 1; ; n++ {
+		taken, err := s.folderService.hasFile(ctx, folderID, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		candidate = fmt.Sprintf("%s (%d)%s", base, n, ext)
 	}
-	
-	req, err := http.NewRequest(http.MethodDelete, url, bytes.NewReader(jsonBody))
+}
+
+// Purge deletes the trashed file for good
+func (s *FileService) Purge(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) error {
+	file, err := s.FindByID(ctx, id)
 	if err != nil {
-		return fmt.Errorf("failed to create new HTTP request for file-storage: %s", err.Error())
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Internal-Token", os.Getenv("X_INTERNAL_TOKEN"))
 
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to do file-storage request: %s", err.Error())
+	if file.DeletedAt == nil {
+		return errNotInTrash
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	if file.CreatorID != userSpace.UserID && userRole != "ADMIN" {
+		return errNoAccess
+	}
+
+	return s.purge(ctx, file)
+}
+
+// purge deletes the file, deduplicated blobs are only deleted once nothing references them anymore
+func (s *FileService) purge(ctx context.Context, file *model.File) error {
+	orphans, err := s.repo.Postgres.File.Delete(ctx, file.ID)
 	if err != nil {
-		return fmt.Errorf("failed to read response body from file-storage: %s", err.Error())
+		s.logger.Sugar().Errorf("failed to delete file(%s) from postgres: %s", file.ID, err.Error())
+		return errInternal
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		var bodyJSON map[string]interface{}
-        if err := json.Unmarshal(body, &bodyJSON); err != nil {
-            return fmt.Errorf("failed to decode error response from file-storage: %s", err.Error())
-        }
-		return fmt.Errorf("ERROR from file-storage endpoint(%s), code(%d), details: %s", endpoint, resp.StatusCode, bodyJSON["details"])
+	if err := s.storage.Delete(ctx, fileKeys(file)...); err != nil {
+		s.logger.Sugar().Errorf("failed to delete file(%s) from storage: %s", file.ID, err.Error())
 	}
+	s.blobs.deleteOrphans(ctx, orphans)
+
+	s.clearCache(ctx, file)
 
 	return nil
 }
 
+// clearCache clears the cached file and the lists and space size it is counted in
+func (s *FileService) clearCache(ctx context.Context, file *model.File) {
+	keys := []string{FilePrefix(file.ID), UserFilesPrefix(file.CreatorID), SpacePrefix(file.CreatorID), SpaceSizePrefix(file.CreatorID)}
+	if file.FolderID != nil {
+		keys = append(keys, FolderContentsPrefix(*file.FolderID))
+	}
+
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear file(%s) cache in redis: %s", file.ID, err.Error())
+	}
+	s.folderService.clearStatsCache(ctx, file.FolderID)
+}
+
 func (s *FileService) DeletePermission(ctx context.Context, d DeletePermissionData) error {
 	file, err := s.FindByID(ctx, d.ResourceID)
 	if err != nil {
 		return err
 	}
 
-	if d.UserID != file.CreatorID && d.UserRole != "ADMIN" {
+	role, err := s.access(ctx, file, d.UserRole, d.UserSpace)
+	if err != nil {
+		return err
+	}
+	if !atLeast(role, model.RoleManager) {
 		return errNoAccess
 	}
 
 	// Clear cache
-	if err := s.rdb.Del(ctx, FilePermissionPrefix(file.ID, d.UserToDeleteName), FilePermissionsPrefix(file.ID)).Err(); err != nil {
+	if err := s.rdb.Del(ctx, FilePermissionPrefix(file.ID, d.UserToDeleteName), FilePermissionsPrefix(file.ID), SharedPrefix(d.UserToDeleteName)).Err(); err != nil {
+		return err
+	}
+
+	if err := s.invitationService.withdraw(ctx, "file", file.ID, d.UserToDeleteName); err != nil {
 		return err
 	}
 
 	return s.repo.Postgres.File.DeletePermission(ctx, d.ResourceID, d.UserToDeleteName)
 }
 
-func (s *FileService) FindPermissionsToFile(ctx context.Context, fileID, creatorID string) ([]*string, error) {
-	permissionsCache, err := redisrepo.GetMany[string](s.rdb, ctx, FilePermissionsPrefix(fileID))
+// FindPermissionsToFile returns the users the file is shared with and their roles
+func (s *FileService) FindPermissionsToFile(ctx context.Context, fileID, userRole string, userSpace model.FullUserSpace) ([]*model.Permission, error) {
+	file, err := s.FindByID(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := s.access(ctx, file, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+	if !atLeast(role, model.RoleManager) {
+		return nil, errNoAccess
+	}
+
+	permissionsCache, err := redisrepo.GetMany[model.Permission](s.rdb, ctx, FilePermissionsPrefix(fileID))
 	if err == nil {
 		return permissionsCache, nil
 	}
@@ -467,13 +631,13 @@ func (s *FileService) FindPermissionsToFile(ctx context.Context, fileID, creator
 		return nil, err
 	}
 
-	permissions, err := s.repo.Postgres.File.FindPermissionsToFile(ctx, fileID, creatorID)
+	permissions, err := s.repo.Postgres.File.FindPermissionsToFile(ctx, fileID)
 	if err != nil && err != pgx.ErrNoRows {
 		return nil, err
 	}
 
 	// Caching result
-	if err := redisrepo.SetJSON(s.rdb, ctx, FilePermissionsPrefix(fileID), permissions, time.Hour); err != nil {
+	if err := redisrepo.SetJSON(s.rdb, ctx, FilePermissionsPrefix(fileID), permissions, grantTTL(time.Hour, permissionsExpiry(permissions)...)); err != nil {
 		return nil, err
 	}
 
@@ -492,3 +656,188 @@ func (s *FileService) TogglePublic(ctx context.Context, id, creatorID string) er
 
 	return nil
 }
+
+// Move puts the file into the folder with folderID or to the root if it is nil
+func (s *FileService) Move(ctx context.Context, id, userID string, folderID *string) (*model.File, error) {
+	file, err := s.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.DeletedAt != nil {
+		return nil, errFileNotFound
+	}
+
+	if file.CreatorID != userID {
+		return nil, errNoAccess
+	}
+
+	if sameFolder(file.FolderID, folderID) {
+		return file, nil
+	}
+
+	moved := *file
+	if err := s.place(ctx, &moved, folderID); err != nil {
+		return nil, err
+	}
+
+	if moved.StorageKey != file.StorageKey {
+		if err := s.storage.Move(ctx, file.StorageKey, moved.StorageKey); err != nil {
+			s.logger.Sugar().Errorf("failed to move file(%s) in storage: %s", id, err.Error())
+			return nil, errInternal
+		}
+	}
+
+	permissions, err := s.repo.Postgres.File.Move(ctx, &moved)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to move file(%s) in postgres: %s", id, err.Error())
+		if moved.StorageKey != file.StorageKey {
+			if err := s.storage.Move(ctx, moved.StorageKey, file.StorageKey); err != nil {
+				s.logger.Sugar().Errorf("failed to move file(%s) back in storage: %s", id, err.Error())
+			}
+		}
+		return nil, errInternal
+	}
+
+	// Clear cache
+	keys := []string{FilePrefix(id), FilePermissionsPrefix(id), UserFilesPrefix(file.CreatorID)}
+	for _, folderID := range []*string{file.FolderID, moved.FolderID} {
+		if folderID != nil {
+			keys = append(keys, FolderContentsPrefix(*folderID))
+		}
+		s.folderService.clearStatsCache(ctx, folderID)
+	}
+	for _, p := range permissions {
+		keys = append(keys, FilePermissionPrefix(p.ResourceID, p.Username), SharedPrefix(p.Username))
+	}
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear file(%s) cache in redis: %s", id, err.Error())
+	}
+
+	return &moved, nil
+}
+
+// Copy creates a copy of the file in the folder with folderID or in the root if it is nil
+func (s *FileService) Copy(ctx context.Context, id string, userSpace model.FullUserSpace, folderID *string) (*model.File, error) {
+	file, err := s.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.DeletedAt != nil {
+		return nil, errFileNotFound
+	}
+
+	if file.CreatorID != userSpace.UserID {
+		return nil, errNoAccess
+	}
+
+	if file.Size > levelSpaceSizes[userSpace.Level].maxFileSize {
+		return nil, errFileIsTooBig
+	}
+
+	if userSpace.Size + file.Size > levelSpaceSizes[userSpace.Level].maxSpaceSize {
+		return nil, errYouDoNotHaveEnoughSpace
+	}
+
+	newID, err := newID(ctx, s.hasher, file.CreatorID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to hash user(%s)'s file ID: %s", file.CreatorID, err.Error())
+		return nil, errInternal
+	}
+
+	fileCopy := *file
+	fileCopy.ID = newID
+	fileCopy.Version = 1
+	fileCopy.DateAdded = time.Now()
+	if err := s.place(ctx, &fileCopy, folderID); err != nil {
+		return nil, err
+	}
+
+	// A copy of a deduplicated file shares its blob
+	if file.Checksum != nil {
+		if _, err := s.blobs.acquire(ctx, *file.Checksum); err != nil {
+			return nil, err
+		}
+	} else if err := s.storage.Copy(ctx, file.StorageKey, fileCopy.StorageKey); err != nil {
+		s.logger.Sugar().Errorf("failed to copy file(%s) in storage: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	if err := s.repo.Postgres.File.Create(ctx, &fileCopy); err != nil {
+		s.logger.Sugar().Errorf("failed to create copy of file(%s) in postgres: %s", id, err.Error())
+		if file.Checksum != nil {
+			s.blobs.release(ctx, *file.Checksum)
+		} else if err := s.storage.Delete(ctx, fileCopy.StorageKey); err != nil {
+			s.logger.Sugar().Errorf("failed to delete copy of file(%s) from storage: %s", id, err.Error())
+		}
+		return nil, errInternal
+	}
+
+	// Clear cache
+	keys := []string{UserFilesPrefix(file.CreatorID), SpacePrefix(file.CreatorID), SpaceSizePrefix(file.CreatorID)}
+	if fileCopy.FolderID != nil {
+		keys = append(keys, FolderContentsPrefix(*fileCopy.FolderID))
+	}
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear user(%s) files cache in redis: %s", file.CreatorID, err.Error())
+	}
+	s.folderService.clearStatsCache(ctx, fileCopy.FolderID)
+
+	return &fileCopy, nil
+}
+
+// place sets the location of f to the folder with folderID or to the root if it is nil,
+// the storage key of a deduplicated file does not depend on its location and stays the same
+func (s *FileService) place(ctx context.Context, f *model.File, folderID *string) error {
+	if folderID == nil {
+		f.FolderID = nil
+		f.MainFolderID = nil
+		if f.Public == nil {
+			f.Public = new(bool)
+		}
+		f.Filename = new(string)
+		*f.Filename = uuid.NewString() + filepath.Ext(f.DownloadName)
+		if f.Checksum == nil {
+			f.StorageKey = f.CreatorID + "/" + *f.Filename
+		}
+		return nil
+	}
+
+	folder, err := s.folderService.findByID(ctx, *folderID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return errFolderNotFound
+		}
+		return err
+	}
+
+	if folder.DeletedAt != nil {
+		return errFolderNotFound
+	}
+
+	if folder.CreatorID != f.CreatorID {
+		return errNoAccess
+	}
+
+	hasFile, err := s.folderService.hasFile(ctx, folder.ID, f.DownloadName)
+	if err != nil {
+		return err
+	}
+	if hasFile {
+		return errTheFileWithThatNameAlreadyExists
+	}
+
+	f.FolderID = &folder.ID
+	f.MainFolderID = folder.MainFolderID
+	if f.MainFolderID == nil {
+		f.MainFolderID = &folder.ID
+	}
+	f.Public = nil
+	f.Filename = nil
+	if f.Checksum == nil {
+		f.StorageKey = folder.StorageKey + "/" + f.DownloadName
+	}
+
+	return nil
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"math"
+	"mime/multipart"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/File-Sharer/file-service/internal/model"
+)
+
+const (
+	maxExtractEntries = 10000
+	// maxCompressionRatio caps how much bigger the content of an archive may be than the archive itself
+	maxCompressionRatio = 1000
+)
+
+// archiveHeader is an entry of a ZIP or TAR archive, Size is the size the archive declares for it
+type archiveHeader struct {
+	Name    string
+	Dir     bool
+	Regular bool
+	Size    int64
+}
+
+// Extract creates a folder named after the archive in the folder and unpacks the ZIP, TAR or TAR.GZ archive into it
+func (s *FileService) Extract(ctx context.Context, userRole string, userSpace model.FullUserSpace, fileObj model.File, file multipart.File, fileHeader *multipart.FileHeader) (*model.ExtractReport, error) {
+	if archiveFormat(fileHeader.Filename) == "" && archiveFormat(fileObj.DownloadName) == "" {
+		return nil, errUnsupportedArchive
+	}
+
+	targetSpace, err := s.uploadTarget(ctx, fileObj.FolderID, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUpload(ctx, userSpace.UserID, targetSpace, fileHeader.Size); err != nil {
+		return nil, err
+	}
+
+	return s.extract(ctx, userRole, userSpace, targetSpace, fileObj, file, fileHeader)
+}
+
+// extract unpacks the archive without checking the user's creating files delay, the whole archive must fit targetSpace
+// before anything is created and everything extracted belongs to its owner. Entries that fail are reported and skipped
+func (s *FileService) extract(ctx context.Context, userRole string, userSpace model.FullUserSpace, targetSpace model.FullUserSpace, fileObj model.File, file multipart.File, fileHeader *multipart.FileHeader) (*model.ExtractReport, error) {
+	format := archiveFormat(fileHeader.Filename)
+	if format == "" {
+		format = archiveFormat(fileObj.DownloadName)
+	}
+	if format == "" {
+		return nil, errUnsupportedArchive
+	}
+
+	name := strings.TrimSpace(fileObj.DownloadName)
+	if ext := archiveFormat(name); ext != "" {
+		name = name[:len(name) - len(ext)]
+	}
+	if !validName(name) {
+		return nil, errInvalidName
+	}
+
+	// Sizes declared by the archive are checked before anything is created, the content is held to them while extracting
+	var total int64
+	entries := 0
+	freeSpace := levelSpaceSizes[targetSpace.Level].maxSpaceSize - targetSpace.Size
+	if err := walkArchive(file, fileHeader.Size, format, func(h archiveHeader, _ io.Reader) error {
+		entries++
+		if entries > maxExtractEntries {
+			return errTooManyArchiveEntries
+		}
+		if !h.Regular {
+			return nil
+		}
+
+		if h.Size > freeSpace - total {
+			return errYouDoNotHaveEnoughSpace
+		}
+		total += h.Size
+
+		if total > fileHeader.Size * maxCompressionRatio {
+			return errArchiveIsTooCompressed
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	root, err := s.folderService.Create(ctx, model.Folder{
+		FolderID: fileObj.FolderID,
+		CreatorID: targetSpace.UserID,
+		Name: name,
+		Public: fileObj.Public,
+	}, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.ExtractReport{Folder: root}
+	addResult := func(entryPath, entryType, id string, err error) {
+		result := &model.ExtractResult{Path: entryPath, Type: entryType, ID: id}
+		if err != nil {
+			result.Error = err.Error()
+			report.Failed++
+		} else {
+			report.Extracted++
+		}
+		report.Entries = append(report.Entries, result)
+	}
+
+	// Folders are created as entries need them, archives do not always list the folders of their files
+	folderIDs := map[string]string{".": root.ID}
+	folderErrs := map[string]error{}
+	var folderFor func(dir string) (string, error)
+	folderFor = func(dir string) (string, error) {
+		if id, ok := folderIDs[dir]; ok {
+			return id, nil
+		}
+		if err, ok := folderErrs[dir]; ok {
+			return "", err
+		}
+
+		parentID, err := folderFor(path.Dir(dir))
+		if err != nil {
+			folderErrs[dir] = err
+			return "", err
+		}
+
+		folder, err := s.folderService.Create(ctx, model.Folder{FolderID: &parentID, CreatorID: targetSpace.UserID, Name: path.Base(dir)}, userRole, userSpace)
+		if err != nil {
+			folderErrs[dir] = err
+			addResult(dir, "folder", "", err)
+			return "", err
+		}
+
+		folderIDs[dir] = folder.ID
+		addResult(dir, "folder", folder.ID, nil)
+		return folder.ID, nil
+	}
+
+	err = walkArchive(file, fileHeader.Size, format, func(h archiveHeader, r io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		entryPath, ok := cleanEntryPath(h.Name)
+		if !ok {
+			addResult(h.Name, entryType(h), "", errUnsafeArchivePath)
+			return nil
+		}
+		if entryPath == "." {
+			return nil
+		}
+
+		if h.Dir {
+			// A failed folder is reported by folderFor
+			folderFor(entryPath)
+			return nil
+		}
+
+		if !h.Regular {
+			addResult(entryPath, "file", "", errUnsupportedArchiveEntry)
+			return nil
+		}
+
+		folderID, err := folderFor(path.Dir(entryPath))
+		if err != nil {
+			addResult(entryPath, "file", "", err)
+			return nil
+		}
+
+		created, err := s.extractFile(ctx, targetSpace, folderID, path.Base(entryPath), h.Size, r)
+		if err != nil {
+			addResult(entryPath, "file", "", err)
+			return nil
+		}
+
+		targetSpace.Size += created.Size
+		addResult(entryPath, "file", created.ID, nil)
+		return nil
+	})
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	return report, nil
+}
+
+// extractFile saves the content of an archive entry as a file in the folder, the content must be of the declared size
+func (s *FileService) extractFile(ctx context.Context, targetSpace model.FullUserSpace, folderID, name string, size int64, r io.Reader) (*model.File, error) {
+	if size == 0 {
+		return nil, errFileHasNoData
+	}
+	if size > levelSpaceSizes[targetSpace.Level].maxFileSize {
+		return nil, errFileIsTooBig
+	}
+
+	tmp, err := os.CreateTemp("", "extract-*")
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to create temp file for archive entry(%s): %s", name, err.Error())
+		return nil, errInternal
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	limited := newSizeLimitReader(r, size)
+	n, err := io.Copy(tmp, limited)
+	if limited.exceeded() || (err == nil && n != size) {
+		return nil, errArchiveEntrySizeMismatch
+	}
+	if err != nil {
+		return nil, errInvalidArchive
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		s.logger.Sugar().Errorf("failed to seek temp file of archive entry(%s): %s", name, err.Error())
+		return nil, errInternal
+	}
+
+	return s.create(ctx, targetSpace, model.File{
+		FolderID: &folderID,
+		CreatorID: targetSpace.UserID,
+		DownloadName: name,
+	}, tmp, &multipart.FileHeader{Filename: name, Size: size})
+}
+
+// walkArchive calls fn for every entry of the archive in order, r reads the content of the entry.
+// Errors of fn are returned as they are, an unreadable archive gives errInvalidArchive
+func walkArchive(file multipart.File, size int64, format string, fn func(h archiveHeader, r io.Reader) error) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return errInvalidArchive
+	}
+
+	if format == ".zip" {
+		zr, err := zip.NewReader(file, size)
+		if err != nil {
+			return errInvalidArchive
+		}
+
+		for _, f := range zr.File {
+			h := archiveHeader{
+				Name: f.Name,
+				Dir: f.FileInfo().IsDir(),
+				Regular: f.Mode().IsRegular(),
+				Size: int64(min(f.UncompressedSize64, math.MaxInt64)),
+			}
+
+			// An entry that can't be opened fails on its own, the others are still extracted
+			rc, err := f.Open()
+			if err != nil {
+				if err := fn(h, failedReader{err: errInvalidArchive}); err != nil {
+					return err
+				}
+				continue
+			}
+			err = fn(h, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var r io.Reader = file
+	if format == ".tar.gz" || format == ".tgz" {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return errInvalidArchive
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errInvalidArchive
+		}
+
+		if err := fn(archiveHeader{
+			Name: hdr.Name,
+			Dir: hdr.Typeflag == tar.TypeDir,
+			Regular: hdr.Typeflag == tar.TypeReg,
+			Size: hdr.Size,
+		}, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveFormat returns the archive extension of the name, or "" for a name of no supported archive
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+
+	return ""
+}
+
+// cleanEntryPath returns the slash separated path of an archive entry relative to the folder it is extracted to,
+// paths that are absolute, climb out with ".." or have names that are not valid are refused
+func cleanEntryPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", false
+	}
+
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		if !validName(part) {
+			return "", false
+		}
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return ".", true
+	}
+
+	return strings.Join(parts, "/"), true
+}
+
+func entryType(h archiveHeader) string {
+	if h.Dir {
+		return "folder"
+	}
+	return "file"
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/spf13/viper"
+)
+
+// versionsKey is the storage key the archived versions of the file are kept under
+func versionsKey(userID, fileID string) string {
+	return userID + "/.versions/" + fileID
+}
+
+func versionKey(userID, fileID string, version int) string {
+	return versionsKey(userID, fileID) + "/" + strconv.Itoa(version)
+}
+
+// fileKeys returns the storage keys of the blobs that belong to the file alone, the blob of a file uploaded before
+// deduplication and its archived versions, deduplicated blobs are released instead
+func fileKeys(file *model.File) []string {
+	var keys []string
+	if file.Checksum == nil {
+		keys = append(keys, file.StorageKey)
+	}
+	if file.Version > 1 {
+		keys = append(keys, versionsKey(file.CreatorID, file.ID))
+	}
+	return keys
+}
+
+// CreateVersion uploads a new version of the file, the previous one is kept in the file history
+func (s *FileService) CreateVersion(ctx context.Context, userRole string, userSpace model.FullUserSpace, id string, content io.ReadSeeker, size int64) (*model.File, error) {
+	file, ownerSpace, err := s.editableFile(ctx, id, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkUpload(ctx, userSpace.UserID, ownerSpace, size); err != nil {
+		return nil, err
+	}
+
+	return s.createVersion(ctx, ownerSpace, file, content)
+}
+
+// editableFile returns the file the user may upload versions of and the space of its owner the versions count against
+func (s *FileService) editableFile(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.File, model.FullUserSpace, error) {
+	file, err := s.FindByID(ctx, id)
+	if err != nil {
+		return nil, model.FullUserSpace{}, err
+	}
+
+	if file.DeletedAt != nil {
+		return nil, model.FullUserSpace{}, errFileNotFound
+	}
+
+	role, err := s.access(ctx, file, userRole, userSpace)
+	if err != nil {
+		return nil, model.FullUserSpace{}, err
+	}
+	if !atLeast(role, model.RoleEditor) {
+		return nil, model.FullUserSpace{}, errNoAccess
+	}
+
+	ownerSpace, err := s.ownerSpace(ctx, file.CreatorID, userSpace)
+	if err != nil {
+		return nil, model.FullUserSpace{}, err
+	}
+
+	return file, ownerSpace, nil
+}
+
+func (s *FileService) createVersion(ctx context.Context, targetSpace model.FullUserSpace, file *model.File, content io.ReadSeeker) (*model.File, error) {
+	// The upload is cut off as soon as it outgrows the file size limit or the free space
+	maxSize, maxSizeErr := uploadLimit(targetSpace)
+	blob, err := s.blobs.store(ctx, content, maxSize, maxSizeErr)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.pushVersion(ctx, file, blob)
+}
+
+// GetVersions returns the file history, newest version first
+func (s *FileService) GetVersions(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) ([]*model.FileVersion, error) {
+	file, err := s.ProtectedFindByID(ctx, id, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := s.repo.Postgres.File.FindVersions(ctx, file.ID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find file(%s) versions in postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	return versions, nil
+}
+
+// GetVersion returns the file and its version, the storage key of the version is set for the current one too
+func (s *FileService) GetVersion(ctx context.Context, id string, version int, userRole string, userSpace model.FullUserSpace) (*model.File, *model.FileVersion, error) {
+	file, err := s.ProtectedFindByID(ctx, id, userRole, userSpace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, err := s.findVersion(ctx, id, version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if v.Current {
+		v.StorageKey = &file.StorageKey
+	}
+
+	return file, v, nil
+}
+
+// RestoreVersion makes a copy of the version the new current version of the file
+func (s *FileService) RestoreVersion(ctx context.Context, userRole string, userSpace model.FullUserSpace, id string, version int) (*model.File, error) {
+	file, ownerSpace, err := s.editableFile(ctx, id, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := s.findVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Current {
+		return nil, errVersionIsCurrent
+	}
+
+	if ownerSpace.Size + v.Size > levelSpaceSizes[ownerSpace.Level].maxSpaceSize {
+		return nil, errYouDoNotHaveEnoughSpace
+	}
+
+	// The restored version shares the blob of the old one, versions uploaded before deduplication are deduplicated first
+	var blob *model.Blob
+	if v.Checksum != nil {
+		blob, err = s.blobs.acquire(ctx, *v.Checksum)
+	} else {
+		blob, err = s.blobs.storeFrom(ctx, *v.StorageKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.pushVersion(ctx, file, blob)
+}
+
+func (s *FileService) findVersion(ctx context.Context, id string, version int) (*model.FileVersion, error) {
+	v, err := s.repo.Postgres.File.FindVersion(ctx, id, version)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errVersionNotFound
+		}
+		s.logger.Sugar().Errorf("failed to find file(%s) version %d in postgres: %s", id, version, err.Error())
+		return nil, errInternal
+	}
+
+	return v, nil
+}
+
+// pushVersion archives the current version of the file and makes the blob, which the caller holds a reference to, the new current version
+func (s *FileService) pushVersion(ctx context.Context, file *model.File, blob *model.Blob) (*model.File, error) {
+	// A deduplicated blob is archived as it is, a blob stored under the file name is moved to the versions
+	archiveKey := file.StorageKey
+	if file.Checksum == nil {
+		archiveKey = versionKey(file.CreatorID, file.ID, file.Version)
+		if err := s.storage.Move(ctx, file.StorageKey, archiveKey); err != nil {
+			s.logger.Sugar().Errorf("failed to archive file(%s) version %d in storage: %s", file.ID, file.Version, err.Error())
+			s.blobs.release(ctx, blob.Hash)
+			return nil, errInternal
+		}
+	}
+
+	version, err := s.repo.Postgres.File.AddVersion(ctx, file.ID, archiveKey, *blob)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to add file(%s) version in postgres: %s", file.ID, err.Error())
+		if archiveKey != file.StorageKey {
+			s.moveBlob(ctx, archiveKey, file.StorageKey)
+		}
+		s.blobs.release(ctx, blob.Hash)
+		return nil, errInternal
+	}
+
+	updated := *file
+	updated.Version = version
+	updated.Size = blob.Size
+	updated.StorageKey = blob.StorageKey
+	updated.Checksum = &blob.Hash
+
+	s.pruneVersions(ctx, &updated)
+	s.clearCache(ctx, &updated)
+
+	return &updated, nil
+}
+
+// pruneVersions deletes the oldest archived versions of the file above the "versions.keep" limit
+func (s *FileService) pruneVersions(ctx context.Context, file *model.File) {
+	keep := viper.GetInt("versions.keep")
+	if keep <= 0 {
+		return
+	}
+
+	versions, err := s.repo.Postgres.File.FindVersions(ctx, file.ID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find file(%s) versions in postgres: %s", file.ID, err.Error())
+		return
+	}
+
+	if len(versions) <= keep {
+		return
+	}
+
+	// Versions are sorted newest first and the current one is the newest
+	s.deleteVersions(ctx, file, versions[keep:])
+}
+
+// StartPruningVersions deletes versions that have been archived longer than "versions.keepFor"
+func (s *FileService) StartPruningVersions(ctx context.Context) {
+	keepFor := viper.GetDuration("versions.keepFor")
+	if keepFor <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(viper.GetDuration("versions.pruneInterval"))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			versions, err := s.repo.Postgres.File.FindExpiredVersions(ctx, time.Now().Add(-keepFor))
+			if err != nil {
+				s.logger.Sugar().Errorf("failed to find expired file versions in postgres: %s", err.Error())
+				continue
+			}
+
+			byFile := make(map[string][]*model.FileVersion)
+			for _, v := range versions {
+				byFile[v.FileID] = append(byFile[v.FileID], v)
+			}
+			for fileID, versions := range byFile {
+				file, err := s.FindByID(ctx, fileID)
+				if err != nil {
+					s.logger.Sugar().Errorf("failed to find file(%s): %s", fileID, err.Error())
+					continue
+				}
+				s.deleteVersions(ctx, file, versions)
+			}
+		}
+	}
+}
+
+// deleteVersions deletes archived versions of the file, deduplicated blobs are only deleted once nothing references them anymore
+func (s *FileService) deleteVersions(ctx context.Context, file *model.File, versions []*model.FileVersion) {
+	var keys []string
+	var numbers []int
+	for _, v := range versions {
+		if v.StorageKey == nil {
+			continue
+		}
+		if v.Checksum == nil {
+			keys = append(keys, *v.StorageKey)
+		}
+		numbers = append(numbers, v.Version)
+	}
+
+	if len(numbers) == 0 {
+		return
+	}
+
+	orphans, err := s.repo.Postgres.File.DeleteVersions(ctx, file.ID, numbers)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to delete file(%s) versions from postgres: %s", file.ID, err.Error())
+		return
+	}
+
+	if err := s.storage.Delete(ctx, keys...); err != nil {
+		s.logger.Sugar().Errorf("failed to delete file(%s) versions from storage: %s", file.ID, err.Error())
+	}
+	s.blobs.deleteOrphans(ctx, orphans)
+
+	if err := s.rdb.Del(ctx, SpacePrefix(file.CreatorID), SpaceSizePrefix(file.CreatorID)).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear user(%s) space cache in redis: %s", file.CreatorID, err.Error())
+	}
+}
+
+func (s *FileService) moveBlob(ctx context.Context, srcKey, dstKey string) {
+	if err := s.storage.Move(ctx, srcKey, dstKey); err != nil {
+		s.logger.Sugar().Errorf("failed to move blob(%s) to (%s) in storage: %s", srcKey, dstKey, err.Error())
+	}
+}
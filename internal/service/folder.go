@@ -1,13 +1,10 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
-	"os"
+	"path"
 	"strings"
 	"time"
 
@@ -15,10 +12,9 @@ import (
 	"github.com/File-Sharer/file-service/internal/model"
 	"github.com/File-Sharer/file-service/internal/repository"
 	"github.com/File-Sharer/file-service/internal/repository/redisrepo"
+	"github.com/File-Sharer/file-service/internal/storage"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/redis/go-redis/v9"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -27,18 +23,22 @@ type folderService struct {
 	repo *repository.Repository
 	hasher pb.HasherClient
 	rdb *redis.Client
-	httpClient *http.Client
+	storage storage.Backend
 	userSpaceService UserSpace
+	invitationService Invitation
+	blobs *blobStore
 }
 
-func newFolderService(logger *zap.Logger, repo *repository.Repository, hasher pb.HasherClient, rdb *redis.Client, userSpaceService UserSpace) Folder {
+func newFolderService(logger *zap.Logger, repo *repository.Repository, hasher pb.HasherClient, rdb *redis.Client, store storage.Backend, blobs *blobStore, userSpaceService UserSpace, invitationService Invitation) Folder {
 	return &folderService{
 		logger: logger,
 		repo: repo,
 		hasher: hasher,
 		rdb: rdb,
-		httpClient: &http.Client{},
+		storage: store,
 		userSpaceService: userSpaceService,
+		invitationService: invitationService,
+		blobs: blobs,
 	}
 }
 
@@ -72,7 +72,8 @@ func (s *folderService) hasFolderInFolder(ctx context.Context, folderName, folde
 	return exists, nil
 }
 
-func (s *folderService) Create(ctx context.Context, f model.Folder) (*model.Folder, error) {
+// Create creates a folder, folders created inside a shared folder belong to the owner of the shared folder
+func (s *folderService) Create(ctx context.Context, f model.Folder, userRole string, userSpace model.FullUserSpace) (*model.Folder, error) {
 	resp, err := s.hasher.Hash(ctx, &pb.HashReq{BaseString: f.CreatorID})
 	if err != nil || !resp.Ok {
 		s.logger.Sugar().Errorf("failed to hash for user(%s)'s new folder: %s", f.CreatorID, err.Error())
@@ -87,11 +88,23 @@ func (s *folderService) Create(ctx context.Context, f model.Folder) (*model.Fold
 		parentFolder, err := s.repo.Postgres.Folder.FindByID(ctx, *f.FolderID)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				return nil, nil
+				return nil, errFolderNotFound
 			}
 			s.logger.Sugar().Errorf("failed to find folder(%s) in postgres: %s", *f.FolderID, err.Error())
 			return nil, errInternal
 		}
+		if parentFolder.DeletedAt != nil {
+			return nil, errFolderNotFound
+		}
+
+		role, err := s.access(ctx, parentFolder, userRole, userSpace)
+		if err != nil {
+			return nil, err
+		}
+		if !atLeast(role, model.RoleEditor) {
+			return nil, errNoAccess
+		}
+		f.CreatorID = parentFolder.CreatorID
 		f.MainFolderID = new(string)
 		if parentFolder.MainFolderID == nil {
 			*f.MainFolderID = parentFolder.ID
@@ -99,7 +112,7 @@ func (s *folderService) Create(ctx context.Context, f model.Folder) (*model.Fold
 			*f.MainFolderID = *parentFolder.MainFolderID
 		}
 
-		hasFolder, err := s.hasFolderInFolder(ctx, parentFolder.ID, f.Name)
+		hasFolder, err := s.hasFolderInFolder(ctx, f.Name, parentFolder.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -109,7 +122,7 @@ func (s *folderService) Create(ctx context.Context, f model.Folder) (*model.Fold
 
 		f.Public = nil
 
-		path = strings.Split(parentFolder.URL, viper.GetString("fileStorage.origin") + "/files/")[1] + "/" + f.Name
+		path = parentFolder.StorageKey + "/" + f.Name
 	} else {
 		hasFolder, err := s.hasFolder(ctx, f.CreatorID, f.Name)
 		if err != nil {
@@ -121,69 +134,30 @@ func (s *folderService) Create(ctx context.Context, f model.Folder) (*model.Fold
 	}
 
 	f.CreatedAt = time.Now()
-	f.URL = fmt.Sprintf("%s/files/%s", viper.GetString("fileStorage.origin"), path)
+	f.StorageKey = path
 
 	if err := s.repo.Postgres.Folder.Create(ctx, f); err != nil {
 		s.logger.Sugar().Errorf("failed to create folder for user(%s) in postgres: %s", f.CreatorID, err.Error())
 		return nil, errInternal
 	}
 
-	if err := s.createFolderInFS(path); err != nil {
-		s.logger.Error(err.Error())
+	if err := s.storage.MkdirAll(ctx, path); err != nil {
+		s.logger.Sugar().Errorf("failed to create folder(%s) in storage: %s", f.ID, err.Error())
 		return nil, errInternal
 	}
+	s.clearStatsCache(ctx, f.FolderID)
 
 	return &f, nil
 }
 
-type createFolderReq struct {
-	Path string `json:"path"`
-}
-
-func (s *folderService) createFolderInFS(path string) error {
-	endpoint := "/folders"
-	url := viper.GetString("fileStorage.origin") + endpoint
-
-	bodyJSON, err := json.Marshal(createFolderReq{Path: path})
-	if err != nil {
-		return fmt.Errorf("failed to marshal JSON request body: %s", err.Error())
-	}
-
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(bodyJSON))
-	if err != nil {
-		return fmt.Errorf("failed to create request for file-storage: %s", err.Error())
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Internal-Token", os.Getenv("X_INTERNAL_TOKEN"))
-
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to do file-storage request: %s", err.Error())
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body from file-storage: %s", err.Error())
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		var bodyJSON map[string]interface{}
-        if err := json.Unmarshal(body, &bodyJSON); err != nil {
-            return fmt.Errorf("failed to decode error response from file-storage: %s", err.Error())
-        }
-		return fmt.Errorf("ERROR from file-storage endpoint(%s), code(%d), details: %s", endpoint, resp.StatusCode, bodyJSON["details"])
-	}
-
-	return nil
-}
-
 func (s *folderService) findByID(ctx context.Context, id string) (*model.Folder, error) {
-	folderCache, err := redisrepo.Get[model.Folder](s.rdb, ctx, FolderPrefix(id))
-	if err == nil {
-		return folderCache, nil
+	// Entries cached before they kept the storage key have no folder and are replaced
+	folderCache, err := redisrepo.Get[cachedFolder](s.rdb, ctx, FolderPrefix(id))
+	if err == nil && folderCache != nil && folderCache.Folder != nil {
+		folderCache.Folder.StorageKey = folderCache.StorageKey
+		return folderCache.Folder, nil
 	}
-	if err != redis.Nil {
+	if err != nil && err != redis.Nil {
 		s.logger.Sugar().Errorf("failed to get folder(%s) from redis: %s", id, err.Error())
 		return nil, errInternal
 	}
@@ -197,7 +171,7 @@ func (s *folderService) findByID(ctx context.Context, id string) (*model.Folder,
 		return nil, errInternal
 	}
 
-	if err := redisrepo.SetJSON(s.rdb, ctx, FolderPrefix(id), folder, time.Minute); err != nil {
+	if err := redisrepo.SetJSON(s.rdb, ctx, FolderPrefix(id), cachedFolder{Folder: folder, StorageKey: folder.StorageKey}, time.Minute); err != nil {
 		s.logger.Sugar().Errorf("failed to set folder(%s) in redis: %s", id, err.Error())
 	}
 
@@ -210,180 +184,644 @@ func (s *folderService) ProtectedFindByID(ctx context.Context, id, userRole stri
 		return nil, err
 	}
 
-	if folder.MainFolderID != nil {
-		return nil, nil
+	if folder.DeletedAt != nil {
+		return nil, errFolderNotFound
 	}
 
+	role, err := s.access(ctx, folder, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+	if !atLeast(role, model.RoleViewer) {
+		return nil, errNoAccess
+	}
+
+	return folder, nil
+}
+
+// access returns the role of the user in the folder. Roles are granted on root folders and apply to everything in them,
+// anyone may view a public root folder
+func (s *folderService) access(ctx context.Context, folder *model.Folder, userRole string, userSpace model.FullUserSpace) (string, error) {
 	if folder.CreatorID == userSpace.UserID || userRole == "ADMIN" {
-		return folder, nil
+		return roleOwner, nil
 	}
 
-	if folder.Public != nil && *folder.Public {
-		return folder, nil
+	mainFolder := folder
+	if folder.MainFolderID != nil {
+		var err error
+		mainFolder, err = s.findByID(ctx, *folder.MainFolderID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return "", errFolderNotFound
+			}
+			return "", err
+		}
 	}
 
-	permission, err := s.hasPermission(ctx, id, userSpace.Username)
+	role, err := s.role(ctx, mainFolder.ID, userSpace.Username)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	if permission {
-		return folder, nil
+	if role == "" && mainFolder.Public != nil && *mainFolder.Public {
+		return model.RoleViewer, nil
 	}
 
-	return nil, errNoAccess
+	return role, nil
 }
 
-func (s *folderService) hasPermission(ctx context.Context, id, username string) (bool, error) {
-	permissionCache, err := s.rdb.Get(ctx, FolderPermissionPrefix(id, username)).Bool()
+// role returns the role the user was granted in the root folder, an empty role means no permission
+func (s *folderService) role(ctx context.Context, id, username string) (string, error) {
+	roleCache, err := s.rdb.Get(ctx, FolderPermissionPrefix(id, username)).Result()
 	if err == nil {
-		return permissionCache, nil
+		return roleCache, nil
 	}
 	if err != redis.Nil {
-		s.logger.Sugar().Errorf("failed to get folder(%s) permission for user(%s) from redis: %s", id, username, err.Error())
-		return false, errInternal
+		s.logger.Sugar().Errorf("failed to get folder(%s) role of user(%s) from redis: %s", id, username, err.Error())
+		return "", errInternal
 	}
 
-	permission, err := s.repo.Postgres.Folder.HasPermission(ctx, id, username)
+	role, expiresAt, err := s.repo.Postgres.Folder.GetRole(ctx, id, username)
 	if err != nil {
-		s.logger.Sugar().Errorf("failed to find folder(%s) permisson for user(%s) in postgres: %s", id, username, err.Error())
-		return false, errInternal
+		s.logger.Sugar().Errorf("failed to find folder(%s) role of user(%s) in postgres: %s", id, username, err.Error())
+		return "", errInternal
 	}
 
-	if err := s.rdb.Set(ctx, FolderPermissionPrefix(id, username), permission, time.Minute).Err(); err != nil {
-		s.logger.Sugar().Errorf("failed to set folder(%s) permission for user(%s) in redis: %s", id, username, err.Error())
+	if err := s.rdb.Set(ctx, FolderPermissionPrefix(id, username), role, grantTTL(time.Minute, expiresAt)).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to set folder(%s) role of user(%s) in redis: %s", id, username, err.Error())
 	}
 
-	return permission, nil
+	return role, nil
 }
 
-func (s *folderService) Rename(ctx context.Context, id, userID, newName string) error {
-	if err := s.repo.Postgres.Folder.Update(ctx, id, map[string]interface{}{"name": newName}); err != nil {
+func (s *folderService) Rename(ctx context.Context, id, newName, userRole string, userSpace model.FullUserSpace) error {
+	newName = strings.TrimSpace(newName)
+	if !validName(newName) {
+		return errInvalidName
+	}
+
+	folder, err := s.findByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return errFolderNotFound
+		}
+		return err
+	}
+
+	if folder.DeletedAt != nil {
+		return errFolderNotFound
+	}
+
+	role, err := s.access(ctx, folder, userRole, userSpace)
+	if err != nil {
+		return err
+	}
+	if !atLeast(role, changeRole(folder.MainFolderID)) {
+		return errNoAccess
+	}
+
+	if folder.Name == newName {
+		return nil
+	}
+
+	var hasFolder bool
+	if folder.FolderID != nil {
+		hasFolder, err = s.hasFolderInFolder(ctx, newName, *folder.FolderID)
+	} else {
+		hasFolder, err = s.hasFolder(ctx, folder.CreatorID, newName)
+	}
+	if err != nil {
+		return err
+	}
+	if hasFolder {
+		return errTheFolderWithThatNameAlreadyExists
+	}
+
+	files, folders, err := s.subtree(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+
+	oldKey := folder.StorageKey
+	newKey := path.Join(path.Dir(oldKey), newName)
+
+	if err := s.moveTree(ctx, files, folders, oldKey, newKey); err != nil {
+		s.logger.Sugar().Errorf("failed to move folder(%s) in storage: %s", id, err.Error())
+		return errInternal
+	}
+
+	if err := s.repo.Postgres.Folder.Rename(ctx, id, newName, oldKey, newKey); err != nil {
 		s.logger.Sugar().Errorf("failed to rename folder(%s) in postgres: %s", id, err.Error())
+		if err := s.moveTree(ctx, movedFiles(files, oldKey, newKey), movedFolders(folders, oldKey, newKey), newKey, oldKey); err != nil {
+			s.logger.Sugar().Errorf("failed to move folder(%s) back in storage: %s", id, err.Error())
+		}
 		return errInternal
 	}
 
-	if err := s.rdb.Del(ctx, FolderPrefix(id)).Err(); err != nil {
-		s.logger.Sugar().Errorf("failed to delete cached folder(%s) data from redis: %s", id, err.Error())
+	s.clearTreeCache(ctx, folder, files, folders, nil, nil)
+
+	return nil
+}
+
+// TogglePublic makes the root folder of the user public or private. Anyone can view a public folder with everything in it,
+// so making it public deletes the permissions and pending invitations to it like it does for files
+func (s *folderService) TogglePublic(ctx context.Context, id, creatorID string) error {
+	folder, err := s.findByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return errFolderNotFound
+		}
+		return err
+	}
+
+	if folder.DeletedAt != nil {
+		return errFolderNotFound
+	}
+
+	if folder.CreatorID != creatorID {
+		return errNoAccess
+	}
+
+	if folder.MainFolderID != nil {
+		return errNestedFolderVisibility
+	}
+
+	permissions, err := s.repo.Postgres.Folder.TogglePublic(ctx, id, creatorID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return errFolderNotFound
+		}
+		s.logger.Sugar().Errorf("failed to toggle folder(%s) public field value in postgres: %s", id, err.Error())
+		return errInternal
 	}
 
+	s.clearTreeCache(ctx, folder, nil, []*model.Folder{folder}, nil, permissions)
+
 	return nil
 }
 
-func (s *folderService) GetFolderContents(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.FolderContents, error) {
+// moveTree moves the directory of a folder subtree from oldKey to newKey at once. Backends that can only move blobs
+// one by one move them separately, blobs moved before a failure are moved back.
+// Deduplicated blobs are not stored under the folder and stay where they are
+func (s *folderService) moveTree(ctx context.Context, files []*model.File, folders []*model.Folder, oldKey, newKey string) error {
+	if err := s.storage.MovePrefix(ctx, oldKey, newKey); err != storage.ErrNotSupported {
+		return err
+	}
+
+	for _, f := range folders {
+		if err := s.storage.MkdirAll(ctx, rekey(f.StorageKey, oldKey, newKey)); err != nil {
+			return err
+		}
+	}
+
+	var stored []*model.File
+	for _, f := range files {
+		if underKey(f.StorageKey, oldKey) {
+			stored = append(stored, f)
+		}
+	}
+	files = stored
+
+	for i, f := range files {
+		if err := s.storage.Move(ctx, f.StorageKey, rekey(f.StorageKey, oldKey, newKey)); err != nil {
+			for _, moved := range files[:i] {
+				if err := s.storage.Move(ctx, rekey(moved.StorageKey, oldKey, newKey), moved.StorageKey); err != nil {
+					s.logger.Sugar().Errorf("failed to move file(%s) back in storage: %s", moved.ID, err.Error())
+				}
+			}
+			return err
+		}
+	}
+
+	// Removing the emptied old directory
+	if err := s.storage.Delete(ctx, oldKey); err != nil {
+		s.logger.Sugar().Errorf("failed to delete old directory(%s) from storage: %s", oldKey, err.Error())
+	}
+
+	return nil
+}
+
+// movedFiles returns copies of files with their storage keys rewritten from oldKey to newKey
+func movedFiles(files []*model.File, oldKey, newKey string) []*model.File {
+	moved := make([]*model.File, len(files))
+	for i, f := range files {
+		c := *f
+		c.StorageKey = rekey(f.StorageKey, oldKey, newKey)
+		moved[i] = &c
+	}
+	return moved
+}
+
+// movedFolders returns copies of folders with their storage keys rewritten from oldKey to newKey
+func movedFolders(folders []*model.Folder, oldKey, newKey string) []*model.Folder {
+	moved := make([]*model.Folder, len(folders))
+	for i, f := range folders {
+		c := *f
+		c.StorageKey = rekey(f.StorageKey, oldKey, newKey)
+		moved[i] = &c
+	}
+	return moved
+}
+
+// rekey replaces the oldKey prefix of key with newKey, keys that are not under oldKey stay the same
+func rekey(key, oldKey, newKey string) string {
+	if !underKey(key, oldKey) {
+		return key
+	}
+	return newKey + strings.TrimPrefix(key, oldKey)
+}
+
+// underKey reports whether key is dir or somewhere under it
+func underKey(key, dir string) bool {
+	return key == dir || strings.HasPrefix(key, dir + "/")
+}
+
+// validName reports whether name can be used as a file or folder name
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
+
+// newID hashes a new resource ID for the user
+func newID(ctx context.Context, hasher pb.HasherClient, userID string) (string, error) {
+	resp, err := hasher.Hash(ctx, &pb.HashReq{BaseString: userID})
+	if err != nil {
+		return "", err
+	}
+	if !resp.GetOk() {
+		return "", fmt.Errorf("hasher responded with not ok")
+	}
+
+	return resp.GetHash(), nil
+}
+
+// sameFolder reports whether both IDs point to the same folder, nil is the root
+func sameFolder(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// Move puts the folder with everything in it into the folder with folderID or to the root if it is nil
+func (s *folderService) Move(ctx context.Context, id, userID string, folderID *string) (*model.Folder, error) {
 	folder, err := s.findByID(ctx, id)
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errFolderNotFound
+		}
 		return nil, err
 	}
 
-	mainFolderID := id
-	if folder.MainFolderID != nil {
-		mainFolderID = *folder.MainFolderID
+	if folder.DeletedAt != nil {
+		return nil, errFolderNotFound
+	}
+
+	if folder.CreatorID != userID {
+		return nil, errNoAccess
 	}
 
-	mainFolder, err := s.findByID(ctx, mainFolderID)
+	if sameFolder(folder.FolderID, folderID) {
+		return folder, nil
+	}
+
+	files, folders, err := s.subtree(ctx, id, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	hasPermission, err := s.hasPermission(ctx, mainFolderID, userSpace.UserID)
+	moved := *folder
+	if err := s.place(ctx, &moved, folderID, folders); err != nil {
+		return nil, err
+	}
+
+	if err := s.moveTree(ctx, files, folders, folder.StorageKey, moved.StorageKey); err != nil {
+		s.logger.Sugar().Errorf("failed to move folder(%s) in storage: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	filePermissions, folderPermissions, err := s.repo.Postgres.Folder.Move(ctx, moved, folder.StorageKey)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, errNoAccess
+		s.logger.Sugar().Errorf("failed to move folder(%s) in postgres: %s", id, err.Error())
+		if err := s.moveTree(ctx, movedFiles(files, folder.StorageKey, moved.StorageKey), movedFolders(folders, folder.StorageKey, moved.StorageKey), moved.StorageKey, folder.StorageKey); err != nil {
+			s.logger.Sugar().Errorf("failed to move folder(%s) back in storage: %s", id, err.Error())
 		}
-		s.logger.Sugar().Errorf("failed to get permission for folder(%s) to user(%s) from postgres: %s", id, userSpace.UserID ,err.Error())
 		return nil, errInternal
 	}
-	if !hasPermission && mainFolder.CreatorID != userSpace.UserID && userRole != "ADMIN" {
+
+	s.clearTreeCache(ctx, folder, files, folders, filePermissions, folderPermissions)
+	if moved.FolderID != nil {
+		if err := s.rdb.Del(ctx, FolderContentsPrefix(*moved.FolderID)).Err(); err != nil {
+			s.logger.Sugar().Errorf("failed to clear folder(%s) contents cache in redis: %s", *moved.FolderID, err.Error())
+		}
+		s.clearStatsCache(ctx, moved.FolderID)
+	}
+
+	return &moved, nil
+}
+
+// Copy creates a copy of the folder with everything in it in the folder with folderID or in the root if it is nil
+func (s *folderService) Copy(ctx context.Context, id string, userSpace model.FullUserSpace, folderID *string) (*model.Folder, error) {
+	folder, err := s.findByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errFolderNotFound
+		}
+		return nil, err
+	}
+
+	if folder.DeletedAt != nil {
+		return nil, errFolderNotFound
+	}
+
+	if folder.CreatorID != userSpace.UserID {
 		return nil, errNoAccess
 	}
 
-	contentsCache, err := redisrepo.Get[model.FolderContents](s.rdb, ctx, FolderContentsPrefix(id))
-	if err == nil {
-		return contentsCache, nil
+	files, folders, err := s.subtree(ctx, id, nil)
+	if err != nil {
+		return nil, err
 	}
-	if err != redis.Nil {
-		s.logger.Sugar().Errorf("failed to get folder(%s) contents from redis: %s", id, err.Error())
-		return nil, errInternal
+
+	var size int64
+	for _, f := range files {
+		size += f.Size
+	}
+	if userSpace.Size + size > levelSpaceSizes[userSpace.Level].maxSpaceSize {
+		return nil, errYouDoNotHaveEnoughSpace
+	}
+
+	folderCopy := *folder
+	if err := s.place(ctx, &folderCopy, folderID, folders); err != nil {
+		return nil, err
+	}
+	oldKey, newKey := folder.StorageKey, folderCopy.StorageKey
+
+	mainFolderID := folderCopy.MainFolderID
+	newIDs := make(map[string]string, len(folders))
+	now := time.Now()
+
+	// The subtree comes parents first, so every parent is copied before its children
+	folderCopies := make([]*model.Folder, 0, len(folders))
+	for _, f := range folders {
+		c := *f
+		if f.ID == folder.ID {
+			c = folderCopy
+		}
+
+		c.ID, err = newID(ctx, s.hasher, c.CreatorID)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to hash for user(%s)'s new folder: %s", c.CreatorID, err.Error())
+			return nil, errInternal
+		}
+		newIDs[f.ID] = c.ID
+
+		if f.ID == folder.ID {
+			mainFolderID = c.MainFolderID
+			if mainFolderID == nil {
+				mainFolderID = &c.ID
+			}
+		} else {
+			parentID := newIDs[*f.FolderID]
+			c.FolderID = &parentID
+			c.MainFolderID = mainFolderID
+			c.StorageKey = rekey(f.StorageKey, oldKey, newKey)
+		}
+		c.CreatedAt = now
+
+		folderCopies = append(folderCopies, &c)
 	}
 
-	files, folders, err := s.repo.Postgres.Folder.GetFolderContents(ctx, id)
+	fileCopies := make([]*model.File, 0, len(files))
+	for _, f := range files {
+		c := *f
+		c.ID, err = newID(ctx, s.hasher, c.CreatorID)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to hash user(%s)'s file ID: %s", c.CreatorID, err.Error())
+			return nil, errInternal
+		}
+
+		parentID := newIDs[*f.FolderID]
+		c.FolderID = &parentID
+		c.MainFolderID = mainFolderID
+		c.StorageKey = rekey(f.StorageKey, oldKey, newKey)
+		c.DateAdded = now
+		c.Version = 1
+
+		fileCopies = append(fileCopies, &c)
+	}
+
+	acquired, err := s.copyTree(ctx, files, fileCopies, folderCopies)
 	if err != nil {
-		s.logger.Sugar().Errorf("failed to get folder(%s) contents from postgres: %s", id, err.Error())
+		s.logger.Sugar().Errorf("failed to copy folder(%s) in storage: %s", id, err.Error())
+		s.blobs.release(ctx, acquired...)
+		if err := s.storage.Delete(ctx, newKey); err != nil {
+			s.logger.Sugar().Errorf("failed to delete copy of folder(%s) from storage: %s", id, err.Error())
+		}
 		return nil, errInternal
 	}
 
-	contents := model.FolderContents{
-		Files: files,
-		Folders: folders,
+	if err := s.repo.Postgres.Folder.CreateTree(ctx, folderCopies, fileCopies); err != nil {
+		s.logger.Sugar().Errorf("failed to create copy of folder(%s) in postgres: %s", id, err.Error())
+		s.blobs.release(ctx, acquired...)
+		if err := s.storage.Delete(ctx, newKey); err != nil {
+			s.logger.Sugar().Errorf("failed to delete copy of folder(%s) from storage: %s", id, err.Error())
+		}
+		return nil, errInternal
 	}
 
-	if err := redisrepo.SetJSON(s.rdb, ctx, FolderContentsPrefix(id), contents, time.Minute * 5); err != nil {
-		s.logger.Sugar().Errorf("failed to set folder(%s) contents in redis: %s", id, err.Error())
+	keys := []string{UserFoldersPrefix(folder.CreatorID), UserFilesPrefix(folder.CreatorID), SpacePrefix(folder.CreatorID), SpaceSizePrefix(folder.CreatorID)}
+	if folderCopy.FolderID != nil {
+		keys = append(keys, FolderContentsPrefix(*folderCopy.FolderID))
 	}
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear user(%s) folders cache in redis: %s", folder.CreatorID, err.Error())
+	}
+	s.clearStatsCache(ctx, folderCopy.FolderID)
 
-	return &contents, nil
+	return folderCopies[0], nil
 }
 
-func (s *folderService) GetUserFolders(ctx context.Context, userID string) ([]*model.Folder, error) {
-	foldersCache, err := redisrepo.GetMany[model.Folder](s.rdb, ctx, UserFoldersPrefix(userID))
-	if err == nil {
-		return foldersCache, nil
+// copyTree creates the copied folders in storage and copies the blobs of files to their copies, copies of deduplicated
+// files share their blobs. The hashes of the blobs acquired for the copies are returned, also when it fails
+func (s *folderService) copyTree(ctx context.Context, files, fileCopies []*model.File, folderCopies []*model.Folder) ([]string, error) {
+	for _, f := range folderCopies {
+		if err := s.storage.MkdirAll(ctx, f.StorageKey); err != nil {
+			return nil, err
+		}
 	}
-	if err != redis.Nil {
-		s.logger.Sugar().Errorf("failed to get user(%s) folders from redis: %s", userID, err.Error())
-		return nil, errInternal
+
+	var acquired []string
+	for i, f := range files {
+		if f.Checksum != nil {
+			if _, err := s.repo.Postgres.Blob.Acquire(ctx, *f.Checksum); err != nil {
+				return acquired, err
+			}
+			acquired = append(acquired, *f.Checksum)
+			continue
+		}
+
+		if err := s.storage.Copy(ctx, f.StorageKey, fileCopies[i].StorageKey); err != nil {
+			return acquired, err
+		}
+	}
+
+	return acquired, nil
+}
+
+// place sets the location of f to the folder with folderID or to the root if it is nil, subtree is every folder in f
+func (s *folderService) place(ctx context.Context, f *model.Folder, folderID *string, subtree []*model.Folder) error {
+	if folderID == nil {
+		hasFolder, err := s.hasFolder(ctx, f.CreatorID, f.Name)
+		if err != nil {
+			return err
+		}
+		if hasFolder {
+			return errTheFolderWithThatNameAlreadyExists
+		}
+
+		f.FolderID = nil
+		f.MainFolderID = nil
+		if f.Public == nil {
+			f.Public = new(bool)
+		}
+		f.StorageKey = fmt.Sprintf("%s/folders/%s", f.CreatorID, f.Name)
+		return nil
+	}
+
+	for _, sub := range subtree {
+		if sub.ID == *folderID {
+			return errCantMoveFolderIntoItself
+		}
+	}
+
+	parent, err := s.findByID(ctx, *folderID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return errFolderNotFound
+		}
+		return err
+	}
+
+	if parent.DeletedAt != nil {
+		return errFolderNotFound
+	}
+
+	if parent.CreatorID != f.CreatorID {
+		return errNoAccess
+	}
+
+	hasFolder, err := s.hasFolderInFolder(ctx, f.Name, parent.ID)
+	if err != nil {
+		return err
+	}
+	if hasFolder {
+		return errTheFolderWithThatNameAlreadyExists
+	}
+
+	f.FolderID = &parent.ID
+	f.MainFolderID = parent.MainFolderID
+	if f.MainFolderID == nil {
+		f.MainFolderID = &parent.ID
+	}
+	f.Public = nil
+	f.StorageKey = parent.StorageKey + "/" + f.Name
+
+	return nil
+}
+
+// GetFolderContents returns a page of the files and folders in the folder, every page is cached in the hash of the folder contents
+func (s *folderService) GetFolderContents(ctx context.Context, id, userRole string, userSpace model.FullUserSpace, q ListQuery) (*model.FolderContents, error) {
+	folder, err := s.findByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	folders, err := s.repo.Postgres.Folder.GetUserFolders(ctx, userID)
+	if folder.DeletedAt != nil {
+		return nil, errFolderNotFound
+	}
+
+	role, err := s.access(ctx, folder, userRole, userSpace)
 	if err != nil {
-		s.logger.Sugar().Errorf("failed to get user(%s) folders from postgres: %s", userID, err.Error())
-		return nil, errInternal	
+		return nil, err
+	}
+	if !atLeast(role, model.RoleViewer) {
+		return nil, errNoAccess
 	}
 
-	if err := redisrepo.SetJSON(s.rdb, ctx, UserFoldersPrefix(userID), folders, time.Minute * 2); err != nil {
-		s.logger.Sugar().Errorf("failed to set user(%s) folders in redis: %s", userID, err.Error())
+	// Nested items have the visibility of their root folder
+	q.Public = nil
+	lq, err := listQuery(q)
+	if err != nil {
+		return nil, err
 	}
 
-	return folders, nil
+	return cachedPage(ctx, s.rdb, s.logger, FolderContentsPrefix(id), lq, time.Minute * 5, func() (*model.FolderContents, error) {
+		files, folders, next, err := s.repo.Postgres.Folder.GetFolderContents(ctx, id, lq)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to get folder(%s) contents from postgres: %s", id, err.Error())
+			return nil, errInternal
+		}
+
+		return &model.FolderContents{Files: files, Folders: folders, NextCursor: encodeCursor(next)}, nil
+	})
 }
 
-func (s *folderService) AddPermission(ctx context.Context, d AddPermissionData) error {
+// GetUserFolders returns a page of the user's root folders, every page is cached in the hash of the user's folders
+func (s *folderService) GetUserFolders(ctx context.Context, userID string, q ListQuery) (*model.FolderPage, error) {
+	lq, err := listQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	return cachedPage(ctx, s.rdb, s.logger, UserFoldersPrefix(userID), lq, time.Minute * 2, func() (*model.FolderPage, error) {
+		folders, next, err := s.repo.Postgres.Folder.GetUserFolders(ctx, userID, lq)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to get user(%s) folders from postgres: %s", userID, err.Error())
+			return nil, errInternal
+		}
+
+		return &model.FolderPage{Items: folders, NextCursor: encodeCursor(next)}, nil
+	})
+}
+
+// AddPermission invites the user to the folder, users who already have a permission to it or trust the inviter get the new one right away
+func (s *folderService) AddPermission(ctx context.Context, d AddPermissionData) (*model.Invitation, error) {
 	folder, err := s.findByID(ctx, d.ResourceID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Skip if the folder is nested
 	if folder.MainFolderID != nil {
-		return nil
+		return nil, nil
 	}
 
-	if d.UserSpace.UserID != folder.CreatorID && d.UserRole != "ADMIN" {
-		return errNoAccess
+	if !validRole(d.Role) {
+		return nil, errInvalidRole
 	}
 
-	if d.UserToAddName == d.UserSpace.Username {
-		return errCantAddPermissionForYourself
+	if d.ExpiresAt != nil && !d.ExpiresAt.After(time.Now()) {
+		return nil, errExpiryIsInThePast
 	}
 
-	// Clear cache
-	if err := s.rdb.Del(ctx, FolderPermissionPrefix(d.ResourceID, d.UserToAddName), FolderPermissionsPrefix(d.ResourceID)).Err(); err != nil {
-		return err
+	role, err := s.access(ctx, folder, d.UserRole, d.UserSpace)
+	if err != nil {
+		return nil, err
+	}
+	if !atLeast(role, model.RoleManager) {
+		return nil, errNoAccess
 	}
 
-	if err := s.repo.Postgres.Folder.AddPermission(ctx, d.ResourceID, d.UserToAddName); err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok {
-			if pgErr.Code == "23503" {
-				return errUserNotFound
-			}
-		}
-		
-		s.logger.Sugar().Errorf("failed to add permisson to folder(%s) to user(%s) in postgres: %s", d.ResourceID, d.UserToAddName, err.Error())
-		return errInternal
+	if d.UserToAddName == d.UserSpace.Username {
+		return nil, errCantAddPermissionForYourself
 	}
 
-	return nil
+	// Clear cache
+	if err := s.rdb.Del(ctx, FolderPermissionPrefix(d.ResourceID, d.UserToAddName), FolderPermissionsPrefix(d.ResourceID), SharedPrefix(d.UserToAddName)).Err(); err != nil {
+		return nil, err
+	}
+
+	return s.invitationService.invite(ctx, "folder", folder.Name, d)
 }
 
 func (s *folderService) DeletePermission(ctx context.Context, d DeletePermissionData) error {
@@ -392,20 +830,45 @@ func (s *folderService) DeletePermission(ctx context.Context, d DeletePermission
 		return err
 	}
 
-	if d.UserID != folder.CreatorID && d.UserRole != "ADMIN" {
+	role, err := s.access(ctx, folder, d.UserRole, d.UserSpace)
+	if err != nil {
+		return err
+	}
+	if !atLeast(role, model.RoleManager) {
 		return errNoAccess
 	}
 
 	// Clear cache
-	if err := s.rdb.Del(ctx, FolderPermissionPrefix(folder.ID, d.UserToDeleteName), FolderPermissionsPrefix(folder.ID)).Err(); err != nil {
+	if err := s.rdb.Del(ctx, FolderPermissionPrefix(folder.ID, d.UserToDeleteName), FolderPermissionsPrefix(folder.ID), SharedPrefix(d.UserToDeleteName)).Err(); err != nil {
+		return err
+	}
+
+	if err := s.invitationService.withdraw(ctx, "folder", folder.ID, d.UserToDeleteName); err != nil {
 		return err
 	}
 
 	return s.repo.Postgres.Folder.DeletePermission(ctx, folder.ID, d.UserToDeleteName)
 }
 
-func (s *folderService) GetPermissions(ctx context.Context, folderID, userID string) ([]*string, error) {
-	permissionsCache, err := redisrepo.GetMany[string](s.rdb, ctx, FolderPermissionsPrefix(folderID))
+// GetPermissions returns the users the folder is shared with and their roles
+func (s *folderService) GetPermissions(ctx context.Context, folderID, userRole string, userSpace model.FullUserSpace) ([]*model.Permission, error) {
+	folder, err := s.findByID(ctx, folderID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errFolderNotFound
+		}
+		return nil, err
+	}
+
+	role, err := s.access(ctx, folder, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+	if !atLeast(role, model.RoleManager) {
+		return nil, errNoAccess
+	}
+
+	permissionsCache, err := redisrepo.GetMany[model.Permission](s.rdb, ctx, FolderPermissionsPrefix(folderID))
 	if err == nil {
 		return permissionsCache, nil
 	}
@@ -414,15 +877,366 @@ func (s *folderService) GetPermissions(ctx context.Context, folderID, userID str
 		return nil, errInternal
 	}
 
-	permissions, err := s.repo.Postgres.Folder.GetPermissions(ctx, folderID, userID)
+	permissions, err := s.repo.Postgres.Folder.GetPermissions(ctx, folderID)
 	if err != nil {
 		s.logger.Sugar().Errorf("faield to get folder(%s) permissions from postgres: %s", folderID, err.Error())
 		return nil, errInternal
 	}
 
-	if err := redisrepo.SetJSON(s.rdb, ctx, FolderPermissionsPrefix(folderID), permissions, time.Minute * 3); err != nil {
+	if err := redisrepo.SetJSON(s.rdb, ctx, FolderPermissionsPrefix(folderID), permissions, grantTTL(time.Minute * 3, permissionsExpiry(permissions)...)); err != nil {
 		s.logger.Sugar().Errorf("failed to set folder(%s) permissions in redis: %s", folderID, err.Error())
 	}
 
 	return permissions, nil
 }
+
+// Delete moves the folder with everything in it to the trash
+func (s *folderService) Delete(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) error {
+	folder, err := s.findByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return errFolderNotFound
+		}
+		return err
+	}
+
+	if folder.DeletedAt != nil {
+		return errFolderNotFound
+	}
+
+	role, err := s.access(ctx, folder, userRole, userSpace)
+	if err != nil {
+		return err
+	}
+	if !atLeast(role, changeRole(folder.MainFolderID)) {
+		return errNoAccess
+	}
+
+	files, folders, err := s.subtree(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+
+	// Blobs go under the trash key, so the names are free to be used again until the folder is restored
+	key := trashKey(folder.CreatorID, folder.ID)
+	if err := s.moveTree(ctx, files, folders, folder.StorageKey, key); err != nil {
+		s.logger.Sugar().Errorf("failed to move folder(%s) to trash in storage: %s", id, err.Error())
+		return errInternal
+	}
+
+	filePermissions, folderPermissions, err := s.repo.Postgres.Folder.Trash(ctx, id, folder.StorageKey, key)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to move folder(%s) to trash in postgres: %s", id, err.Error())
+		if err := s.moveTree(ctx, movedFiles(files, folder.StorageKey, key), movedFolders(folders, folder.StorageKey, key), key, folder.StorageKey); err != nil {
+			s.logger.Sugar().Errorf("failed to move folder(%s) back from trash in storage: %s", id, err.Error())
+		}
+		return errInternal
+	}
+
+	s.clearTreeCache(ctx, folder, files, folders, filePermissions, folderPermissions)
+
+	return nil
+}
+
+// Restore brings the folder back from the trash with everything trashed together with it,
+// the folder gets a free name if its name was taken in the meantime
+func (s *folderService) Restore(ctx context.Context, id, userID string) (*model.Folder, error) {
+	folder, err := s.findByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errFolderNotFound
+		}
+		return nil, err
+	}
+
+	if folder.DeletedAt == nil {
+		return nil, errNotInTrash
+	}
+
+	if folder.CreatorID != userID {
+		return nil, errNoAccess
+	}
+
+	if folder.FolderID != nil {
+		parent, err := s.findByID(ctx, *folder.FolderID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, errFolderNotFound
+			}
+			return nil, err
+		}
+		if parent.DeletedAt != nil {
+			return nil, errParentFolderIsInTrash
+		}
+	}
+
+	files, folders, err := s.subtree(ctx, id, folder.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := *folder
+	restored.DeletedAt = nil
+	restored.Name, err = s.freeFolderName(ctx, folder.CreatorID, folder.FolderID, folder.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.place(ctx, &restored, folder.FolderID, nil); err != nil {
+		return nil, err
+	}
+
+	if err := s.moveTree(ctx, files, folders, folder.StorageKey, restored.StorageKey); err != nil {
+		s.logger.Sugar().Errorf("failed to restore folder(%s) from trash in storage: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	filePermissions, folderPermissions, err := s.repo.Postgres.Folder.Restore(ctx, restored, folder.StorageKey, *folder.DeletedAt)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to restore folder(%s) from trash in postgres: %s", id, err.Error())
+		if err := s.moveTree(ctx, movedFiles(files, folder.StorageKey, restored.StorageKey), movedFolders(folders, folder.StorageKey, restored.StorageKey), restored.StorageKey, folder.StorageKey); err != nil {
+			s.logger.Sugar().Errorf("failed to move folder(%s) back to trash in storage: %s", id, err.Error())
+		}
+		return nil, errInternal
+	}
+
+	s.clearTreeCache(ctx, &restored, files, folders, filePermissions, folderPermissions)
+
+	return &restored, nil
+}
+
+// freeFolderName returns name or the first "name (n)" that is not taken in the folder with folderID or in the root
+func (s *folderService) freeFolderName(ctx context.Context, userID string, folderID *string, name string) (string, error) {
+	candidate := name
+	for n := 1; ; n++ {
+		var taken bool
+		var err error
+		if folderID != nil {
+			taken, err = s.hasFolderInFolder(ctx, candidate, *folderID)
+		} else {
+			taken, err = s.hasFolder(ctx, userID, candidate)
+		}
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+
+		candidate = fmt.Sprintf("%s (%d)", name, n)
+	}
+}
+
+// Purge deletes the trashed folder with everything in it for good
+func (s *folderService) Purge(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.DeleteReport, error) {
+	folder, err := s.findByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errFolderNotFound
+		}
+		return nil, err
+	}
+
+	if folder.DeletedAt == nil {
+		return nil, errNotInTrash
+	}
+
+	if folder.CreatorID != userSpace.UserID && userRole != "ADMIN" {
+		return nil, errNoAccess
+	}
+
+	return s.purge(ctx, folder)
+}
+
+// subtree returns the files and folders of the folder subtree that were trashed at deletedAt, nil selects the ones not in the trash
+func (s *folderService) subtree(ctx context.Context, id string, deletedAt *time.Time) ([]*model.File, []*model.Folder, error) {
+	files, folders, err := s.repo.Postgres.Folder.GetSubtree(ctx, id)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) subtree from postgres: %s", id, err.Error())
+		return nil, nil, errInternal
+	}
+
+	same := func(t *time.Time) bool {
+		if t == nil || deletedAt == nil {
+			return t == nil && deletedAt == nil
+		}
+		return t.Equal(*deletedAt)
+	}
+
+	var selectedFiles []*model.File
+	for _, f := range files {
+		if same(f.DeletedAt) {
+			selectedFiles = append(selectedFiles, f)
+		}
+	}
+	var selectedFolders []*model.Folder
+	for _, f := range folders {
+		if same(f.DeletedAt) {
+			selectedFolders = append(selectedFolders, f)
+		}
+	}
+
+	return selectedFiles, selectedFolders, nil
+}
+
+// purge deletes the folder with everything in it from storage and postgres, including items trashed earlier
+func (s *folderService) purge(ctx context.Context, folder *model.Folder) (*model.DeleteReport, error) {
+	id := folder.ID
+
+	files, folders, err := s.repo.Postgres.Folder.GetSubtree(ctx, id)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) subtree from postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	report := &model.DeleteReport{}
+
+	// Deleting blobs in batches, files of a failed batch stay untouched
+	var deletedFiles, failedFiles []*model.File
+	for start := 0; start < len(files); start += deleteBatchSize {
+		batch := files[start:min(start + deleteBatchSize, len(files))]
+
+		var keys []string
+		for _, f := range batch {
+			keys = append(keys, fileKeys(f)...)
+		}
+
+		if err := s.storage.Delete(ctx, keys...); err != nil {
+			s.logger.Sugar().Errorf("failed to delete files of folder(%s) from storage: %s", id, err.Error())
+			for _, f := range batch {
+				report.Failed = append(report.Failed, &model.DeleteFailure{ID: f.ID, Type: "file", Error: errFailedToDeleteFileFromStorage.Error()})
+			}
+			failedFiles = append(failedFiles, batch...)
+			continue
+		}
+
+		deletedFiles = append(deletedFiles, batch...)
+	}
+
+	// Folders that still contain files are kept
+	parents := make(map[string]*string, len(folders))
+	for _, f := range folders {
+		parents[f.ID] = f.FolderID
+	}
+	kept := make(map[string]bool)
+	for _, f := range failedFiles {
+		for folderID := f.FolderID; folderID != nil && !kept[*folderID]; folderID = parents[*folderID] {
+			if _, inTree := parents[*folderID]; !inTree {
+				break
+			}
+			kept[*folderID] = true
+		}
+	}
+
+	var deletedFolders []*model.Folder
+	for _, f := range folders {
+		if kept[f.ID] {
+			report.Failed = append(report.Failed, &model.DeleteFailure{ID: f.ID, Type: "folder", Error: errFolderIsNotEmpty.Error()})
+			continue
+		}
+		deletedFolders = append(deletedFolders, f)
+	}
+
+	fileIDs := make([]string, len(deletedFiles))
+	for i, f := range deletedFiles {
+		fileIDs[i] = f.ID
+	}
+	folderIDs := make([]string, len(deletedFolders))
+	for i, f := range deletedFolders {
+		folderIDs[i] = f.ID
+	}
+
+	filePermissions, folderPermissions, orphans, err := s.repo.Postgres.Folder.DeleteTree(ctx, fileIDs, folderIDs)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to delete folder(%s) tree from postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+	s.blobs.deleteOrphans(ctx, orphans)
+	report.DeletedFiles = len(deletedFiles)
+	report.DeletedFolders = len(deletedFolders)
+
+	// Removing the emptied directories, subfolders trashed on their own have them under their trash keys
+	var dirs []string
+	for _, f := range deletedFolders {
+		if f.ID == folder.ID || f.StorageKey == trashKey(f.CreatorID, f.ID) {
+			dirs = append(dirs, f.StorageKey)
+		}
+	}
+	if err := s.storage.Delete(ctx, dirs...); err != nil {
+		s.logger.Sugar().Errorf("failed to delete folder(%s) directories from storage: %s", id, err.Error())
+	}
+
+	s.clearTreeCache(ctx, folder, deletedFiles, deletedFolders, filePermissions, folderPermissions)
+
+	return report, nil
+}
+
+func (s *folderService) clearTreeCache(ctx context.Context, folder *model.Folder, files []*model.File, folders []*model.Folder, filePermissions, folderPermissions []*model.Permission) {
+	keys := []string{UserFoldersPrefix(folder.CreatorID), SpacePrefix(folder.CreatorID), SpaceSizePrefix(folder.CreatorID)}
+	if folder.FolderID != nil {
+		keys = append(keys, FolderContentsPrefix(*folder.FolderID))
+	}
+
+	for _, f := range files {
+		keys = append(keys, FilePrefix(f.ID), FilePermissionsPrefix(f.ID), SpacePrefix(f.CreatorID), SpaceSizePrefix(f.CreatorID))
+	}
+	for _, f := range folders {
+		keys = append(keys, FolderPrefix(f.ID), FolderContentsPrefix(f.ID), FolderPermissionsPrefix(f.ID), FolderPathPrefix(f.ID), FolderTreePrefix(f.ID), FolderStatsPrefix(f.ID))
+	}
+	for _, p := range filePermissions {
+		keys = append(keys, FilePermissionPrefix(p.ResourceID, p.Username), SharedPrefix(p.Username))
+	}
+	for _, p := range folderPermissions {
+		keys = append(keys, FolderPermissionPrefix(p.ResourceID, p.Username), SharedPrefix(p.Username))
+	}
+
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear folder(%s) tree cache in redis: %s", folder.ID, err.Error())
+	}
+	s.clearStatsCache(ctx, folder.FolderID)
+}
+
+// Zip writes a ZIP archive of everything in the folder to w, blobs are streamed from storage one by one
+func (s *folderService) Zip(ctx context.Context, folder *model.Folder, w io.Writer) error {
+	entries, err := s.zipEntries(ctx, folder, "")
+	if err != nil {
+		return err
+	}
+
+	return writeZip(ctx, s.storage, w, entries)
+}
+
+// zipEntries returns the archive entries of everything in the folder that is not in the trash, named under prefix
+func (s *folderService) zipEntries(ctx context.Context, folder *model.Folder, prefix string) ([]*model.ArchiveEntry, error) {
+	files, folders, err := s.subtree(ctx, folder.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The subtree comes parents first, so every parent has its path before its children.
+	// Items whose parent is not archived have no path and are left out rather than put at the root
+	names := make(map[string]bool)
+	paths := map[string]string{folder.ID: prefix}
+	var entries []*model.ArchiveEntry
+	for _, f := range folders {
+		if f.ID == folder.ID {
+			continue
+		}
+
+		parentPath, ok := paths[*f.FolderID]
+		if !ok {
+			continue
+		}
+		paths[f.ID] = uniqueName(names, parentPath + f.Name) + "/"
+		entries = append(entries, &model.ArchiveEntry{Name: paths[f.ID], Modified: f.CreatedAt})
+	}
+
+	for _, f := range files {
+		parentPath, ok := paths[*f.FolderID]
+		if !ok {
+			continue
+		}
+		entries = append(entries, &model.ArchiveEntry{Name: uniqueName(names, parentPath + zipName(f.DownloadName)), File: f, Modified: f.DateAdded})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/repository/redisrepo"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const maxTreeDepth = 10
+
+// viewableFolder returns the folder that is not in the trash if the user can view it
+func (s *folderService) viewableFolder(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.Folder, error) {
+	folder, err := s.findByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errFolderNotFound
+		}
+		return nil, err
+	}
+
+	if folder.DeletedAt != nil {
+		return nil, errFolderNotFound
+	}
+
+	role, err := s.access(ctx, folder, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+	if !atLeast(role, model.RoleViewer) {
+		return nil, errNoAccess
+	}
+
+	return folder, nil
+}
+
+// GetPath returns the folder and the folders it is nested in for breadcrumbs, the root folder first
+func (s *folderService) GetPath(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) ([]*model.Folder, error) {
+	if _, err := s.viewableFolder(ctx, id, userRole, userSpace); err != nil {
+		return nil, err
+	}
+
+	pathCache, err := redisrepo.GetMany[model.Folder](s.rdb, ctx, FolderPathPrefix(id))
+	if err == nil {
+		return pathCache, nil
+	}
+	if err != redis.Nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) path from redis: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	path, err := s.repo.Postgres.Folder.GetPath(ctx, id)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) path from postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	if err := redisrepo.SetJSON(s.rdb, ctx, FolderPathPrefix(id), path, time.Minute * 5); err != nil {
+		s.logger.Sugar().Errorf("failed to set folder(%s) path in redis: %s", id, err.Error())
+	}
+
+	return path, nil
+}
+
+// GetStats returns the size and the number of files and folders of everything nested in the folder
+func (s *folderService) GetStats(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.FolderStats, error) {
+	if _, err := s.viewableFolder(ctx, id, userRole, userSpace); err != nil {
+		return nil, err
+	}
+
+	statsCache, err := redisrepo.Get[model.FolderStats](s.rdb, ctx, FolderStatsPrefix(id))
+	if err == nil {
+		return statsCache, nil
+	}
+	if err != redis.Nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) stats from redis: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	stats, err := s.repo.Postgres.Folder.GetStats(ctx, []string{id})
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) stats from postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	if err := redisrepo.SetJSON(s.rdb, ctx, FolderStatsPrefix(id), stats[id], time.Minute); err != nil {
+		s.logger.Sugar().Errorf("failed to set folder(%s) stats in redis: %s", id, err.Error())
+	}
+
+	return stats[id], nil
+}
+
+// GetTree returns the folder with the files and folders nested in it down to depth levels, every folder with its stats
+func (s *folderService) GetTree(ctx context.Context, id string, depth int, userRole string, userSpace model.FullUserSpace) (*model.FolderTree, error) {
+	depth = min(max(depth, 1), maxTreeDepth)
+
+	if _, err := s.viewableFolder(ctx, id, userRole, userSpace); err != nil {
+		return nil, err
+	}
+
+	// Trees of the folder are cached per depth in one hash, so they are cleared together
+	field := strconv.Itoa(depth)
+	treeCache, err := s.rdb.HGet(ctx, FolderTreePrefix(id), field).Result()
+	if err == nil {
+		var tree model.FolderTree
+		if err := json.Unmarshal([]byte(treeCache), &tree); err == nil {
+			return &tree, nil
+		}
+	}
+	if err != nil && err != redis.Nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) tree from redis: %s", id, err.Error())
+	}
+
+	files, folders, err := s.repo.Postgres.Folder.GetTree(ctx, id, depth)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) tree from postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	folderIDs := make([]string, len(folders))
+	for i, f := range folders {
+		folderIDs[i] = f.ID
+	}
+	stats, err := s.repo.Postgres.Folder.GetStats(ctx, folderIDs)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) tree stats from postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	// Folders come parents first, so every parent has its node before its children
+	nodes := make(map[string]*model.FolderTree, len(folders))
+	var tree *model.FolderTree
+	for _, f := range folders {
+		node := &model.FolderTree{Folder: *f, Stats: stats[f.ID]}
+		nodes[f.ID] = node
+		if f.ID == id {
+			tree = node
+			continue
+		}
+		parent := nodes[*f.FolderID]
+		parent.Folders = append(parent.Folders, node)
+	}
+	for _, f := range files {
+		parent := nodes[*f.FolderID]
+		parent.Files = append(parent.Files, f)
+	}
+
+	treeJSON, err := json.Marshal(tree)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to marshal folder(%s) tree: %s", id, err.Error())
+		return tree, nil
+	}
+
+	if err := setHashField(ctx, s.rdb, FolderTreePrefix(id), field, treeJSON, time.Minute); err != nil {
+		s.logger.Sugar().Errorf("failed to set folder(%s) tree in redis: %s", id, err.Error())
+	}
+
+	return tree, nil
+}
+
+// clearStatsCache clears the cached trees and stats of the folder and every folder it is nested in,
+// they change with anything added to or removed from the folder. Nothing is cleared for the root
+func (s *folderService) clearStatsCache(ctx context.Context, folderID *string) {
+	if folderID == nil {
+		return
+	}
+
+	path, err := s.repo.Postgres.Folder.GetPath(ctx, *folderID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to get folder(%s) path from postgres: %s", *folderID, err.Error())
+		return
+	}
+
+	if len(path) == 0 {
+		return
+	}
+
+	keys := []string{}
+	for _, f := range path {
+		keys = append(keys, FolderTreePrefix(f.ID), FolderStatsPrefix(f.ID))
+	}
+
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear folder(%s) stats cache in redis: %s", *folderID, err.Error())
+	}
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/File-Sharer/file-service/internal/repository/redisrepo"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type groupService struct {
+	logger *zap.Logger
+	repo *repository.Repository
+	rdb *redis.Client
+	fileService File
+	folderService Folder
+	invitationService Invitation
+}
+
+func newGroupService(logger *zap.Logger, repo *repository.Repository, rdb *redis.Client, fileService File, folderService Folder, invitationService Invitation) Group {
+	return &groupService{
+		logger: logger,
+		repo: repo,
+		rdb: rdb,
+		fileService: fileService,
+		folderService: folderService,
+		invitationService: invitationService,
+	}
+}
+
+func (s *groupService) Create(ctx context.Context, name, userID string) (*model.Group, error) {
+	name = strings.TrimSpace(name)
+	if !validName(name) {
+		return nil, errInvalidName
+	}
+
+	group := &model.Group{
+		ID: uuid.NewString(),
+		OwnerID: userID,
+		Name: name,
+	}
+	if err := s.repo.Postgres.Group.Create(ctx, group); err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok {
+			if pgErr.Code == "23505" {
+				return nil, errGroupAlreadyExists
+			}
+		}
+
+		s.logger.Sugar().Errorf("failed to create group(%s) of user(%s) in postgres: %s", name, userID, err.Error())
+		return nil, errInternal
+	}
+
+	if err := s.rdb.Del(ctx, UserGroupsPrefix(userID)).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear user(%s) groups cache in redis: %s", userID, err.Error())
+	}
+
+	return group, nil
+}
+
+// GetUserGroups returns the groups the user owns, without their members
+func (s *groupService) GetUserGroups(ctx context.Context, userID string) ([]*model.Group, error) {
+	groupsCache, err := redisrepo.GetMany[model.Group](s.rdb, ctx, UserGroupsPrefix(userID))
+	if err == nil {
+		return groupsCache, nil
+	}
+	if err != redis.Nil {
+		s.logger.Sugar().Errorf("failed to get user(%s) groups from redis: %s", userID, err.Error())
+		return nil, errInternal
+	}
+
+	groups, err := s.repo.Postgres.Group.FindByOwner(ctx, userID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find user(%s) groups in postgres: %s", userID, err.Error())
+		return nil, errInternal
+	}
+
+	if err := redisrepo.SetJSON(s.rdb, ctx, UserGroupsPrefix(userID), groups, time.Minute * 5); err != nil {
+		s.logger.Sugar().Errorf("failed to set user(%s) groups in redis: %s", userID, err.Error())
+	}
+
+	return groups, nil
+}
+
+// Get returns the group with its members to its owner
+func (s *groupService) Get(ctx context.Context, id, userRole, userID string) (*model.Group, error) {
+	group, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if group.OwnerID != userID && userRole != "ADMIN" {
+		return nil, errNoAccess
+	}
+
+	return group, nil
+}
+
+func (s *groupService) find(ctx context.Context, id string) (*model.Group, error) {
+	groupCache, err := redisrepo.Get[model.Group](s.rdb, ctx, GroupPrefix(id))
+	if err == nil {
+		return groupCache, nil
+	}
+	if err != redis.Nil {
+		s.logger.Sugar().Errorf("failed to get group(%s) from redis: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	group, err := s.repo.Postgres.Group.FindByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errGroupNotFound
+		}
+		s.logger.Sugar().Errorf("failed to find group(%s) in postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	group.Members, err = s.repo.Postgres.Group.FindMembers(ctx, id)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find group(%s) members in postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	if err := redisrepo.SetJSON(s.rdb, ctx, GroupPrefix(id), group, time.Minute * 5); err != nil {
+		s.logger.Sugar().Errorf("failed to set group(%s) in redis: %s", id, err.Error())
+	}
+
+	return group, nil
+}
+
+// Delete deletes the group, its members lose everything shared with it
+func (s *groupService) Delete(ctx context.Context, id, userRole, userID string) error {
+	group, err := s.Get(ctx, id, userRole, userID)
+	if err != nil {
+		return err
+	}
+
+	permissions, err := s.repo.Postgres.Group.FindGroupPermissions(ctx, id)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find group(%s) permissions in postgres: %s", id, err.Error())
+		return errInternal
+	}
+
+	if err := s.repo.Postgres.Group.Delete(ctx, id); err != nil {
+		s.logger.Sugar().Errorf("failed to delete group(%s) from postgres: %s", id, err.Error())
+		return errInternal
+	}
+
+	keys := []string{GroupPrefix(id), UserGroupsPrefix(group.OwnerID)}
+	for _, username := range group.Members {
+		keys = append(keys, memberKeys(permissions, username)...)
+	}
+	s.clearCache(ctx, id, keys)
+
+	return nil
+}
+
+// AddMember invites the user to the group, users who are a member already or trust the inviter join right away and nil is returned.
+// Only members get what is shared with the group
+func (s *groupService) AddMember(ctx context.Context, id, username, userRole string, userSpace model.FullUserSpace) (*model.Invitation, error) {
+	group, err := s.Get(ctx, id, userRole, userSpace.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation, err := s.invitationService.invite(ctx, "group", group.Name, AddPermissionData{
+		ResourceID: id,
+		UserSpace: userSpace,
+		UserRole: userRole,
+		UserToAddName: username,
+		Role: model.GroupMemberRole,
+	})
+	if err != nil || invitation != nil {
+		return invitation, err
+	}
+
+	return nil, s.clearMemberCache(ctx, id, username)
+}
+
+// DeleteMember removes the user from the group or withdraws the pending invitation of the user to it
+func (s *groupService) DeleteMember(ctx context.Context, id, username, userRole, userID string) error {
+	if _, err := s.Get(ctx, id, userRole, userID); err != nil {
+		return err
+	}
+
+	if err := s.invitationService.withdraw(ctx, "group", id, username); err != nil {
+		return err
+	}
+
+	if err := s.repo.Postgres.Group.DeleteMember(ctx, id, username); err != nil {
+		s.logger.Sugar().Errorf("failed to delete user(%s) from group(%s) in postgres: %s", username, id, err.Error())
+		return errInternal
+	}
+
+	return s.clearMemberCache(ctx, id, username)
+}
+
+// clearMemberCache clears the cached roles of the user in everything shared with the group
+func (s *groupService) clearMemberCache(ctx context.Context, id, username string) error {
+	permissions, err := s.repo.Postgres.Group.FindGroupPermissions(ctx, id)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find group(%s) permissions in postgres: %s", id, err.Error())
+		return errInternal
+	}
+
+	s.clearCache(ctx, id, append(memberKeys(permissions, username), GroupPrefix(id)))
+
+	return nil
+}
+
+// AddPermission grants the role to every member of the group, the group must be the user's and the user must manage the file or folder
+func (s *groupService) AddPermission(ctx context.Context, d AddGroupPermissionData) error {
+	if !validRole(d.Role) {
+		return errInvalidRole
+	}
+
+	if d.ExpiresAt != nil && !d.ExpiresAt.After(time.Now()) {
+		return errExpiryIsInThePast
+	}
+
+	nested, err := s.manage(ctx, d.ResourceType, d.ResourceID, d.UserRole, d.UserSpace)
+	if err != nil {
+		return err
+	}
+
+	// Skip if the file or folder is nested
+	if nested {
+		return nil
+	}
+
+	group, err := s.Get(ctx, d.GroupID, d.UserRole, d.UserSpace.UserID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Postgres.Group.AddPermission(ctx, model.GroupPermission{
+		ResourceType: d.ResourceType,
+		ResourceID: d.ResourceID,
+		GroupID: d.GroupID,
+		Role: d.Role,
+		ExpiresAt: d.ExpiresAt,
+	}); err != nil {
+		s.logger.Sugar().Errorf("failed to add permission to %s(%s) to group(%s) in postgres: %s", d.ResourceType, d.ResourceID, d.GroupID, err.Error())
+		return errInternal
+	}
+
+	s.clearCache(ctx, group.ID, resourceKeys(d.ResourceType, d.ResourceID, group.Members))
+
+	return nil
+}
+
+func (s *groupService) DeletePermission(ctx context.Context, resourceType, resourceID, groupID, userRole string, userSpace model.FullUserSpace) error {
+	if _, err := s.manage(ctx, resourceType, resourceID, userRole, userSpace); err != nil {
+		return err
+	}
+
+	group, err := s.find(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Postgres.Group.DeletePermission(ctx, resourceType, resourceID, groupID); err != nil {
+		s.logger.Sugar().Errorf("failed to delete permission to %s(%s) of group(%s) from postgres: %s", resourceType, resourceID, groupID, err.Error())
+		return errInternal
+	}
+
+	s.clearCache(ctx, group.ID, resourceKeys(resourceType, resourceID, group.Members))
+
+	return nil
+}
+
+// GetPermissions returns the groups the file or folder is shared with
+func (s *groupService) GetPermissions(ctx context.Context, resourceType, resourceID, userRole string, userSpace model.FullUserSpace) ([]*model.GroupPermission, error) {
+	if _, err := s.manage(ctx, resourceType, resourceID, userRole, userSpace); err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.repo.Postgres.Group.FindPermissions(ctx, resourceType, resourceID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find group permissions to %s(%s) in postgres: %s", resourceType, resourceID, err.Error())
+		return nil, errInternal
+	}
+
+	return permissions, nil
+}
+
+// manage checks that the user manages the file or folder and reports whether it is nested
+func (s *groupService) manage(ctx context.Context, resourceType, resourceID, userRole string, userSpace model.FullUserSpace) (bool, error) {
+	var role string
+	var nested bool
+	switch resourceType {
+	case "file":
+		file, err := s.fileService.FindByID(ctx, resourceID)
+		if err != nil {
+			return false, err
+		}
+		if file.DeletedAt != nil {
+			return false, errFileNotFound
+		}
+		role, err = s.fileService.access(ctx, file, userRole, userSpace)
+		if err != nil {
+			return false, err
+		}
+		nested = file.MainFolderID != nil
+	case "folder":
+		folder, err := s.folderService.findByID(ctx, resourceID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return false, errFolderNotFound
+			}
+			return false, err
+		}
+		if folder.DeletedAt != nil {
+			return false, errFolderNotFound
+		}
+		role, err = s.folderService.access(ctx, folder, userRole, userSpace)
+		if err != nil {
+			return false, err
+		}
+		nested = folder.MainFolderID != nil
+	}
+
+	if !atLeast(role, model.RoleManager) {
+		return false, errNoAccess
+	}
+
+	return nested, nil
+}
+
+func (s *groupService) clearCache(ctx context.Context, id string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear group(%s) cache in redis: %s", id, err.Error())
+	}
+}
+
+// resourceKeys returns the cache keys of the roles of the members in the file or folder
+func resourceKeys(resourceType, resourceID string, members []string) []string {
+	keys := []string{}
+	for _, username := range members {
+		if resourceType == "file" {
+			keys = append(keys, FilePermissionPrefix(resourceID, username), SharedPrefix(username))
+		} else {
+			keys = append(keys, FolderPermissionPrefix(resourceID, username), SharedPrefix(username))
+		}
+	}
+
+	return keys
+}
+
+// memberKeys returns the cache keys of the roles of the member in everything shared with the group
+func memberKeys(permissions []*model.GroupPermission, username string) []string {
+	keys := []string{SharedPrefix(username)}
+	for _, p := range permissions {
+		keys = append(keys, resourceKeys(p.ResourceType, p.ResourceID, []string{username})...)
+	}
+
+	return keys
+}
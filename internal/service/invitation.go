@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/rabbitmq"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+type invitationService struct {
+	logger *zap.Logger
+	repo *repository.Repository
+	rabbitmq *rabbitmq.MQConn
+	rdb *redis.Client
+	userSpaceService UserSpace
+}
+
+func newInvitationService(logger *zap.Logger, repo *repository.Repository, rabbitmq *rabbitmq.MQConn, rdb *redis.Client, userSpaceService UserSpace) Invitation {
+	return &invitationService{
+		logger: logger,
+		repo: repo,
+		rabbitmq: rabbitmq,
+		rdb: rdb,
+		userSpaceService: userSpaceService,
+	}
+}
+
+// invitationCreated is published to INVITATIONS_CREATED_EXCHANGE for every new invitation, so the invitee can be notified
+type invitationCreated struct {
+	ID           string     `json:"id"`
+	ResourceType string     `json:"resourceType"`
+	ResourceID   string     `json:"resourceId"`
+	ResourceName string     `json:"resourceName"`
+	Inviter      string     `json:"inviter"`
+	Invitee      string     `json:"invitee"`
+	Role         string     `json:"role"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+}
+
+// invite offers the permission of d to the file or folder, or the membership of the group, to the user. Users who already
+// have a permission to it, are a member or trust the inviter get it right away and nil is returned, the others get a pending invitation
+func (s *invitationService) invite(ctx context.Context, resourceType, resourceName string, d AddPermissionData) (*model.Invitation, error) {
+	space, err := s.userSpaceService.getByUsername(ctx, d.UserToAddName)
+	if err != nil {
+		return nil, err
+	}
+	if space.UserID == "" {
+		return nil, errUserNotFound
+	}
+
+	// Inviters join groups right away
+	granted := resourceType == "group" && d.UserToAddName == d.UserSpace.Username
+
+	if !granted {
+		granted, err = s.repo.Postgres.Invitation.Granted(ctx, resourceType, d.ResourceID, d.UserToAddName)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to find permission to %s(%s) of user(%s) in postgres: %s", resourceType, d.ResourceID, d.UserToAddName, err.Error())
+			return nil, errInternal
+		}
+	}
+
+	if !granted {
+		granted, err = s.repo.Postgres.Invitation.IsTrusted(ctx, d.UserToAddName, d.UserSpace.Username)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to find if user(%s) trusts user(%s) in postgres: %s", d.UserToAddName, d.UserSpace.Username, err.Error())
+			return nil, errInternal
+		}
+	}
+
+	if granted {
+		switch resourceType {
+		case "file":
+			err = s.repo.Postgres.File.AddPermission(ctx, d.ResourceID, d.UserToAddName, d.Role, d.ExpiresAt)
+		case "folder":
+			err = s.repo.Postgres.Folder.AddPermission(ctx, d.ResourceID, d.UserToAddName, d.Role, d.ExpiresAt)
+		case "group":
+			err = s.repo.Postgres.Group.AddMember(ctx, d.ResourceID, d.UserToAddName)
+		}
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to add permisson to %s(%s) to user(%s) in postgres: %s", resourceType, d.ResourceID, d.UserToAddName, err.Error())
+			return nil, errInternal
+		}
+		return nil, nil
+	}
+
+	invitation := &model.Invitation{
+		ID: uuid.NewString(),
+		ResourceType: resourceType,
+		ResourceID: d.ResourceID,
+		ResourceName: resourceName,
+		InviterID: d.UserSpace.UserID,
+		InviterName: d.UserSpace.Username,
+		Invitee: d.UserToAddName,
+		Role: d.Role,
+		ExpiresAt: d.ExpiresAt,
+	}
+	inserted, err := s.repo.Postgres.Invitation.Create(ctx, invitation)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to create invitation to %s(%s) for user(%s) in postgres: %s", resourceType, d.ResourceID, d.UserToAddName, err.Error())
+		return nil, errInternal
+	}
+
+	// Inviting again only updates the pending invitation, the invitee was notified of it already
+	if inserted {
+		s.publishCreated(invitation)
+	}
+
+	return invitation, nil
+}
+
+func (s *invitationService) publishCreated(i *model.Invitation) {
+	body, err := json.Marshal(invitationCreated{
+		ID: i.ID,
+		ResourceType: i.ResourceType,
+		ResourceID: i.ResourceID,
+		ResourceName: i.ResourceName,
+		Inviter: i.InviterName,
+		Invitee: i.Invitee,
+		Role: i.Role,
+		ExpiresAt: i.ExpiresAt,
+	})
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to marshal invitation(%s): %s", i.ID, err.Error())
+		return
+	}
+
+	if err := s.rabbitmq.PublishExchange(rabbitmq.INVITATIONS_CREATED_EXCHANGE, body); err != nil {
+		s.logger.Sugar().Errorf("failed to publish invitation(%s): %s", i.ID, err.Error())
+	}
+}
+
+// withdraw deletes the pending invitation of the user to the file, folder or group
+func (s *invitationService) withdraw(ctx context.Context, resourceType, resourceID, invitee string) error {
+	if err := s.repo.Postgres.Invitation.DeletePending(ctx, resourceType, resourceID, invitee); err != nil {
+		s.logger.Sugar().Errorf("failed to delete invitation to %s(%s) for user(%s) from postgres: %s", resourceType, resourceID, invitee, err.Error())
+		return errInternal
+	}
+
+	return nil
+}
+
+// GetPending returns the invitations waiting for the user to accept or decline them
+func (s *invitationService) GetPending(ctx context.Context, username string) ([]*model.Invitation, error) {
+	invitations, err := s.repo.Postgres.Invitation.FindPending(ctx, username)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find invitations for user(%s) in postgres: %s", username, err.Error())
+		return nil, errInternal
+	}
+
+	return invitations, nil
+}
+
+// Accept grants the user the permission of the invitation or makes the user a member of its group
+func (s *invitationService) Accept(ctx context.Context, id, username string) error {
+	invitation, err := s.repo.Postgres.Invitation.Accept(ctx, id, username)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return errInvitationNotFound
+		}
+		s.logger.Sugar().Errorf("failed to accept invitation(%s) of user(%s) in postgres: %s", id, username, err.Error())
+		return errInternal
+	}
+
+	keys := []string{SharedPrefix(username)}
+	switch invitation.ResourceType {
+	case "file":
+		keys = append(keys, FilePermissionPrefix(invitation.ResourceID, username), FilePermissionsPrefix(invitation.ResourceID))
+	case "folder":
+		keys = append(keys, FolderPermissionPrefix(invitation.ResourceID, username), FolderPermissionsPrefix(invitation.ResourceID))
+	case "group":
+		// The new member gets everything shared with the group
+		permissions, err := s.repo.Postgres.Group.FindGroupPermissions(ctx, invitation.ResourceID)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to find group(%s) permissions in postgres: %s", invitation.ResourceID, err.Error())
+		}
+		keys = append(memberKeys(permissions, username), GroupPrefix(invitation.ResourceID))
+	}
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear invitation(%s) permission cache in redis: %s", id, err.Error())
+	}
+
+	return nil
+}
+
+func (s *invitationService) Decline(ctx context.Context, id, username string) error {
+	if err := s.repo.Postgres.Invitation.Decline(ctx, id, username); err != nil {
+		if err == pgx.ErrNoRows {
+			return errInvitationNotFound
+		}
+		s.logger.Sugar().Errorf("failed to decline invitation(%s) of user(%s) in postgres: %s", id, username, err.Error())
+		return errInternal
+	}
+
+	return nil
+}
+
+// GetTrusted returns the users whose invitations the user accepts right away
+func (s *invitationService) GetTrusted(ctx context.Context, username string) ([]string, error) {
+	trusted, err := s.repo.Postgres.Invitation.FindTrusted(ctx, username)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find users trusted by user(%s) in postgres: %s", username, err.Error())
+		return nil, errInternal
+	}
+
+	return trusted, nil
+}
+
+func (s *invitationService) Trust(ctx context.Context, username, trustedUsername string) error {
+	if username == trustedUsername {
+		return errCantTrustYourself
+	}
+
+	space, err := s.userSpaceService.getByUsername(ctx, trustedUsername)
+	if err != nil {
+		return err
+	}
+	if space.UserID == "" {
+		return errUserNotFound
+	}
+
+	if err := s.repo.Postgres.Invitation.Trust(ctx, username, trustedUsername); err != nil {
+		s.logger.Sugar().Errorf("failed to make user(%s) trust user(%s) in postgres: %s", username, trustedUsername, err.Error())
+		return errInternal
+	}
+
+	return nil
+}
+
+func (s *invitationService) Distrust(ctx context.Context, username, trustedUsername string) error {
+	if err := s.repo.Postgres.Invitation.Distrust(ctx, username, trustedUsername); err != nil {
+		s.logger.Sugar().Errorf("failed to make user(%s) distrust user(%s) in postgres: %s", username, trustedUsername, err.Error())
+		return errInternal
+	}
+
+	return nil
+}
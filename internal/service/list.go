@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit = 200
+)
+
+var listSorts = map[string]bool{"name": true, "size": true, "date": true}
+
+// cursorDateLayout is the layout of dates as postgres writes timestamps as text
+const cursorDateLayout = "2006-01-02 15:04:05.999999"
+
+// listQuery checks the query and decodes its cursor, listings are sorted newest first by default
+func listQuery(q ListQuery) (model.ListQuery, error) {
+	lq := q.ListQuery
+	if lq.Sort == "" {
+		lq.Sort = "date"
+		lq.Desc = true
+	}
+	if !listSorts[lq.Sort] {
+		return model.ListQuery{}, errInvalidListSort
+	}
+	if lq.Limit <= 0 {
+		lq.Limit = defaultListLimit
+	}
+	lq.Limit = min(lq.Limit, maxListLimit)
+
+	if lq.Ext != "" && !strings.HasPrefix(lq.Ext, ".") {
+		lq.Ext = "." + lq.Ext
+	}
+	lq.Ext = strings.ToLower(lq.Ext)
+
+	if q.Cursor != "" {
+		cursorJSON, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return model.ListQuery{}, errInvalidCursor
+		}
+		if err := json.Unmarshal(cursorJSON, &lq.After); err != nil || !validCursor(lq.After, lq) {
+			return model.ListQuery{}, errInvalidCursor
+		}
+	}
+
+	return lq, nil
+}
+
+// validCursor reports whether the cursor was made by a listing with the same sort and order and its value parses as the type of the sort
+func validCursor(c *model.ListCursor, q model.ListQuery) bool {
+	if c == nil || (c.Kind != 0 && c.Kind != 1) || c.Sort != q.Sort || c.Desc != q.Desc {
+		return false
+	}
+
+	switch c.Sort {
+	case "size":
+		_, err := strconv.ParseInt(c.Value, 10, 64)
+		return err == nil
+	case "date":
+		_, err := time.Parse(cursorDateLayout, c.Value)
+		return err == nil
+	}
+
+	return true
+}
+
+func encodeCursor(c *model.ListCursor) string {
+	if c == nil {
+		return ""
+	}
+
+	cursorJSON, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(cursorJSON)
+}
+
+// cachedPage returns the page of a listing cached in the hash at key under field, made of everything that shapes the page.
+// A page that is not cached yet is loaded and cached, all pages of a listing are cleared at once by deleting key
+func cachedPage[T any](ctx context.Context, rdb *redis.Client, logger *zap.Logger, key string, q model.ListQuery, ttl time.Duration, load func() (*T, error)) (*T, error) {
+	field, err := json.Marshal(q)
+	if err != nil {
+		return load()
+	}
+
+	pageCache, err := rdb.HGet(ctx, key, string(field)).Result()
+	if err == nil {
+		var page T
+		if err := json.Unmarshal([]byte(pageCache), &page); err == nil {
+			return &page, nil
+		}
+	}
+	if err != nil && err != redis.Nil {
+		logger.Sugar().Errorf("failed to get page of %s from redis: %s", key, err.Error())
+	}
+
+	page, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	pageJSON, err := json.Marshal(page)
+	if err != nil {
+		logger.Sugar().Errorf("failed to marshal page of %s: %s", key, err.Error())
+		return page, nil
+	}
+
+	if err := setHashField(ctx, rdb, key, string(field), pageJSON, ttl); err != nil {
+		logger.Sugar().Errorf("failed to set page of %s in redis: %s", key, err.Error())
+	}
+
+	return page, nil
+}
+
+// setHashField sets the field of the hash at key, the hash expires ttl after its first field was set and is not
+// kept alive by the fields set later
+func setHashField(ctx context.Context, rdb *redis.Client, key, field string, value any, ttl time.Duration) error {
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, field, value)
+	keyTTL := pipe.TTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	// A negative TTL means the hash has no expiry yet, i.e. it was just created by this field
+	if keyTTL.Val() < 0 {
+		return rdb.Expire(ctx, key, ttl).Err()
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/rabbitmq"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type permissionService struct {
+	logger *zap.Logger
+	repo *repository.Repository
+	rabbitmq *rabbitmq.MQConn
+	rdb *redis.Client
+}
+
+func newPermissionService(logger *zap.Logger, repo *repository.Repository, rabbitmq *rabbitmq.MQConn, rdb *redis.Client) Permission {
+	return &permissionService{
+		logger: logger,
+		repo: repo,
+		rabbitmq: rabbitmq,
+		rdb: rdb,
+	}
+}
+
+// permissionExpired is published to PERMISSIONS_EXPIRED_EXCHANGE for every permission the sweeper deletes,
+// permissions of groups come with the group instead of a username
+type permissionExpired struct {
+	ResourceType string    `json:"resourceType"`
+	ResourceID   string    `json:"resourceId"`
+	Username     string    `json:"username,omitempty"`
+	GroupID      string    `json:"groupId,omitempty"`
+	Role         string    `json:"role"`
+	ExpiredAt    time.Time `json:"expiredAt"`
+}
+
+// StartExpiringPermissions deletes expired permissions every permissions.sweepInterval.
+// Expired permissions grant nothing even before they are deleted
+func (s *permissionService) StartExpiringPermissions(ctx context.Context) {
+	ticker := time.NewTicker(viper.GetDuration("permissions.sweepInterval"))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.deleteExpired(ctx, time.Now())
+		}
+	}
+}
+
+func (s *permissionService) deleteExpired(ctx context.Context, now time.Time) {
+	filePermissions, err := s.repo.Postgres.File.DeleteExpiredPermissions(ctx, now)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to delete expired file permissions in postgres: %s", err.Error())
+	}
+
+	folderPermissions, err := s.repo.Postgres.Folder.DeleteExpiredPermissions(ctx, now)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to delete expired folder permissions in postgres: %s", err.Error())
+	}
+
+	groupPermissions, err := s.repo.Postgres.Group.DeleteExpiredPermissions(ctx, now)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to delete expired group permissions in postgres: %s", err.Error())
+	}
+
+	var keys []string
+	for _, p := range groupPermissions {
+		members, err := s.repo.Postgres.Group.FindMembers(ctx, p.GroupID)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to find group(%s) members in postgres: %s", p.GroupID, err.Error())
+		}
+		keys = append(keys, resourceKeys(p.ResourceType, p.ResourceID, members)...)
+		s.publish(permissionExpired{
+			ResourceType: p.ResourceType,
+			ResourceID: p.ResourceID,
+			GroupID: p.GroupID,
+			Role: p.Role,
+			ExpiredAt: *p.ExpiresAt,
+		})
+	}
+	for _, p := range filePermissions {
+		keys = append(keys, FilePermissionPrefix(p.ResourceID, p.Username), FilePermissionsPrefix(p.ResourceID), SharedPrefix(p.Username))
+		s.publishExpired("file", p)
+	}
+	for _, p := range folderPermissions {
+		keys = append(keys, FolderPermissionPrefix(p.ResourceID, p.Username), FolderPermissionsPrefix(p.ResourceID), SharedPrefix(p.Username))
+		s.publishExpired("folder", p)
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear expired permissions cache in redis: %s", err.Error())
+	}
+}
+
+func (s *permissionService) publishExpired(resourceType string, p *model.Permission) {
+	s.publish(permissionExpired{
+		ResourceType: resourceType,
+		ResourceID: p.ResourceID,
+		Username: p.Username,
+		Role: p.Role,
+		ExpiredAt: *p.ExpiresAt,
+	})
+}
+
+func (s *permissionService) publish(e permissionExpired) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to marshal expired %s(%s) permission: %s", e.ResourceType, e.ResourceID, err.Error())
+		return
+	}
+
+	if err := s.rabbitmq.PublishExchange(rabbitmq.PERMISSIONS_EXPIRED_EXCHANGE, body); err != nil {
+		s.logger.Sugar().Errorf("failed to publish expired %s(%s) permission: %s", e.ResourceType, e.ResourceID, err.Error())
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"errors"
+	"io"
+)
+
+var errSizeLimitExceeded = errors.New("size limit exceeded")
+
+// sizeLimitReader reads from r until more than n bytes went through it
+type sizeLimitReader struct {
+	r io.Reader
+	n int64
+}
+
+func newSizeLimitReader(r io.Reader, n int64) *sizeLimitReader {
+	return &sizeLimitReader{r: r, n: n}
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errSizeLimitExceeded
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errSizeLimitExceeded
+	}
+
+	return n, err
+}
+
+func (l *sizeLimitReader) exceeded() bool {
+	return l.n < 0
+}
+
+// failedReader fails every read with err, it stands in for content that can't be opened
+type failedReader struct {
+	err error
+}
+
+func (r failedReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -4,18 +4,26 @@ import "fmt"
 
 var (
 	filePrefix = "file:%s" // file:<fileID>
-	filePermissionPrefix = "%s:%s" // <fileID>:<username>
+	filePermissionPrefix = "file-role:%s:%s" // <fileID>:<username>
 	userFilesPrefix = "user-files:%s" // <userID>
 	fileCreateDelayPrefix = "file-creating-delay-for:%s" // <userID>
-	filePermissionsPrefix = "file-permissions:%s" // <fileID>
+	filePermissionsPrefix = "file-roles:%s" // <fileID>
 	spacePrefix = "space:%s" // <userID>
 	spaceSizePrefix = "space-size:%s" // <userID>
 	folderPrefix = "folder:%s" // <folderID>
-	folderPermissionPrefix = "folder-permission:%s:%s" // <folderID>:<username>
-	folderPermissionsPrefix = "folder-permissions:%s" // <folderID>
+	folderPermissionPrefix = "folder-role:%s:%s" // <folderID>:<username>
+	folderPermissionsPrefix = "folder-roles:%s" // <folderID>
 	folderContentsPrefix = "folder-contents:%s" // <folderID>
 	userFoldersPrefix = "user-folders:%s" // <userID>
 	spaceByUsernamePrefix = "space-by-username:%s" // <username>
+	uploadSessionLockPrefix = "upload-session-lock:%s" // <sessionID>
+	sharedPrefix = "shared:%s" // <username>
+	groupPrefix = "group:%s" // <groupID>
+	userGroupsPrefix = "user-groups:%s" // <userID>
+	folderTreePrefix = "folder-tree:%s" // <folderID>, hash of trees by depth
+	folderPathPrefix = "folder-path:%s" // <folderID>
+	folderStatsPrefix = "folder-stats:%s" // <folderID>
+	shareLinkAttemptsPrefix = "share-link-attempts:%s:%s" // <linkID>:<ip>
 )
 
 func FilePrefix(fileID string) string {
@@ -69,3 +77,35 @@ func UserFoldersPrefix(userID string) string {
 func SpaceByUsernamePrefix(username string) string {
 	return fmt.Sprintf(spaceByUsernamePrefix, username)
 }
+
+func UploadSessionLockPrefix(sessionID string) string {
+	return fmt.Sprintf(uploadSessionLockPrefix, sessionID)
+}
+
+func SharedPrefix(username string) string {
+	return fmt.Sprintf(sharedPrefix, username)
+}
+
+func GroupPrefix(groupID string) string {
+	return fmt.Sprintf(groupPrefix, groupID)
+}
+
+func UserGroupsPrefix(userID string) string {
+	return fmt.Sprintf(userGroupsPrefix, userID)
+}
+
+func FolderTreePrefix(folderID string) string {
+	return fmt.Sprintf(folderTreePrefix, folderID)
+}
+
+func FolderPathPrefix(folderID string) string {
+	return fmt.Sprintf(folderPathPrefix, folderID)
+}
+
+func FolderStatsPrefix(folderID string) string {
+	return fmt.Sprintf(folderStatsPrefix, folderID)
+}
+
+func ShareLinkAttemptsPrefix(linkID, ip string) string {
+	return fmt.Sprintf(shareLinkAttemptsPrefix, linkID, ip)
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+)
+
+// roleOwner is the role of the creator of a file or folder and of admins, it is never stored
+const roleOwner = "owner"
+
+var roleRanks = map[string]int{
+	model.RoleViewer: 1,
+	model.RoleEditor: 2,
+	model.RoleManager: 3,
+	roleOwner: 4,
+}
+
+// validRole reports whether the role can be granted with a permission
+func validRole(role string) bool {
+	return role == model.RoleViewer || role == model.RoleEditor || role == model.RoleManager
+}
+
+// atLeast reports whether the role grants everything the needed role does, an empty role grants nothing
+func atLeast(role, need string) bool {
+	return roleRanks[role] >= roleRanks[need]
+}
+
+// changeRole returns the role needed to rename or delete an item. Editors change what is inside a shared folder,
+// the shared file or folder itself is changed by managers
+func changeRole(mainFolderID *string) string {
+	if mainFolderID != nil {
+		return model.RoleEditor
+	}
+	return model.RoleManager
+}
+
+// grantTTL shortens the cache TTL of a role or a permission list to the time left until the earliest of the permissions expires
+func grantTTL(ttl time.Duration, expiresAt ...*time.Time) time.Duration {
+	for _, e := range expiresAt {
+		if e == nil {
+			continue
+		}
+		// A zero TTL would keep the key forever
+		left := max(time.Until(*e), time.Millisecond)
+		ttl = min(ttl, left)
+	}
+	return ttl
+}
+
+func permissionsExpiry(permissions []*model.Permission) []*time.Time {
+	expiresAt := make([]*time.Time, 0, len(permissions))
+	for _, p := range permissions {
+		expiresAt = append(expiresAt, p.ExpiresAt)
+	}
+	return expiresAt
+}
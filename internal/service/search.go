@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	maxSearchLimit = 50
+	minSearchLength = 2
+	maxSearchLength = 100
+)
+
+type searchService struct {
+	logger *zap.Logger
+	repo *repository.Repository
+}
+
+func newSearchService(logger *zap.Logger, repo *repository.Repository) Search {
+	return &searchService{
+		logger: logger,
+		repo: repo,
+	}
+}
+
+// Search returns a page of the files and folders the user can view whose names match the text, best matches first.
+// Results are not cached, they depend on every item and permission the user can see
+func (s *searchService) Search(ctx context.Context, userSpace model.FullUserSpace, q SearchQuery) (*model.SearchResults, error) {
+	q.Text = strings.TrimSpace(q.Text)
+	if n := utf8.RuneCountInString(q.Text); n < minSearchLength || n > maxSearchLength {
+		return nil, errInvalidSearchText
+	}
+	if q.Type != "" && q.Type != "file" && q.Type != "folder" {
+		return nil, errInvalidSearchType
+	}
+	if q.Limit <= 0 || q.Limit > maxSearchLimit {
+		q.Limit = maxSearchLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	hits, total, err := s.repo.Postgres.Search.Find(ctx, userSpace.UserID, userSpace.Username, q.Text, q.Type, q.Limit, q.Offset)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to search for user(%s) in postgres: %s", userSpace.UserID, err.Error())
+		return nil, errInternal
+	}
+
+	return &model.SearchResults{
+		Items: hits,
+		Total: total,
+	}, nil
+}
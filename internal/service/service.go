@@ -2,12 +2,14 @@ package service
 
 import (
 	"context"
+	"io"
 	"mime/multipart"
 
 	pb "github.com/File-Sharer/file-service/hasher_pbs"
 	"github.com/File-Sharer/file-service/internal/model"
 	"github.com/File-Sharer/file-service/internal/rabbitmq"
 	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/File-Sharer/file-service/internal/storage"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
@@ -21,29 +23,125 @@ type UserSpace interface {
 }
 
 type Folder interface {
-	Create(ctx context.Context, f model.Folder) (*model.Folder, error)
+	Create(ctx context.Context, f model.Folder, userRole string, userSpace model.FullUserSpace) (*model.Folder, error)
 	findByID(ctx context.Context, id string) (*model.Folder, error)
-	hasPermission(ctx context.Context, id, username string) (bool, error)
+	access(ctx context.Context, folder *model.Folder, userRole string, userSpace model.FullUserSpace) (string, error)
 	ProtectedFindByID(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.Folder, error)
-	Rename(ctx context.Context, id, userID, newName string) error
-	GetFolderContents(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.FolderContents, error)
-	GetUserFolders(ctx context.Context, userID string) ([]*model.Folder, error)
-	AddPermission(ctx context.Context, d AddPermissionData) error
+	Rename(ctx context.Context, id, newName, userRole string, userSpace model.FullUserSpace) error
+	TogglePublic(ctx context.Context, id, creatorID string) error
+	GetFolderContents(ctx context.Context, id, userRole string, userSpace model.FullUserSpace, q ListQuery) (*model.FolderContents, error)
+	GetTree(ctx context.Context, id string, depth int, userRole string, userSpace model.FullUserSpace) (*model.FolderTree, error)
+	GetPath(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) ([]*model.Folder, error)
+	GetStats(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.FolderStats, error)
+	clearStatsCache(ctx context.Context, folderID *string)
+	GetUserFolders(ctx context.Context, userID string, q ListQuery) (*model.FolderPage, error)
+	AddPermission(ctx context.Context, d AddPermissionData) (*model.Invitation, error)
 	DeletePermission(ctx context.Context, d DeletePermissionData) error
-	GetPermissions(ctx context.Context, folderID, userID string) ([]*string, error)
+	GetPermissions(ctx context.Context, folderID, userRole string, userSpace model.FullUserSpace) ([]*model.Permission, error)
 	hasFile(ctx context.Context, folderID, filename string) (bool, error)
+	Delete(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) error
+	Restore(ctx context.Context, id, userID string) (*model.Folder, error)
+	Purge(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.DeleteReport, error)
+	purge(ctx context.Context, folder *model.Folder) (*model.DeleteReport, error)
+	Move(ctx context.Context, id, userID string, folderID *string) (*model.Folder, error)
+	Copy(ctx context.Context, id string, userSpace model.FullUserSpace, folderID *string) (*model.Folder, error)
+	Zip(ctx context.Context, folder *model.Folder, w io.Writer) error
+	zipEntries(ctx context.Context, folder *model.Folder, prefix string) ([]*model.ArchiveEntry, error)
 }
 
 type File interface {
-	Create(ctx context.Context, userSpace model.FullUserSpace, fileObj model.File, file multipart.File, fileHeader *multipart.FileHeader) (*model.File, error)
+	Create(ctx context.Context, userRole string, userSpace model.FullUserSpace, fileObj model.File, file multipart.File, fileHeader *multipart.FileHeader, newVersion bool) (*model.File, error)
+	Extract(ctx context.Context, userRole string, userSpace model.FullUserSpace, fileObj model.File, file multipart.File, fileHeader *multipart.FileHeader) (*model.ExtractReport, error)
 	ProtectedFindByID(ctx context.Context, fileID, userRole string, userSpace model.FullUserSpace) (*model.File, error)
 	FindByID(ctx context.Context, id string) (*model.File, error)
-	FindUserFiles(ctx context.Context, userID string) ([]*model.File, error)
-	AddPermission(ctx context.Context, d AddPermissionData) error
+	access(ctx context.Context, file *model.File, userRole string, userSpace model.FullUserSpace) (string, error)
+	FindUserFiles(ctx context.Context, userID string, q ListQuery) (*model.FilePage, error)
+	AddPermission(ctx context.Context, d AddPermissionData) (*model.Invitation, error)
 	Delete(ctx context.Context, fileID, userRole string, userSpace model.FullUserSpace) error
+	Restore(ctx context.Context, id, userID string) (*model.File, error)
+	Purge(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) error
+	purge(ctx context.Context, file *model.File) error
+	CreateVersion(ctx context.Context, userRole string, userSpace model.FullUserSpace, id string, content io.ReadSeeker, size int64) (*model.File, error)
+	GetVersions(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) ([]*model.FileVersion, error)
+	GetVersion(ctx context.Context, id string, version int, userRole string, userSpace model.FullUserSpace) (*model.File, *model.FileVersion, error)
+	RestoreVersion(ctx context.Context, userRole string, userSpace model.FullUserSpace, id string, version int) (*model.File, error)
+	StartPruningVersions(ctx context.Context)
 	DeletePermission(ctx context.Context, d DeletePermissionData) error
-	FindPermissionsToFile(ctx context.Context, fileID, creatorID string) ([]*string, error)
+	FindPermissionsToFile(ctx context.Context, fileID, userRole string, userSpace model.FullUserSpace) ([]*model.Permission, error)
 	TogglePublic(ctx context.Context, id, creatorID string) error
+	Move(ctx context.Context, id, userID string, folderID *string) (*model.File, error)
+	Copy(ctx context.Context, id string, userSpace model.FullUserSpace, folderID *string) (*model.File, error)
+}
+
+type UploadSession interface {
+	Create(ctx context.Context, userRole string, userSpace model.FullUserSpace, session model.UploadSession) (*model.UploadSession, error)
+	Get(ctx context.Context, id, userID string) (*model.UploadSession, error)
+	WriteChunk(ctx context.Context, id, userID string, offset int64, chunk io.Reader) (int64, error)
+	Finalize(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.File, error)
+	FinalizeExtract(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.ExtractReport, error)
+	Abort(ctx context.Context, id, userID string) error
+	StartExpiringSessions(ctx context.Context)
+}
+
+type Trash interface {
+	Get(ctx context.Context, userID string) (*model.FolderContents, error)
+	StartPurgingTrash(ctx context.Context)
+}
+
+type ShareLink interface {
+	Create(ctx context.Context, d CreateShareLinkData) (*model.ShareLink, error)
+	GetByResource(ctx context.Context, resourceType, resourceID, userID string) ([]*model.ShareLink, error)
+	Revoke(ctx context.Context, id, userID string) error
+	Open(ctx context.Context, id, password, ip string) (*model.ShareLink, *model.File, *model.Folder, error)
+	CountDownload(ctx context.Context, link *model.ShareLink) error
+}
+
+type Shared interface {
+	Get(ctx context.Context, username string, q SharedQuery) (*model.SharedItems, error)
+}
+
+type Group interface {
+	Create(ctx context.Context, name, userID string) (*model.Group, error)
+	GetUserGroups(ctx context.Context, userID string) ([]*model.Group, error)
+	Get(ctx context.Context, id, userRole, userID string) (*model.Group, error)
+	Delete(ctx context.Context, id, userRole, userID string) error
+	AddMember(ctx context.Context, id, username, userRole string, userSpace model.FullUserSpace) (*model.Invitation, error)
+	DeleteMember(ctx context.Context, id, username, userRole, userID string) error
+	AddPermission(ctx context.Context, d AddGroupPermissionData) error
+	DeletePermission(ctx context.Context, resourceType, resourceID, groupID, userRole string, userSpace model.FullUserSpace) error
+	GetPermissions(ctx context.Context, resourceType, resourceID, userRole string, userSpace model.FullUserSpace) ([]*model.GroupPermission, error)
+}
+
+type Invitation interface {
+	invite(ctx context.Context, resourceType, resourceName string, d AddPermissionData) (*model.Invitation, error)
+	withdraw(ctx context.Context, resourceType, resourceID, invitee string) error
+	GetPending(ctx context.Context, username string) ([]*model.Invitation, error)
+	Accept(ctx context.Context, id, username string) error
+	Decline(ctx context.Context, id, username string) error
+	GetTrusted(ctx context.Context, username string) ([]string, error)
+	Trust(ctx context.Context, username, trustedUsername string) error
+	Distrust(ctx context.Context, username, trustedUsername string) error
+}
+
+type Archive interface {
+	Resolve(ctx context.Context, fileIDs, folderIDs []string, userRole string, userSpace model.FullUserSpace) ([]*model.ArchiveEntry, error)
+	Write(ctx context.Context, entries []*model.ArchiveEntry, w io.Writer) error
+}
+
+type Search interface {
+	Search(ctx context.Context, userSpace model.FullUserSpace, q SearchQuery) (*model.SearchResults, error)
+}
+
+type Tag interface {
+	AddTag(ctx context.Context, resourceType, resourceID, tag, userRole string, userSpace model.FullUserSpace) error
+	DeleteTag(ctx context.Context, resourceType, resourceID, tag, userRole string, userSpace model.FullUserSpace) error
+	GetMetadata(ctx context.Context, resourceType, resourceID, userRole string, userSpace model.FullUserSpace) (map[string]string, error)
+	SetMetadata(ctx context.Context, resourceType, resourceID, key, value, userRole string, userSpace model.FullUserSpace) error
+	DeleteMetadata(ctx context.Context, resourceType, resourceID, key, userRole string, userSpace model.FullUserSpace) error
+}
+
+type Permission interface {
+	StartExpiringPermissions(ctx context.Context)
 }
 
 type Service struct {
@@ -51,21 +149,49 @@ type Service struct {
 	UserSpace
 	Folder
 	File
+	UploadSession
+	Trash
+	ShareLink
+	Shared
+	Group
+	Invitation
+	Archive
+	Search
+	Tag
+	Permission
 }
 
-func New(logger *zap.Logger, repo *repository.Repository, rabbitmq *rabbitmq.MQConn, hasherClient pb.HasherClient, rdb *redis.Client) *Service {
+func New(logger *zap.Logger, repo *repository.Repository, rabbitmq *rabbitmq.MQConn, hasherClient pb.HasherClient, rdb *redis.Client, store storage.Backend) *Service {
 	userSpaceService := newUserSpaceService(logger, repo, rabbitmq, rdb)
-	folderService := newFolderService(logger, repo, hasherClient, rdb, userSpaceService)
+	invitationService := newInvitationService(logger, repo, rabbitmq, rdb, userSpaceService)
+	// Files and folders share their blobs, so they share the reference counting of them too
+	blobs := newBlobStore(logger, repo, store)
+	folderService := newFolderService(logger, repo, hasherClient, rdb, store, blobs, userSpaceService, invitationService)
+	fileService := NewFileService(logger, repo, hasherClient, store, blobs, userSpaceService, rdb, folderService, invitationService)
 
 	return &Service{
 		logger: logger,
 		UserSpace: userSpaceService,
 		Folder: folderService,
-		File: NewFileService(logger, repo, hasherClient, userSpaceService, rdb, folderService),
+		File: fileService,
+		UploadSession: newUploadSessionService(logger, repo, rdb, fileService, folderService),
+		Trash: newTrashService(logger, repo, fileService, folderService),
+		ShareLink: newShareLinkService(logger, repo, rdb, fileService, folderService),
+		Shared: newSharedService(logger, repo, rdb),
+		Group: newGroupService(logger, repo, rdb, fileService, folderService, invitationService),
+		Invitation: invitationService,
+		Archive: newArchiveService(logger, store, fileService, folderService),
+		Search: newSearchService(logger, repo),
+		Tag: newTagService(logger, repo, rdb, fileService, folderService),
+		Permission: newPermissionService(logger, repo, rabbitmq, rdb),
 	}
 }
 
 func (s *Service) StartAllWorkers(ctx context.Context) {
 	go s.UserSpace.StartCreatingUsersSpaces(ctx)
+	go s.UploadSession.StartExpiringSessions(ctx)
+	go s.Trash.StartPurgingTrash(ctx)
+	go s.File.StartPruningVersions(ctx)
+	go s.Permission.StartExpiringPermissions(ctx)
 	s.logger.Info("Started all workers")
 }
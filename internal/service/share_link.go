@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type shareLinkService struct {
+	logger *zap.Logger
+	repo *repository.Repository
+	rdb *redis.Client
+	fileService File
+	folderService Folder
+}
+
+func newShareLinkService(logger *zap.Logger, repo *repository.Repository, rdb *redis.Client, fileService File, folderService Folder) ShareLink {
+	return &shareLinkService{
+		logger: logger,
+		repo: repo,
+		rdb: rdb,
+		fileService: fileService,
+		folderService: folderService,
+	}
+}
+
+// newShareLinkID returns a random URL safe ID that is infeasible to guess
+func newShareLinkID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Create creates a link to the user's file or folder
+func (s *shareLinkService) Create(ctx context.Context, d CreateShareLinkData) (*model.ShareLink, error) {
+	if _, _, err := s.findResource(ctx, d.ResourceType, d.ResourceID, d.UserID); err != nil {
+		return nil, err
+	}
+
+	if d.ExpiresAt != nil && !d.ExpiresAt.After(time.Now()) {
+		return nil, errExpiryIsInThePast
+	}
+
+	id, err := newShareLinkID()
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to generate share link ID: %s", err.Error())
+		return nil, errInternal
+	}
+
+	link := &model.ShareLink{
+		ID: id,
+		ResourceType: d.ResourceType,
+		ResourceID: d.ResourceID,
+		CreatorID: d.UserID,
+		ExpiresAt: d.ExpiresAt,
+		MaxDownloads: d.MaxDownloads,
+	}
+
+	if d.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(d.Password), bcrypt.DefaultCost)
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to hash share link password: %s", err.Error())
+			return nil, errInternal
+		}
+		passwordHash := string(hash)
+		link.PasswordHash = &passwordHash
+		link.HasPassword = true
+	}
+
+	if err := s.repo.Postgres.ShareLink.Create(ctx, link); err != nil {
+		s.logger.Sugar().Errorf("failed to create share link to %s(%s) in postgres: %s", d.ResourceType, d.ResourceID, err.Error())
+		return nil, errInternal
+	}
+
+	return link, nil
+}
+
+// GetByResource returns the links to the user's file or folder
+func (s *shareLinkService) GetByResource(ctx context.Context, resourceType, resourceID, userID string) ([]*model.ShareLink, error) {
+	if _, _, err := s.findResource(ctx, resourceType, resourceID, userID); err != nil {
+		return nil, err
+	}
+
+	links, err := s.repo.Postgres.ShareLink.FindByResource(ctx, resourceType, resourceID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find share links to %s(%s) in postgres: %s", resourceType, resourceID, err.Error())
+		return nil, errInternal
+	}
+
+	return links, nil
+}
+
+// Revoke deletes the user's link
+func (s *shareLinkService) Revoke(ctx context.Context, id, userID string) error {
+	link, err := s.find(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if link.CreatorID != userID {
+		return errNoAccess
+	}
+
+	if err := s.repo.Postgres.ShareLink.Delete(ctx, id); err != nil {
+		s.logger.Sugar().Errorf("failed to delete share link(%s) from postgres: %s", id, err.Error())
+		return errInternal
+	}
+
+	return nil
+}
+
+// Open checks the link and its password and returns the file or the folder it points to.
+// Wrong passwords are limited per link and IP address, as they are checked for anyone who has the link
+func (s *shareLinkService) Open(ctx context.Context, id, password, ip string) (*model.ShareLink, *model.File, *model.Folder, error) {
+	link, err := s.find(ctx, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return nil, nil, nil, errShareLinkNotFound
+	}
+	if link.MaxDownloads != nil && link.Downloads >= *link.MaxDownloads {
+		return nil, nil, nil, errShareLinkNotFound
+	}
+
+	if link.PasswordHash != nil {
+		if password == "" {
+			return nil, nil, nil, errShareLinkPasswordRequired
+		}
+		if err := s.checkPassword(ctx, link, password, ip); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	file, folder, err := s.findResource(ctx, link.ResourceType, link.ResourceID, link.CreatorID)
+	if err != nil {
+		return nil, nil, nil, errShareLinkNotFound
+	}
+
+	return link, file, folder, nil
+}
+
+// CountDownload counts a download of the opened link towards its download limit
+func (s *shareLinkService) CountDownload(ctx context.Context, link *model.ShareLink) error {
+	// Concurrent downloads may use up the limit in the meantime
+	if err := s.repo.Postgres.ShareLink.CountDownload(ctx, link.ID, time.Now()); err != nil {
+		if err == pgx.ErrNoRows {
+			return errShareLinkNotFound
+		}
+		s.logger.Sugar().Errorf("failed to count share link(%s) download in postgres: %s", link.ID, err.Error())
+		return errInternal
+	}
+	link.Downloads++
+
+	return nil
+}
+
+// checkPassword compares the password with the one of the link. Every attempt takes one from the attempts
+// the IP address has on the link, a right password gives it back
+func (s *shareLinkService) checkPassword(ctx context.Context, link *model.ShareLink, password, ip string) error {
+	maxAttempts := viper.GetInt64("shareLinks.passwordAttempts")
+	key := ShareLinkAttemptsPrefix(link.ID, ip)
+
+	if maxAttempts > 0 {
+		attempts, err := s.rdb.Incr(ctx, key).Result()
+		if err != nil {
+			s.logger.Sugar().Errorf("failed to count password attempt on share link(%s) in redis: %s", link.ID, err.Error())
+			return errInternal
+		}
+		if attempts == 1 {
+			if err := s.rdb.Expire(ctx, key, viper.GetDuration("shareLinks.attemptsWindow")).Err(); err != nil {
+				s.logger.Sugar().Errorf("failed to set expiration of password attempts on share link(%s) in redis: %s", link.ID, err.Error())
+			}
+		}
+		if attempts > maxAttempts {
+			return errTooManyPasswordAttempts
+		}
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(*link.PasswordHash), []byte(password)); err != nil {
+		return errWrongShareLinkPassword
+	}
+
+	if maxAttempts > 0 {
+		if err := s.rdb.Decr(ctx, key).Err(); err != nil {
+			s.logger.Sugar().Errorf("failed to give back password attempt on share link(%s) in redis: %s", link.ID, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (s *shareLinkService) find(ctx context.Context, id string) (*model.ShareLink, error) {
+	link, err := s.repo.Postgres.ShareLink.FindByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errShareLinkNotFound
+		}
+		s.logger.Sugar().Errorf("failed to find share link(%s) in postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	return link, nil
+}
+
+// findResource returns the file or the folder of the user that is not in the trash
+func (s *shareLinkService) findResource(ctx context.Context, resourceType, resourceID, userID string) (*model.File, *model.Folder, error) {
+	switch resourceType {
+	case "file":
+		file, err := s.fileService.FindByID(ctx, resourceID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if file.DeletedAt != nil {
+			return nil, nil, errFileNotFound
+		}
+		if file.CreatorID != userID {
+			return nil, nil, errNoAccess
+		}
+		return file, nil, nil
+	case "folder":
+		folder, err := s.folderService.findByID(ctx, resourceID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, nil, errFolderNotFound
+			}
+			return nil, nil, err
+		}
+		if folder.DeletedAt != nil {
+			return nil, nil, errFolderNotFound
+		}
+		if folder.CreatorID != userID {
+			return nil, nil, errNoAccess
+		}
+		return nil, folder, nil
+	default:
+		return nil, nil, errShareLinkNotFound
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const maxSharedLimit = 100
+
+var sharedSorts = map[string]bool{"name": true, "owner": true, "role": true, "sharedAt": true, "createdAt": true}
+
+type sharedService struct {
+	logger *zap.Logger
+	repo *repository.Repository
+	rdb *redis.Client
+}
+
+func newSharedService(logger *zap.Logger, repo *repository.Repository, rdb *redis.Client) Shared {
+	return &sharedService{
+		logger: logger,
+		repo: repo,
+		rdb: rdb,
+	}
+}
+
+// Get returns a page of the files and root folders shared with the user, newest shares first by default.
+// Every page of the user is cached under one key, so changing a permission clears all of them at once
+func (s *sharedService) Get(ctx context.Context, username string, q SharedQuery) (*model.SharedItems, error) {
+	if q.Sort == "" {
+		q.Sort = "sharedAt"
+		q.Desc = true
+	}
+	if !sharedSorts[q.Sort] {
+		return nil, errInvalidSort
+	}
+	if q.Limit <= 0 || q.Limit > maxSharedLimit {
+		q.Limit = maxSharedLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	page := fmt.Sprintf("%s:%t:%d:%d", q.Sort, q.Desc, q.Limit, q.Offset)
+
+	sharedCache, err := s.rdb.HGet(ctx, SharedPrefix(username), page).Result()
+	if err == nil {
+		var shared model.SharedItems
+		if err := json.Unmarshal([]byte(sharedCache), &shared); err == nil {
+			return &shared, nil
+		}
+	}
+	if err != nil && err != redis.Nil {
+		s.logger.Sugar().Errorf("failed to get items shared with user(%s) from redis: %s", username, err.Error())
+	}
+
+	items, total, err := s.repo.Postgres.Shared.Find(ctx, username, q.Sort, q.Desc, q.Limit, q.Offset)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find items shared with user(%s) in postgres: %s", username, err.Error())
+		return nil, errInternal
+	}
+
+	shared := &model.SharedItems{
+		Items: items,
+		Total: total,
+	}
+
+	sharedJSON, err := json.Marshal(shared)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to marshal items shared with user(%s): %s", username, err.Error())
+		return shared, nil
+	}
+
+	// Renamed and trashed items are not tracked, they show up after the cache expires.
+	// The TTL is only ever shortened, so a page with a permission about to expire is not kept for longer
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, SharedPrefix(username), page, sharedJSON)
+	pipe.ExpireLT(ctx, SharedPrefix(username), grantTTL(time.Minute, sharedExpiry(items)...))
+	if _, err := pipe.Exec(ctx); err != nil {
+		s.logger.Sugar().Errorf("failed to set items shared with user(%s) in redis: %s", username, err.Error())
+	}
+
+	return shared, nil
+}
+
+func sharedExpiry(items []*model.SharedItem) []*time.Time {
+	expiresAt := make([]*time.Time, 0, len(items))
+	for _, i := range items {
+		expiresAt = append(expiresAt, i.ExpiresAt)
+	}
+	return expiresAt
+}
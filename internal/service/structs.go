@@ -1,17 +1,64 @@
 package service
 
-import "github.com/File-Sharer/file-service/internal/model"
+import (
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+)
 
 type AddPermissionData struct {
 	ResourceID    string
 	UserSpace     model.FullUserSpace
 	UserRole      string
 	UserToAddName string
+	Role          string
+	ExpiresAt     *time.Time
 }
 
 type DeletePermissionData struct {
 	ResourceID       string
-	UserID           string
+	UserSpace        model.FullUserSpace
 	UserRole         string
 	UserToDeleteName string
 }
+
+type CreateShareLinkData struct {
+	ResourceType string
+	ResourceID   string
+	UserID       string
+	ExpiresAt    *time.Time
+	MaxDownloads *int
+	Password     string
+}
+
+// SharedQuery pages and sorts the items shared with a user
+type SharedQuery struct {
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+type AddGroupPermissionData struct {
+	ResourceType string
+	ResourceID   string
+	GroupID      string
+	Role         string
+	ExpiresAt    *time.Time
+	UserRole     string
+	UserSpace    model.FullUserSpace
+}
+
+// SearchQuery pages the files and folders matching Text, Type "file" or "folder" searches only one of them
+type SearchQuery struct {
+	Text   string
+	Type   string
+	Limit  int
+	Offset int
+}
+
+// ListQuery pages, sorts and filters a listing, Cursor is the nextCursor of the previous page
+type ListQuery struct {
+	model.ListQuery
+	Cursor string
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	maxTags = 20
+	maxTagLength = 64
+	maxMetadataKeys = 50
+	maxMetadataValueLength = 1024
+)
+
+var metadataKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+type tagService struct {
+	logger *zap.Logger
+	repo *repository.Repository
+	rdb *redis.Client
+	fileService File
+	folderService Folder
+}
+
+func newTagService(logger *zap.Logger, repo *repository.Repository, rdb *redis.Client, fileService File, folderService Folder) Tag {
+	return &tagService{
+		logger: logger,
+		repo: repo,
+		rdb: rdb,
+		fileService: fileService,
+		folderService: folderService,
+	}
+}
+
+// AddTag tags the file or folder, the user must be able to edit it
+func (s *tagService) AddTag(ctx context.Context, resourceType, resourceID, tag, userRole string, userSpace model.FullUserSpace) error {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || utf8.RuneCountInString(tag) > maxTagLength {
+		return errInvalidTag
+	}
+
+	keys, err := s.resource(ctx, resourceType, resourceID, model.RoleEditor, userRole, userSpace)
+	if err != nil {
+		return err
+	}
+
+	added, err := s.repo.Postgres.Tag.AddTag(ctx, resourceType, resourceID, tag, maxTags)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to add tag(%s) to %s(%s) in postgres: %s", tag, resourceType, resourceID, err.Error())
+		return errInternal
+	}
+	if !added {
+		return errTooManyTags
+	}
+
+	s.clearCache(ctx, resourceType, resourceID, keys)
+
+	return nil
+}
+
+func (s *tagService) DeleteTag(ctx context.Context, resourceType, resourceID, tag, userRole string, userSpace model.FullUserSpace) error {
+	keys, err := s.resource(ctx, resourceType, resourceID, model.RoleEditor, userRole, userSpace)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.Postgres.Tag.DeleteTag(ctx, resourceType, resourceID, tag); err != nil {
+		s.logger.Sugar().Errorf("failed to delete tag(%s) of %s(%s) from postgres: %s", tag, resourceType, resourceID, err.Error())
+		return errInternal
+	}
+
+	s.clearCache(ctx, resourceType, resourceID, keys)
+
+	return nil
+}
+
+// GetMetadata returns the metadata of the file or folder to anyone who can view it
+func (s *tagService) GetMetadata(ctx context.Context, resourceType, resourceID, userRole string, userSpace model.FullUserSpace) (map[string]string, error) {
+	if _, err := s.resource(ctx, resourceType, resourceID, model.RoleViewer, userRole, userSpace); err != nil {
+		return nil, err
+	}
+
+	metadata, err := s.repo.Postgres.Tag.FindMetadata(ctx, resourceType, resourceID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find metadata of %s(%s) in postgres: %s", resourceType, resourceID, err.Error())
+		return nil, errInternal
+	}
+
+	return metadata, nil
+}
+
+// SetMetadata sets the value of the key of the file or folder, the user must be able to edit it
+func (s *tagService) SetMetadata(ctx context.Context, resourceType, resourceID, key, value, userRole string, userSpace model.FullUserSpace) error {
+	if !metadataKeyRegexp.MatchString(key) {
+		return errInvalidMetadataKey
+	}
+	if utf8.RuneCountInString(value) > maxMetadataValueLength {
+		return errMetadataValueIsTooLong
+	}
+
+	if _, err := s.resource(ctx, resourceType, resourceID, model.RoleEditor, userRole, userSpace); err != nil {
+		return err
+	}
+
+	if err := s.repo.Postgres.Tag.SetMetadata(ctx, resourceType, resourceID, key, value, maxMetadataKeys); err != nil {
+		if err == pgx.ErrNoRows {
+			return errTooManyMetadataKeys
+		}
+		s.logger.Sugar().Errorf("failed to set metadata(%s) of %s(%s) in postgres: %s", key, resourceType, resourceID, err.Error())
+		return errInternal
+	}
+
+	return nil
+}
+
+func (s *tagService) DeleteMetadata(ctx context.Context, resourceType, resourceID, key, userRole string, userSpace model.FullUserSpace) error {
+	if _, err := s.resource(ctx, resourceType, resourceID, model.RoleEditor, userRole, userSpace); err != nil {
+		return err
+	}
+
+	if err := s.repo.Postgres.Tag.DeleteMetadata(ctx, resourceType, resourceID, key); err != nil {
+		s.logger.Sugar().Errorf("failed to delete metadata(%s) of %s(%s) from postgres: %s", key, resourceType, resourceID, err.Error())
+		return errInternal
+	}
+
+	return nil
+}
+
+// resource checks that the user has at least minRole in the file or folder that is not in the trash
+// and returns the cache keys of it and of the listing it is in, which show its tags
+func (s *tagService) resource(ctx context.Context, resourceType, resourceID, minRole, userRole string, userSpace model.FullUserSpace) ([]string, error) {
+	var role string
+	var keys []string
+	switch resourceType {
+	case "file":
+		file, err := s.fileService.FindByID(ctx, resourceID)
+		if err != nil {
+			return nil, err
+		}
+		if file.DeletedAt != nil {
+			return nil, errFileNotFound
+		}
+		role, err = s.fileService.access(ctx, file, userRole, userSpace)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, FilePrefix(file.ID))
+		if file.FolderID != nil {
+			keys = append(keys, FolderContentsPrefix(*file.FolderID))
+		} else {
+			keys = append(keys, UserFilesPrefix(file.CreatorID))
+		}
+	case "folder":
+		folder, err := s.folderService.findByID(ctx, resourceID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, errFolderNotFound
+			}
+			return nil, err
+		}
+		if folder.DeletedAt != nil {
+			return nil, errFolderNotFound
+		}
+		role, err = s.folderService.access(ctx, folder, userRole, userSpace)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, FolderPrefix(folder.ID))
+		if folder.FolderID != nil {
+			keys = append(keys, FolderContentsPrefix(*folder.FolderID))
+		} else {
+			keys = append(keys, UserFoldersPrefix(folder.CreatorID))
+		}
+	}
+
+	if !atLeast(role, minRole) {
+		return nil, errNoAccess
+	}
+
+	return keys, nil
+}
+
+func (s *tagService) clearCache(ctx context.Context, resourceType, resourceID string, keys []string) {
+	if err := s.rdb.Del(ctx, keys...).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear %s(%s) tags cache in redis: %s", resourceType, resourceID, err.Error())
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type trashService struct {
+	logger *zap.Logger
+	repo *repository.Repository
+	fileService File
+	folderService Folder
+}
+
+func newTrashService(logger *zap.Logger, repo *repository.Repository, fileService File, folderService Folder) Trash {
+	return &trashService{
+		logger: logger,
+		repo: repo,
+		fileService: fileService,
+		folderService: folderService,
+	}
+}
+
+// trashKey is the storage key trashed items of the user are kept under until they are restored or purged
+func trashKey(userID, id string) string {
+	return userID + "/.trash/" + id
+}
+
+// Get returns the user's trashed files and folders, items trashed together with their folder are not listed
+func (s *trashService) Get(ctx context.Context, userID string) (*model.FolderContents, error) {
+	files, err := s.repo.Postgres.File.FindTrashed(ctx, userID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find user(%s) trashed files in postgres: %s", userID, err.Error())
+		return nil, errInternal
+	}
+
+	folders, err := s.repo.Postgres.Folder.FindTrashed(ctx, userID)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find user(%s) trashed folders in postgres: %s", userID, err.Error())
+		return nil, errInternal
+	}
+
+	return &model.FolderContents{
+		Files: files,
+		Folders: folders,
+	}, nil
+}
+
+// StartPurgingTrash deletes items that have been in the trash longer than the retention for good
+func (s *trashService) StartPurgingTrash(ctx context.Context) {
+	ticker := time.NewTicker(viper.GetDuration("trash.purgeInterval"))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purgeExpired(ctx, time.Now().Add(-viper.GetDuration("trash.retention")))
+		}
+	}
+}
+
+func (s *trashService) purgeExpired(ctx context.Context, before time.Time) {
+	folders, err := s.repo.Postgres.Folder.FindExpiredTrash(ctx, before)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find expired trashed folders in postgres: %s", err.Error())
+		return
+	}
+
+	for _, folder := range folders {
+		report, err := s.folderService.purge(ctx, folder)
+		if err != nil {
+			continue
+		}
+		if len(report.Failed) > 0 {
+			s.logger.Sugar().Errorf("failed to purge %d items of trashed folder(%s)", len(report.Failed), folder.ID)
+		}
+	}
+
+	// Files are looked up after folders, so the ones purged with their folder are gone already
+	files, err := s.repo.Postgres.File.FindExpiredTrash(ctx, before)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to find expired trashed files in postgres: %s", err.Error())
+		return
+	}
+
+	for _, file := range files {
+		s.fileService.purge(ctx, file)
+	}
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/File-Sharer/file-service/internal/model"
+	"github.com/File-Sharer/file-service/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type uploadSessionService struct {
+	logger *zap.Logger
+	repo *repository.Repository
+	rdb *redis.Client
+	fileService *FileService
+	folderService Folder
+}
+
+func newUploadSessionService(logger *zap.Logger, repo *repository.Repository, rdb *redis.Client, fileService *FileService, folderService Folder) UploadSession {
+	return &uploadSessionService{
+		logger: logger,
+		repo: repo,
+		rdb: rdb,
+		fileService: fileService,
+		folderService: folderService,
+	}
+}
+
+func (s *uploadSessionService) Create(ctx context.Context, userRole string, userSpace model.FullUserSpace, session model.UploadSession) (*model.UploadSession, error) {
+	if session.Size <= 0 {
+		return nil, errFileHasNoData
+	}
+
+	targetSpace, err := s.fileService.uploadTarget(ctx, session.FolderID, userRole, userSpace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Checking user creating files delay
+	delay := s.rdb.Get(ctx, FileCreateDelayPrefix(userSpace.UserID))
+	if delay.Err() != redis.Nil {
+		return nil, errWaitDelay
+	}
+
+	if session.Size > levelSpaceSizes[userSpace.Level].maxFileSize {
+		return nil, errFileIsTooBig
+	}
+
+	// The space is reserved for the whole upload right away, uploads into a shared folder reserve the space of its owner
+	if targetSpace.Size + session.Size > levelSpaceSizes[targetSpace.Level].maxSpaceSize {
+		return nil, errYouDoNotHaveEnoughSpace
+	}
+
+	if session.FolderID != nil {
+		folder, err := s.folderService.findByID(ctx, *session.FolderID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, errFolderNotFound
+			}
+			return nil, err
+		}
+
+		if folder.DeletedAt != nil {
+			return nil, errFolderNotFound
+		}
+
+		hasFile, err := s.folderService.hasFile(ctx, folder.ID, session.DownloadName)
+		if err != nil {
+			return nil, err
+		}
+		if hasFile {
+			return nil, errTheFileWithThatNameAlreadyExists
+		}
+
+		session.Public = nil
+	}
+
+	// Sending user to timeout
+	if err := s.rdb.Set(ctx, FileCreateDelayPrefix(userSpace.UserID), 1, time.Minute * 2).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to set user(%s) to timeout in redis: %s", userSpace.UserID, err.Error())
+		return nil, errInternal
+	}
+
+	session.ID = uuid.NewString()
+	session.CreatorID = userSpace.UserID
+	session.OwnerID = targetSpace.UserID
+	session.Offset = 0
+	session.CreatedAt = time.Now()
+	session.ExpiresAt = session.CreatedAt.Add(viper.GetDuration("uploads.sessionTTL"))
+
+	if err := os.MkdirAll(uploadsDir(), 0o700); err != nil {
+		s.logger.Sugar().Errorf("failed to create uploads directory: %s", err.Error())
+		return nil, errInternal
+	}
+
+	f, err := os.OpenFile(s.chunksPath(session.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to create upload session(%s) file: %s", session.ID, err.Error())
+		return nil, errInternal
+	}
+	f.Close()
+
+	if err := s.repo.Postgres.UploadSession.Create(ctx, session); err != nil {
+		s.logger.Sugar().Errorf("failed to create upload session for user(%s) in postgres: %s", userSpace.UserID, err.Error())
+		os.Remove(s.chunksPath(session.ID))
+		return nil, errInternal
+	}
+
+	s.clearSpaceCache(ctx, session.OwnerID)
+
+	return &session, nil
+}
+
+func (s *uploadSessionService) Get(ctx context.Context, id, userID string) (*model.UploadSession, error) {
+	session, err := s.repo.Postgres.UploadSession.FindByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errUploadSessionNotFound
+		}
+		s.logger.Sugar().Errorf("failed to find upload session(%s) in postgres: %s", id, err.Error())
+		return nil, errInternal
+	}
+
+	if session.CreatorID != userID {
+		return nil, errNoAccess
+	}
+
+	return session, nil
+}
+
+func (s *uploadSessionService) WriteChunk(ctx context.Context, id, userID string, offset int64, chunk io.Reader) (int64, error) {
+	unlock, err := s.lock(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	session, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if offset != session.Offset {
+		return session.Offset, errUploadOffsetMismatch
+	}
+
+	f, err := os.OpenFile(s.chunksPath(id), os.O_WRONLY, 0o600)
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to open upload session(%s) file: %s", id, err.Error())
+		return 0, errInternal
+	}
+	defer f.Close()
+
+	// Dropping bytes of a previous chunk that were written but never committed
+	if err := f.Truncate(offset); err != nil {
+		s.logger.Sugar().Errorf("failed to truncate upload session(%s) file: %s", id, err.Error())
+		return 0, errInternal
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		s.logger.Sugar().Errorf("failed to seek upload session(%s) file: %s", id, err.Error())
+		return 0, errInternal
+	}
+
+	limited := newSizeLimitReader(chunk, session.Size - offset)
+	written, copyErr := io.Copy(f, limited)
+	if limited.exceeded() {
+		return session.Offset, errUploadChunkIsTooBig
+	}
+
+	// Keeping the received part of an interrupted chunk, the client resumes from there
+	newOffset := offset + written
+	if err := s.repo.Postgres.UploadSession.UpdateOffset(ctx, id, newOffset, time.Now().Add(viper.GetDuration("uploads.sessionTTL"))); err != nil {
+		s.logger.Sugar().Errorf("failed to update upload session(%s) offset in postgres: %s", id, err.Error())
+		return session.Offset, errInternal
+	}
+
+	if copyErr != nil {
+		s.logger.Sugar().Errorf("failed to write chunk to upload session(%s) at offset %d: %s", id, offset, copyErr.Error())
+		return newOffset, errInternal
+	}
+
+	return newOffset, nil
+}
+
+func (s *uploadSessionService) Finalize(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.File, error) {
+	var file *model.File
+	err := s.finalize(ctx, id, userRole, userSpace, func(targetSpace model.FullUserSpace, fileObj model.File, f *os.File, fileHeader *multipart.FileHeader) error {
+		var err error
+		file, err = s.fileService.create(ctx, targetSpace, fileObj, f, fileHeader)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// FinalizeExtract unpacks the uploaded archive into a new folder instead of saving it as a file
+func (s *uploadSessionService) FinalizeExtract(ctx context.Context, id, userRole string, userSpace model.FullUserSpace) (*model.ExtractReport, error) {
+	var report *model.ExtractReport
+	err := s.finalize(ctx, id, userRole, userSpace, func(targetSpace model.FullUserSpace, fileObj model.File, f *os.File, fileHeader *multipart.FileHeader) error {
+		var err error
+		report, err = s.fileService.extract(ctx, userRole, userSpace, targetSpace, fileObj, f, fileHeader)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// finalize hands the complete upload to save and deletes the session once it is saved
+func (s *uploadSessionService) finalize(ctx context.Context, id, userRole string, userSpace model.FullUserSpace, save func(targetSpace model.FullUserSpace, fileObj model.File, f *os.File, fileHeader *multipart.FileHeader) error) error {
+	unlock, err := s.lock(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	session, err := s.Get(ctx, id, userSpace.UserID)
+	if err != nil {
+		return err
+	}
+
+	if session.Offset != session.Size {
+		return errUploadIsNotComplete
+	}
+
+	f, err := os.Open(s.chunksPath(id))
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to open upload session(%s) file: %s", id, err.Error())
+		return errInternal
+	}
+	defer f.Close()
+
+	fileObj := model.File{
+		FolderID: session.FolderID,
+		CreatorID: session.CreatorID,
+		Public: session.Public,
+		DownloadName: session.DownloadName,
+	}
+	if fileObj.Public == nil {
+		fileObj.Public = new(bool)
+	}
+	fileHeader := &multipart.FileHeader{
+		Filename: session.DownloadName,
+		Size: session.Size,
+	}
+
+	// Access to the folder may have been taken away during the upload
+	targetSpace, err := s.fileService.uploadTarget(ctx, session.FolderID, userRole, userSpace)
+	if err != nil {
+		return err
+	}
+
+	// The session's own reservation must not count against it
+	if targetSpace.UserID == session.OwnerID {
+		targetSpace.Size -= session.Size
+	}
+
+	if err := save(targetSpace, fileObj, f, fileHeader); err != nil {
+		return err
+	}
+
+	s.delete(ctx, session)
+
+	return nil
+}
+
+func (s *uploadSessionService) Abort(ctx context.Context, id, userID string) error {
+	unlock, err := s.lock(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	session, err := s.Get(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.delete(ctx, session)
+}
+
+func (s *uploadSessionService) StartExpiringSessions(ctx context.Context) {
+	ticker := time.NewTicker(viper.GetDuration("uploads.cleanupInterval"))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sessions, err := s.repo.Postgres.UploadSession.FindExpired(ctx, time.Now())
+			if err != nil {
+				s.logger.Sugar().Errorf("failed to find expired upload sessions in postgres: %s", err.Error())
+				continue
+			}
+
+			for _, session := range sessions {
+				s.delete(ctx, session)
+			}
+		}
+	}
+}
+
+func (s *uploadSessionService) delete(ctx context.Context, session *model.UploadSession) error {
+	if err := s.repo.Postgres.UploadSession.Delete(ctx, session.ID); err != nil {
+		s.logger.Sugar().Errorf("failed to delete upload session(%s) from postgres: %s", session.ID, err.Error())
+		return errInternal
+	}
+
+	if err := os.Remove(s.chunksPath(session.ID)); err != nil && !os.IsNotExist(err) {
+		s.logger.Sugar().Errorf("failed to remove upload session(%s) file: %s", session.ID, err.Error())
+	}
+
+	s.clearSpaceCache(ctx, session.OwnerID)
+
+	return nil
+}
+
+func (s *uploadSessionService) lock(ctx context.Context, id string) (func(), error) {
+	ok, err := s.rdb.SetNX(ctx, UploadSessionLockPrefix(id), 1, viper.GetDuration("uploads.chunkTimeout")).Result()
+	if err != nil {
+		s.logger.Sugar().Errorf("failed to lock upload session(%s) in redis: %s", id, err.Error())
+		return nil, errInternal
+	}
+	if !ok {
+		return nil, errUploadSessionIsBusy
+	}
+
+	return func() {
+		if err := s.rdb.Del(context.Background(), UploadSessionLockPrefix(id)).Err(); err != nil {
+			s.logger.Sugar().Errorf("failed to unlock upload session(%s) in redis: %s", id, err.Error())
+		}
+	}, nil
+}
+
+func (s *uploadSessionService) clearSpaceCache(ctx context.Context, userID string) {
+	if err := s.rdb.Del(ctx, SpacePrefix(userID), SpaceSizePrefix(userID)).Err(); err != nil {
+		s.logger.Sugar().Errorf("failed to clear user(%s) space cache in redis: %s", userID, err.Error())
+	}
+}
+
+func (s *uploadSessionService) chunksPath(id string) string {
+	return filepath.Join(uploadsDir(), id)
+}
+
+func uploadsDir() string {
+	if dir := viper.GetString("uploads.dir"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "file-service-uploads")
+}
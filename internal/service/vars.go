@@ -1,5 +1,8 @@
 package service
 
+// deleteBatchSize is the max number of blobs deleted from storage in one request
+const deleteBatchSize = 100
+
 type level struct {
 	maxFileSize int64
 	maxSpaceSize int64
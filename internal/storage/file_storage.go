@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+)
+
+// fileStorage is a client of the file-storage service
+type fileStorage struct {
+	origin     string
+	token      string
+	httpClient *http.Client
+}
+
+func NewFileStorage(origin, token string) Backend {
+	return &fileStorage{
+		origin: origin,
+		token: token,
+		httpClient: &http.Client{},
+	}
+}
+
+type uploadResponse struct {
+	Ok       bool   `json:"ok"`
+	URL      string `json:"url"`
+	FileSize int64  `json:"file_size"`
+}
+
+func (s *fileStorage) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	endpoint := "/files"
+
+	// Streaming request body, so the file is never held in memory as a whole
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	writeErr := make(chan error, 1)
+	go func() {
+		err := writeUploadBody(writer, path.Dir(key), path.Base(key), r)
+		pw.CloseWithError(err)
+		writeErr <- err
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.origin + endpoint, pr)
+	if err != nil {
+		pr.Close()
+		<-writeErr
+		return 0, fmt.Errorf("failed to create file-storage request: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-Internal-Token", s.token)
+
+	resp, err := s.httpClient.Do(req)
+	pr.Close()
+	werr := <-writeErr
+	if err != nil {
+		if werr != nil {
+			return 0, werr
+		}
+		return 0, fmt.Errorf("failed to do file-storage request: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if werr != nil {
+		return 0, werr
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response body from file-storage: %s", err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, responseError(endpoint, resp.StatusCode, body)
+	}
+
+	var response uploadResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal json response from file-storage: %s", err.Error())
+	}
+
+	return response.FileSize, nil
+}
+
+func writeUploadBody(writer *multipart.Writer, dir, filename string, file io.Reader) error {
+	// Writing text fields
+	if err := writer.WriteField("path", dir); err != nil {
+		return fmt.Errorf("failed to write 'path' field for file-storage request: %s", err.Error())
+	}
+
+	// Writing file
+	fileWriter, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file part for file-storage request: %s", err.Error())
+	}
+
+	if _, err := io.Copy(fileWriter, file); err != nil {
+		return fmt.Errorf("failed to copy file content for file-storage request: %s", err.Error())
+	}
+
+	// End of request body
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close writer for file-storage request: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (s *fileStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.requestFile(ctx, http.MethodGet, key, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (s *fileStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	resp, err := s.requestFile(ctx, http.MethodGet, key, fmt.Sprintf("bytes=%d-%d", offset, offset + length - 1))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusPartialContent {
+		return resp.Body, nil
+	}
+
+	// file-storage ignored the range and sent the whole file
+	if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to skip to offset %d of file(%s): %s", offset, key, err.Error())
+	}
+
+	return readCloser{Reader: io.LimitReader(resp.Body, length), Closer: resp.Body}, nil
+}
+
+func (s *fileStorage) requestFile(ctx context.Context, method, key, rangeHeader string) (*http.Response, error) {
+	fileURL, err := url.JoinPath(s.origin, "files", key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build file-storage URL for file(%s): %s", key, err.Error())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new request to file-storage: %s", err.Error())
+	}
+	req.Header.Set("X-Internal-Token", s.token)
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file(%s) from file-storage: %s", key, err.Error())
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("file-storage server responded with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return resp, nil
+}
+
+func (s *fileStorage) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	endpoint := "/files"
+
+	jsonBody, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON request body: %s", err.Error())
+	}
+
+	return s.doJSON(ctx, http.MethodDelete, endpoint, jsonBody)
+}
+
+type createFolderReq struct {
+	Path string `json:"path"`
+}
+
+func (s *fileStorage) MkdirAll(ctx context.Context, key string) error {
+	endpoint := "/folders"
+
+	bodyJSON, err := json.Marshal(createFolderReq{Path: key})
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON request body: %s", err.Error())
+	}
+
+	return s.doJSON(ctx, http.MethodPost, endpoint, bodyJSON)
+}
+
+func (s *fileStorage) doJSON(ctx context.Context, method, endpoint string, jsonBody []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.origin + endpoint, bytes.NewReader(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create new HTTP request for file-storage: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-Token", s.token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to do file-storage request: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body from file-storage: %s", err.Error())
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(endpoint, resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+func (s *fileStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := s.requestFile(ctx, http.MethodHead, key, "")
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := &ObjectInfo{Key: key, Size: resp.ContentLength}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+
+	return info, nil
+}
+
+// List is not supported, file-storage has no endpoint for listing directories
+func (s *fileStorage) List(ctx context.Context, prefix string) ([]*ObjectInfo, error) {
+	return nil, ErrNotSupported
+}
+
+// Move copies the object to the new key and deletes the old one, file-storage has no move endpoint
+func (s *fileStorage) Move(ctx context.Context, srcKey, dstKey string) error {
+	if err := s.Copy(ctx, srcKey, dstKey); err != nil {
+		return err
+	}
+
+	return s.Delete(ctx, srcKey)
+}
+
+// MovePrefix is not supported, file-storage has no endpoint for moving directories, so callers move the
+// objects under it one by one
+func (s *fileStorage) MovePrefix(ctx context.Context, srcKey, dstKey string) error {
+	return ErrNotSupported
+}
+
+// Copy downloads the object and uploads it again, file-storage has no copy endpoint
+func (s *fileStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = s.Put(ctx, dstKey, src)
+	return err
+}
+
+func responseError(endpoint string, statusCode int, body []byte) error {
+	var bodyJSON map[string]interface{}
+	if err := json.Unmarshal(body, &bodyJSON); err != nil {
+		return fmt.Errorf("failed to decode error response from file-storage: %s", err.Error())
+	}
+	return fmt.Errorf("ERROR from file-storage endpoint(%s), code(%d), details: %s", endpoint, statusCode, bodyJSON["details"])
+}
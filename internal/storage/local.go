@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// local keeps blobs in a directory of the local filesystem
+type local struct {
+	root string
+}
+
+func NewLocal(root string) (Backend, error) {
+	if root == "" {
+		return nil, fmt.Errorf("local storage root is not set")
+	}
+
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create local storage root(%s): %s", root, err.Error())
+	}
+
+	return &local{root: root}, nil
+}
+
+// path resolves key inside the root, so keys can never point outside of it
+func (s *local) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/" + key)))
+}
+
+func (s *local) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	p := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create directory for file(%s): %s", key, err.Error())
+	}
+
+	// Writing to a temporary file first, so a failed upload never leaves a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary file for file(%s): %s", key, err.Error())
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, contextReader{ctx: ctx, r: r})
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write file(%s): %s", key, err.Error())
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close file(%s): %s", key, err.Error())
+	}
+
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return 0, fmt.Errorf("failed to save file(%s): %s", key, err.Error())
+	}
+
+	return written, nil
+}
+
+func (s *local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open file(%s): %s", key, err.Error())
+	}
+
+	return f, nil
+}
+
+func (s *local) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open file(%s): %s", key, err.Error())
+	}
+
+	return readCloser{Reader: io.NewSectionReader(f, offset, length), Closer: f}, nil
+}
+
+func (s *local) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		p := s.path(key)
+		if p == filepath.Clean(s.root) {
+			return fmt.Errorf("refusing to delete storage root")
+		}
+
+		if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("failed to delete file(%s): %s", key, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (s *local) MkdirAll(ctx context.Context, key string) error {
+	if err := os.MkdirAll(s.path(key), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory(%s): %s", key, err.Error())
+	}
+
+	return nil
+}
+
+func (s *local) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file(%s): %s", key, err.Error())
+	}
+
+	return &ObjectInfo{
+		Key: key,
+		Size: info.Size(),
+		ModTime: info.ModTime(),
+		IsDir: info.IsDir(),
+	}, nil
+}
+
+func (s *local) List(ctx context.Context, prefix string) ([]*ObjectInfo, error) {
+	var objects []*ObjectInfo
+	err := filepath.WalkDir(s.path(prefix), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, &ObjectInfo{
+			Key: filepath.ToSlash(rel),
+			Size: info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files by prefix(%s): %s", prefix, err.Error())
+	}
+
+	return objects, nil
+}
+
+func (s *local) Move(ctx context.Context, srcKey, dstKey string) error {
+	dst := s.path(dstKey)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for file(%s): %s", dstKey, err.Error())
+	}
+
+	if err := os.Rename(s.path(srcKey), dst); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to move file(%s) to (%s): %s", srcKey, dstKey, err.Error())
+	}
+
+	return nil
+}
+
+// MovePrefix renames the directory, a missing directory has nothing to move
+func (s *local) MovePrefix(ctx context.Context, srcKey, dstKey string) error {
+	src, dst := s.path(srcKey), s.path(dstKey)
+	if src == filepath.Clean(s.root) {
+		return fmt.Errorf("refusing to move storage root")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for directory(%s): %s", dstKey, err.Error())
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to move directory(%s) to (%s): %s", srcKey, dstKey, err.Error())
+	}
+
+	return nil
+}
+
+func (s *local) Copy(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = s.Put(ctx, dstKey, src)
+	return err
+}
+
+// contextReader stops reading once the context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// maxCopySize is the largest object S3 copies in a single request
+const maxCopySize = 5 << 30
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// PartSize is the size of multipart upload parts, 0 lets the client pick it
+	PartSize  uint64
+}
+
+// s3Storage keeps blobs in an S3 compatible object storage, e.g. MinIO
+type s3Storage struct {
+	client   *minio.Client
+	bucket   string
+	partSize uint64
+}
+
+func NewS3(ctx context.Context, cfg S3Config) (Backend, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %s", err.Error())
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if bucket(%s) exists: %s", cfg.Bucket, err.Error())
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket(%s): %s", cfg.Bucket, err.Error())
+		}
+	}
+
+	return &s3Storage{
+		client: client,
+		bucket: cfg.Bucket,
+		partSize: cfg.PartSize,
+	}, nil
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	// Unknown size makes the client stream the object as a multipart upload
+	info, err := s.client.PutObject(ctx, s.bucket, objectKey(key), r, -1, minio.PutObjectOptions{
+		PartSize: s.partSize,
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to put object(%s): %s", key, err.Error())
+	}
+
+	return info.Size, nil
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.getObject(ctx, key, minio.GetObjectOptions{})
+}
+
+func (s *s3Storage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset + length - 1); err != nil {
+		return nil, fmt.Errorf("failed to set range of object(%s): %s", key, err.Error())
+	}
+
+	return s.getObject(ctx, key, opts)
+}
+
+func (s *s3Storage) getObject(ctx context.Context, key string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	// The request is made right away, so missing objects fail here. minio.Object is lazy
+	// and drops the range when it is stat'ed first
+	body, _, _, err := minio.Core{Client: s.client}.GetObject(ctx, s.bucket, objectKey(key), opts)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get object(%s): %s", key, err.Error())
+	}
+
+	return body, nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, keys ...string) error {
+	objects := make(chan minio.ObjectInfo)
+
+	listErr := make(chan error, 1)
+	go func() {
+		defer close(objects)
+
+		send := func(obj minio.ObjectInfo) bool {
+			select {
+			case objects <- obj:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, key := range keys {
+			key = objectKey(key)
+			if !send(minio.ObjectInfo{Key: key}) {
+				listErr <- ctx.Err()
+				return
+			}
+
+			// A key may be a directory, everything under it goes too
+			for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: key + "/", Recursive: true}) {
+				if obj.Err != nil {
+					listErr <- obj.Err
+					return
+				}
+				if !send(obj) {
+					listErr <- ctx.Err()
+					return
+				}
+			}
+		}
+		listErr <- nil
+	}()
+
+	// Objects are removed in batches of up to 1000 keys per request
+	var failed []string
+	for removeErr := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if removeErr.Err != nil && !isNotFound(removeErr.Err) {
+			failed = append(failed, fmt.Sprintf("%s: %s", removeErr.ObjectName, removeErr.Err.Error()))
+		}
+	}
+
+	if err := <-listErr; err != nil {
+		return fmt.Errorf("failed to list objects to delete: %s", err.Error())
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to delete objects: %s", strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// MkdirAll does nothing, directories exist implicitly as key prefixes
+func (s *s3Storage) MkdirAll(ctx context.Context, key string) error {
+	return nil
+}
+
+func (s *s3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, objectKey(key), minio.StatObjectOptions{})
+	if err == nil {
+		return &ObjectInfo{Key: key, Size: info.Size, ModTime: info.LastModified}, nil
+	}
+	if !isNotFound(err) {
+		return nil, fmt.Errorf("failed to stat object(%s): %s", key, err.Error())
+	}
+
+	// Not an object, but it may still be a directory
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: objectKey(key) + "/", MaxKeys: 1}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to stat directory(%s): %s", key, obj.Err.Error())
+		}
+		return &ObjectInfo{Key: key, IsDir: true}, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *s3Storage) List(ctx context.Context, prefix string) ([]*ObjectInfo, error) {
+	listPrefix := objectKey(prefix)
+	if listPrefix != "" {
+		listPrefix += "/"
+	}
+
+	var objects []*ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: listPrefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list objects by prefix(%s): %s", prefix, obj.Err.Error())
+		}
+
+		objects = append(objects, &ObjectInfo{
+			Key: obj.Key,
+			Size: obj.Size,
+			ModTime: obj.LastModified,
+		})
+	}
+
+	return objects, nil
+}
+
+func (s *s3Storage) Move(ctx context.Context, srcKey, dstKey string) error {
+	if err := s.Copy(ctx, srcKey, dstKey); err != nil {
+		return err
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, objectKey(srcKey), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove moved object(%s): %s", srcKey, err.Error())
+	}
+
+	return nil
+}
+
+// MovePrefix copies every object under srcKey inside the bucket and deletes the originals once all of them are copied,
+// S3 has no rename but nothing is downloaded
+func (s *s3Storage) MovePrefix(ctx context.Context, srcKey, dstKey string) error {
+	objects, err := s.List(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+
+	srcPrefix, dstPrefix := objectKey(srcKey) + "/", objectKey(dstKey) + "/"
+	copied := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		dst := dstPrefix + strings.TrimPrefix(obj.Key, srcPrefix)
+		if err := s.Copy(ctx, obj.Key, dst); err != nil {
+			if err := s.Delete(ctx, copied...); err != nil {
+				return fmt.Errorf("failed to delete copies of moved objects: %s", err.Error())
+			}
+			return err
+		}
+		copied = append(copied, dst)
+	}
+
+	return s.Delete(ctx, srcKey)
+}
+
+// Copy copies the object inside the bucket without downloading it
+func (s *s3Storage) Copy(ctx context.Context, srcKey, dstKey string) error {
+	info, err := s.Stat(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+
+	src := minio.CopySrcOptions{Bucket: s.bucket, Object: objectKey(srcKey)}
+	dst := minio.CopyDestOptions{Bucket: s.bucket, Object: objectKey(dstKey)}
+
+	// Bigger objects are copied part by part
+	if info.Size > maxCopySize {
+		_, err = s.client.ComposeObject(ctx, dst, src)
+	} else {
+		_, err = s.client.CopyObject(ctx, dst, src)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy object(%s) to (%s): %s", srcKey, dstKey, err.Error())
+	}
+
+	return nil
+}
+
+// objectKey normalizes key, object keys never start with a slash
+func objectKey(key string) string {
+	return strings.TrimPrefix(path.Clean("/" + key), "/")
+}
+
+func isNotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
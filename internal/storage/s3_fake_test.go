@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeS3 is an in-memory S3 server with just the part of the API the s3 backend uses
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	// objects are kept by "<bucket>/<key>"
+	objects map[string]fakeObject
+	uploads map[string]map[int][]byte
+}
+
+type fakeObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		buckets: map[string]bool{},
+		objects: map[string]fakeObject{},
+		uploads: map[string]map[int][]byte{},
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodHead:
+			if !f.buckets[bucket] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPut:
+			f.buckets[bucket] = true
+		case r.Method == http.MethodGet:
+			f.list(w, bucket, q)
+		case r.Method == http.MethodPost && q.Has("delete"):
+			f.deleteObjects(w, r, bucket)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+		return
+	}
+
+	name := bucket + "/" + key
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		id := strconv.Itoa(len(f.uploads) + 1)
+		f.uploads[id] = map[int][]byte{}
+		writeXML(w, http.StatusOK, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: id})
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		part, _ := strconv.Atoi(q.Get("partNumber"))
+		data := readBody(r)
+		f.uploads[q.Get("uploadId")][part] = data
+		w.Header().Set("ETag", etag(data))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		parts := f.uploads[q.Get("uploadId")]
+		numbers := make([]int, 0, len(parts))
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+
+		var data []byte
+		for _, n := range numbers {
+			data = append(data, parts[n]...)
+		}
+		delete(f.uploads, q.Get("uploadId"))
+		f.objects[name] = fakeObject{data: data, modTime: time.Now()}
+
+		writeXML(w, http.StatusOK, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: etag(data)})
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, _ := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"))
+		obj, ok := f.objects[src]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		f.objects[name] = fakeObject{data: obj.data, modTime: time.Now()}
+
+		writeXML(w, http.StatusOK, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			LastModified time.Time
+			ETag         string
+		}{LastModified: time.Now().UTC(), ETag: etag(obj.data)})
+	case r.Method == http.MethodPut:
+		data := readBody(r)
+		f.objects[name] = fakeObject{data: data, modTime: time.Now()}
+		w.Header().Set("ETag", etag(data))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.get(w, r, name)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, name string) {
+	obj, ok := f.objects[name]
+	if !ok {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	data := obj.data
+	status := http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		var start, end int
+		fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end + 1]
+		status = http.StatusPartialContent
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", etag(obj.data))
+	w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+type fakeListEntry struct {
+	Key          string
+	LastModified time.Time
+	ETag         string
+	Size         int64
+}
+
+type fakeCommonPrefix struct {
+	Prefix string
+}
+
+// list answers ListObjectsV2 in a single page
+func (f *fakeS3) list(w http.ResponseWriter, bucket string, q url.Values) {
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	maxKeys, err := strconv.Atoi(q.Get("max-keys"))
+	if err != nil || maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	var names []string
+	for name := range f.objects {
+		if key, ok := strings.CutPrefix(name, bucket + "/"); ok && strings.HasPrefix(key, prefix) {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+
+	var contents []fakeListEntry
+	var prefixes []fakeCommonPrefix
+	seen := map[string]bool{}
+	for _, key := range names {
+		if len(contents) + len(prefixes) == maxKeys {
+			break
+		}
+
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				p := key[:len(prefix) + i + 1]
+				if !seen[p] {
+					seen[p] = true
+					prefixes = append(prefixes, fakeCommonPrefix{Prefix: p})
+				}
+				continue
+			}
+		}
+
+		obj := f.objects[bucket + "/" + key]
+		contents = append(contents, fakeListEntry{Key: key, LastModified: obj.modTime.UTC(), ETag: etag(obj.data), Size: int64(len(obj.data))})
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		KeyCount       int
+		MaxKeys        int
+		IsTruncated    bool
+		Contents       []fakeListEntry
+		CommonPrefixes []fakeCommonPrefix
+	}{Name: bucket, Prefix: prefix, KeyCount: len(contents) + len(prefixes), MaxKeys: maxKeys, Contents: contents, CommonPrefixes: prefixes})
+}
+
+func (f *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	var req struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	if err := xml.Unmarshal(readBody(r), &req); err != nil {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	for _, obj := range req.Objects {
+		delete(f.objects, bucket + "/" + obj.Key)
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+	}{})
+}
+
+// readBody reads the request body, decoding the aws-chunked encoding of streaming signed uploads
+func readBody(r *http.Request) []byte {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		data, _ := io.ReadAll(r.Body)
+		return data
+	}
+
+	var data bytes.Buffer
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return data.Bytes()
+		}
+
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil || size == 0 {
+			return data.Bytes()
+		}
+
+		if _, err := io.CopyN(&data, br, size); err != nil {
+			return data.Bytes()
+		}
+		br.ReadString('\n')
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	writeXML(w, status, struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
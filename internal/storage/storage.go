@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	ErrNotFound = errors.New("object not found")
+	ErrNotSupported = errors.New("operation is not supported by the storage backend")
+)
+
+// Backend stores blobs under slash separated keys, e.g. "<userID>/folders/<name>/<filename>"
+type Backend interface {
+	// Put stores everything read from r under key and returns the number of stored bytes
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange returns length bytes of the object starting at offset
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete removes objects, a key of a directory removes everything under it
+	Delete(ctx context.Context, keys ...string) error
+	MkdirAll(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// List returns every object under prefix recursively
+	List(ctx context.Context, prefix string) ([]*ObjectInfo, error)
+	Move(ctx context.Context, srcKey, dstKey string) error
+	// MovePrefix moves everything under the directory srcKey to dstKey at once, ErrNotSupported is
+	// returned if the backend can only move objects one by one
+	MovePrefix(ctx context.Context, srcKey, dstKey string) error
+	Copy(ctx context.Context, srcKey, dstKey string) error
+}
+
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// New creates the backend selected by the "storage.backend" config value
+func New(backend string) (Backend, error) {
+	switch backend {
+	case "", "fileStorage":
+		return NewFileStorage(viper.GetString("fileStorage.origin"), os.Getenv("X_INTERNAL_TOKEN")), nil
+	case "local":
+		return NewLocal(viper.GetString("storage.local.root"))
+	case "s3":
+		return NewS3(context.Background(), S3Config{
+			Endpoint: viper.GetString("storage.s3.endpoint"),
+			Region: viper.GetString("storage.s3.region"),
+			Bucket: viper.GetString("storage.s3.bucket"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			UseSSL: viper.GetBool("storage.s3.useSSL"),
+			PartSize: uint64(viper.GetSizeInBytes("storage.s3.partSize")),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", backend)
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBackends(t *testing.T) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) Backend
+	}{
+		{name: "local", new: newTestLocal},
+		{name: "s3", new: newTestS3},
+	}
+
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			testBackend(t, b.new(t))
+		})
+	}
+}
+
+func newTestLocal(t *testing.T) Backend {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func newTestS3(t *testing.T) Backend {
+	srv := httptest.NewServer(newFakeS3())
+	t.Cleanup(srv.Close)
+
+	store, err := NewS3(context.Background(), S3Config{
+		Endpoint: strings.TrimPrefix(srv.URL, "http://"),
+		Region: "us-east-1",
+		Bucket: "files",
+		AccessKey: "access-key",
+		SecretKey: "secret-key",
+		PartSize: 5 << 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func testBackend(t *testing.T, store Backend) {
+	ctx := context.Background()
+
+	// Bigger than a part, so S3 uploads it in several parts
+	big := make([]byte, 11 << 20)
+	rand.New(rand.NewSource(1)).Read(big)
+
+	objects := map[string][]byte{
+		"user/folders/docs/a.txt": []byte("hello, world"),
+		"user/folders/docs/sub/big.bin": big,
+		"user/b.txt": []byte("outside"),
+	}
+	for key, data := range objects {
+		n, err := store.Put(ctx, key, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Put(%s): %s", key, err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("Put(%s) stored %d bytes, want %d", key, n, len(data))
+		}
+	}
+
+	reads := []struct {
+		name    string
+		key     string
+		offset  int64
+		length  int64 // negative reads the whole object
+		want    []byte
+		wantErr error
+	}{
+		{name: "whole", key: "user/folders/docs/a.txt", length: -1, want: []byte("hello, world")},
+		{name: "whole big", key: "user/folders/docs/sub/big.bin", length: -1, want: big},
+		{name: "range", key: "user/folders/docs/a.txt", offset: 7, length: 5, want: []byte("world")},
+		{name: "range across parts", key: "user/folders/docs/sub/big.bin", offset: 5 << 20 - 10, length: 20, want: big[5 << 20 - 10 : 5 << 20 + 10]},
+		{name: "missing", key: "user/missing.txt", length: -1, wantErr: ErrNotFound},
+		{name: "missing range", key: "user/missing.txt", offset: 1, length: 2, wantErr: ErrNotFound},
+	}
+	for _, tt := range reads {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := read(ctx, store, tt.key, tt.offset, tt.length)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("read %d bytes, not the %d bytes wanted", len(got), len(tt.want))
+			}
+		})
+	}
+
+	assertKeys(t, store, "user/folders", "user/folders/docs/a.txt", "user/folders/docs/sub/big.bin")
+
+	info, err := store.Stat(ctx, "user/folders/docs")
+	if err != nil {
+		t.Fatalf("Stat of directory: %s", err)
+	}
+	if !info.IsDir {
+		t.Fatalf("Stat of directory is not a directory")
+	}
+
+	if err := store.Move(ctx, "user/folders/docs/a.txt", "user/folders/moved/a.txt"); err != nil {
+		t.Fatalf("Move: %s", err)
+	}
+	if _, err := store.Get(ctx, "user/folders/docs/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of moved object: err = %v, want %v", err, ErrNotFound)
+	}
+	if got, err := read(ctx, store, "user/folders/moved/a.txt", 0, -1); err != nil || string(got) != "hello, world" {
+		t.Fatalf("Get of object moved to new key = %q, %v", got, err)
+	}
+
+	if err := store.MovePrefix(ctx, "user/folders/docs", "user/folders/renamed"); err != nil {
+		t.Fatalf("MovePrefix: %s", err)
+	}
+	assertKeys(t, store, "user/folders", "user/folders/moved/a.txt", "user/folders/renamed/sub/big.bin")
+	if got, err := read(ctx, store, "user/folders/renamed/sub/big.bin", 0, -1); err != nil || !bytes.Equal(got, big) {
+		t.Fatalf("Get of object moved with its directory: %v", err)
+	}
+
+	// Deleting a directory deletes everything under it, keys that only share the prefix stay
+	if _, err := store.Put(ctx, "user/folders-other.txt", strings.NewReader("kept")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "user/folders"); err != nil {
+		t.Fatalf("Delete of directory: %s", err)
+	}
+	assertKeys(t, store, "user", "user/b.txt", "user/folders-other.txt")
+}
+
+func read(ctx context.Context, store Backend, key string, offset, length int64) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	if length < 0 {
+		r, err = store.Get(ctx, key)
+	} else {
+		r, err = store.GetRange(ctx, key, offset, length)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+func assertKeys(t *testing.T, store Backend, prefix string, want ...string) {
+	t.Helper()
+
+	objects, err := store.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatalf("List(%s): %s", prefix, err)
+	}
+
+	var keys []string
+	for _, obj := range objects {
+		keys = append(keys, obj.Key)
+	}
+	sort.Strings(keys)
+
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Fatalf("List(%s) = %v, want %v", prefix, keys, want)
+	}
+}
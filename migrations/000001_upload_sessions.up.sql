@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS upload_sessions(
+	id TEXT PRIMARY KEY,
+	creator_id TEXT NOT NULL REFERENCES users_spaces(user_id) ON DELETE CASCADE,
+	folder_id TEXT REFERENCES folders(id) ON DELETE CASCADE,
+	download_name TEXT NOT NULL,
+	public BOOLEAN,
+	size BIGINT NOT NULL,
+	"offset" BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS upload_sessions_creator_id_idx ON upload_sessions(creator_id);
+CREATE INDEX IF NOT EXISTS upload_sessions_expires_at_idx ON upload_sessions(expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE files DROP COLUMN IF EXISTS storage_key;
+ALTER TABLE folders DROP COLUMN IF EXISTS storage_key;
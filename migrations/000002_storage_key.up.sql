@@ -0,0 +1,5 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS storage_key TEXT;
+ALTER TABLE files ALTER COLUMN url DROP NOT NULL;
+
+ALTER TABLE folders ADD COLUMN IF NOT EXISTS storage_key TEXT;
+ALTER TABLE folders ALTER COLUMN url DROP NOT NULL;
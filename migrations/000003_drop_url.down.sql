@@ -0,0 +1,6 @@
+-- url is filled back from storage_key by running cmd/migrate-storage-keys with -down before 000002_storage_key is reverted
+ALTER TABLE files ADD COLUMN IF NOT EXISTS url TEXT;
+ALTER TABLE files ALTER COLUMN storage_key DROP NOT NULL;
+
+ALTER TABLE folders ADD COLUMN IF NOT EXISTS url TEXT;
+ALTER TABLE folders ALTER COLUMN storage_key DROP NOT NULL;
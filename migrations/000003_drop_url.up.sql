@@ -0,0 +1,6 @@
+-- Requires existing rows to be backfilled with cmd/migrate-storage-keys first
+ALTER TABLE files ALTER COLUMN storage_key SET NOT NULL;
+ALTER TABLE files DROP COLUMN IF EXISTS url;
+
+ALTER TABLE folders ALTER COLUMN storage_key SET NOT NULL;
+ALTER TABLE folders DROP COLUMN IF EXISTS url;
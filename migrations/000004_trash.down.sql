@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS folders_deleted_at_idx;
+DROP INDEX IF EXISTS files_deleted_at_idx;
+
+ALTER TABLE folders DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE files DROP COLUMN IF EXISTS deleted_at;
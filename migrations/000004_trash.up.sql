@@ -0,0 +1,5 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+ALTER TABLE folders ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS files_deleted_at_idx ON files(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS folders_deleted_at_idx ON folders(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS file_versions;
+
+ALTER TABLE files DROP COLUMN IF EXISTS version;
@@ -0,0 +1,18 @@
+ALTER TABLE files ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+-- The current version has no storage key, its blob is at the storage key of the file
+CREATE TABLE IF NOT EXISTS file_versions (
+    file_id TEXT NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    archived_at TIMESTAMP,
+    PRIMARY KEY (file_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS file_versions_archived_at_idx ON file_versions(archived_at) WHERE archived_at IS NOT NULL;
+
+INSERT INTO file_versions(file_id, version, size, created_at)
+SELECT id, version, size, date_added FROM files
+ON CONFLICT DO NOTHING;
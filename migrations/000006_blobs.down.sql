@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS file_versions_checksum_idx;
+
+ALTER TABLE file_versions DROP COLUMN IF EXISTS checksum;
+ALTER TABLE files DROP COLUMN IF EXISTS checksum;
+
+DROP TABLE IF EXISTS blobs;
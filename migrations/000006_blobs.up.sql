@@ -0,0 +1,14 @@
+-- Blobs are stored once per content hash and shared by every file version with that checksum
+CREATE TABLE IF NOT EXISTS blobs (
+    hash TEXT PRIMARY KEY,
+    storage_key TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    ref_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Files uploaded before deduplication have no checksum and keep their own blobs
+ALTER TABLE files ADD COLUMN IF NOT EXISTS checksum TEXT;
+ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS checksum TEXT;
+
+CREATE INDEX IF NOT EXISTS file_versions_checksum_idx ON file_versions(checksum) WHERE checksum IS NOT NULL;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS share_links (
+    id TEXT PRIMARY KEY,
+    resource_type TEXT NOT NULL CHECK (resource_type IN ('file', 'folder')),
+    resource_id TEXT NOT NULL,
+    creator_id TEXT NOT NULL,
+    password_hash TEXT,
+    expires_at TIMESTAMP,
+    max_downloads INT,
+    downloads INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS share_links_resource_idx ON share_links(resource_type, resource_id);
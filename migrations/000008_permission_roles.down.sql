@@ -0,0 +1,5 @@
+ALTER TABLE folder_permissions DROP COLUMN IF EXISTS role;
+ALTER TABLE file_permissions DROP COLUMN IF EXISTS role;
+
+DROP INDEX IF EXISTS folder_permissions_folder_id_username_idx;
+DROP INDEX IF EXISTS file_permissions_file_id_username_idx;
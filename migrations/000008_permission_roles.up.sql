@@ -0,0 +1,9 @@
+-- Granting a permission again changes its role, so a user holds a single permission per file or folder
+DELETE FROM file_permissions a USING file_permissions b WHERE a.ctid < b.ctid AND a.file_id = b.file_id AND a.username = b.username;
+DELETE FROM folder_permissions a USING folder_permissions b WHERE a.ctid < b.ctid AND a.folder_id = b.folder_id AND a.username = b.username;
+
+CREATE UNIQUE INDEX IF NOT EXISTS file_permissions_file_id_username_idx ON file_permissions(file_id, username);
+CREATE UNIQUE INDEX IF NOT EXISTS folder_permissions_folder_id_username_idx ON folder_permissions(folder_id, username);
+
+ALTER TABLE file_permissions ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'viewer' CHECK (role IN ('viewer', 'editor', 'manager'));
+ALTER TABLE folder_permissions ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'viewer' CHECK (role IN ('viewer', 'editor', 'manager'));
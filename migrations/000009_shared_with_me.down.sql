@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS folder_permissions_username_idx;
+DROP INDEX IF EXISTS file_permissions_username_idx;
+
+ALTER TABLE folder_permissions DROP COLUMN IF EXISTS created_at;
+ALTER TABLE file_permissions DROP COLUMN IF EXISTS created_at;
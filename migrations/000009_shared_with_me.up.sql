@@ -0,0 +1,5 @@
+ALTER TABLE file_permissions ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+ALTER TABLE folder_permissions ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS file_permissions_username_idx ON file_permissions(username);
+CREATE INDEX IF NOT EXISTS folder_permissions_username_idx ON folder_permissions(username);
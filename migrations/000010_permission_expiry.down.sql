@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS folder_permissions_expires_at_idx;
+DROP INDEX IF EXISTS file_permissions_expires_at_idx;
+
+ALTER TABLE folder_permissions DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE file_permissions DROP COLUMN IF EXISTS expires_at;
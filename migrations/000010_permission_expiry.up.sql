@@ -0,0 +1,5 @@
+ALTER TABLE file_permissions ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+ALTER TABLE folder_permissions ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS file_permissions_expires_at_idx ON file_permissions(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS folder_permissions_expires_at_idx ON folder_permissions(expires_at) WHERE expires_at IS NOT NULL;
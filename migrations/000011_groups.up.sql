@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS groups (
+    id TEXT PRIMARY KEY,
+    owner_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (owner_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id TEXT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    username TEXT NOT NULL,
+    added_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (group_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS group_members_username_idx ON group_members(username);
+
+CREATE TABLE IF NOT EXISTS group_permissions (
+    resource_type TEXT NOT NULL CHECK (resource_type IN ('file', 'folder')),
+    resource_id TEXT NOT NULL,
+    group_id TEXT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'viewer' CHECK (role IN ('viewer', 'editor', 'manager')),
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (resource_type, resource_id, group_id)
+);
+
+CREATE INDEX IF NOT EXISTS group_permissions_group_id_idx ON group_permissions(group_id);
+CREATE INDEX IF NOT EXISTS group_permissions_expires_at_idx ON group_permissions(expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS trusted_users;
+DROP TABLE IF EXISTS invitations;
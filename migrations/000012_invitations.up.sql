@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS invitations (
+    id TEXT PRIMARY KEY,
+    resource_type TEXT NOT NULL CHECK (resource_type IN ('file', 'folder', 'group')),
+    resource_id TEXT NOT NULL,
+    inviter_id TEXT NOT NULL,
+    inviter_name TEXT NOT NULL,
+    invitee TEXT NOT NULL,
+    -- Invitations to groups offer membership instead of a role
+    role TEXT NOT NULL DEFAULT 'viewer' CHECK (CASE resource_type WHEN 'group' THEN role = 'member' ELSE role IN ('viewer', 'editor', 'manager') END),
+    expires_at TIMESTAMP,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined')),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    responded_at TIMESTAMP
+);
+
+-- A user has at most one pending invitation to a file or folder, inviting again updates it
+CREATE UNIQUE INDEX IF NOT EXISTS invitations_pending_idx ON invitations(resource_type, resource_id, invitee) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS invitations_invitee_idx ON invitations(invitee) WHERE status = 'pending';
+
+-- Invitations from trusted users are accepted right away
+CREATE TABLE IF NOT EXISTS trusted_users (
+    username TEXT NOT NULL,
+    trusted_username TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (username, trusted_username)
+);
+
+-- Existing group members stay members, only users added from now on are invited
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS folders_folder_listing_idx;
+DROP INDEX IF EXISTS folders_user_listing_idx;
+DROP INDEX IF EXISTS files_folder_listing_idx;
+DROP INDEX IF EXISTS files_user_listing_idx;
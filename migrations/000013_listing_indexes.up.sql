@@ -0,0 +1,5 @@
+-- Listings are paged by keyset on the sort column and id, newest first by default
+CREATE INDEX IF NOT EXISTS files_user_listing_idx ON files(creator_id, date_added, id) WHERE main_folder_id IS NULL AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS files_folder_listing_idx ON files(folder_id, date_added, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS folders_user_listing_idx ON folders(creator_id, created_at, id) WHERE main_folder_id IS NULL AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS folders_folder_listing_idx ON folders(folder_id, created_at, id) WHERE deleted_at IS NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS folders_name_tsv_idx;
+DROP INDEX IF EXISTS folders_name_trgm_idx;
+DROP INDEX IF EXISTS files_name_tsv_idx;
+DROP INDEX IF EXISTS files_name_trgm_idx;
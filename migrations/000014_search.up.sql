@@ -0,0 +1,7 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Names are matched by substring through trigrams and by whole words through full-text search
+CREATE INDEX IF NOT EXISTS files_name_trgm_idx ON files USING GIN (lower(download_name) gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS files_name_tsv_idx ON files USING GIN (to_tsvector('simple', download_name)) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS folders_name_trgm_idx ON folders USING GIN (lower(name) gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS folders_name_tsv_idx ON folders USING GIN (to_tsvector('simple', name)) WHERE deleted_at IS NULL;
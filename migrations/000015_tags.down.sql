@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS folder_metadata;
+DROP TABLE IF EXISTS file_metadata;
+DROP TABLE IF EXISTS folder_tags;
+DROP TABLE IF EXISTS file_tags;
@@ -0,0 +1,33 @@
+-- Tags and metadata go away with their file or folder
+CREATE TABLE IF NOT EXISTS file_tags (
+    file_id TEXT NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (file_id, tag)
+);
+
+CREATE TABLE IF NOT EXISTS folder_tags (
+    folder_id TEXT NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (folder_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS file_tags_tag_idx ON file_tags(tag);
+CREATE INDEX IF NOT EXISTS folder_tags_tag_idx ON folder_tags(tag);
+
+CREATE TABLE IF NOT EXISTS file_metadata (
+    file_id TEXT NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (file_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS folder_metadata (
+    folder_id TEXT NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (folder_id, key)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS upload_sessions_owner_id_idx;
+
+ALTER TABLE upload_sessions DROP COLUMN IF EXISTS owner_id;
@@ -0,0 +1,8 @@
+-- Uploads into a shared folder reserve the space of the folder owner
+ALTER TABLE upload_sessions ADD COLUMN IF NOT EXISTS owner_id TEXT REFERENCES users_spaces(user_id) ON DELETE CASCADE;
+
+UPDATE upload_sessions u SET owner_id = COALESCE((SELECT d.creator_id FROM folders d WHERE d.id = u.folder_id), u.creator_id) WHERE owner_id IS NULL;
+
+ALTER TABLE upload_sessions ALTER COLUMN owner_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS upload_sessions_owner_id_idx ON upload_sessions(owner_id);